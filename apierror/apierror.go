@@ -0,0 +1,204 @@
+// Package apierror defines the errors the API reports to clients and renders
+// them as RFC 7807 problem details.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem detail responses
+const ContentType = "application/problem+json"
+
+// RequestIDKey is the gin context key the request ID middleware stores the ID under
+const RequestIDKey = "requestID"
+
+// Error is an error with everything needed to report it to the client. Code
+// is stable and meant for programs; Detail is meant for people. Cause is only
+// logged, never sent.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Fields []FieldError
+	Cause  error
+	// Extensions are extra members of the problem, like the allowed values of something
+	Extensions map[string]interface{}
+}
+
+// FieldError explains what is wrong with one field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Code + ": " + e.Detail + ": " + e.Cause.Error()
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// With adds an extension member to the problem and returns e
+func (e *Error) With(name string, value interface{}) *Error {
+	if e.Extensions == nil {
+		e.Extensions = make(map[string]interface{})
+	}
+	e.Extensions[name] = value
+	return e
+}
+
+// BadRequest reports a request that can't be understood, like a body that isn't JSON
+func BadRequest(code, detail string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: code, Detail: detail}
+}
+
+// InvalidParameters reports path or query parameters that can't be used as given
+func InvalidParameters(detail string, fields ...FieldError) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: "invalid_parameters", Detail: detail, Fields: fields}
+}
+
+// Validation reports a well-formed body whose values break the rules
+func Validation(detail string, fields ...FieldError) *Error {
+	return &Error{Status: http.StatusUnprocessableEntity, Code: "validation_failed", Detail: detail, Fields: fields}
+}
+
+// Unprocessable reports a well-formed request that can't be carried out for a
+// reason other than its field values
+func Unprocessable(code, detail string) *Error {
+	return &Error{Status: http.StatusUnprocessableEntity, Code: code, Detail: detail}
+}
+
+// Unauthorized reports a missing or invalid bearer token
+func Unauthorized(code, detail string) *Error {
+	return &Error{Status: http.StatusUnauthorized, Code: code, Detail: detail}
+}
+
+// Forbidden reports a caller who is known but not allowed to do this
+func Forbidden(code, detail string) *Error {
+	return &Error{Status: http.StatusForbidden, Code: code, Detail: detail}
+}
+
+// NotFound reports a resource that doesn't exist or isn't visible to the caller
+func NotFound(code, detail string) *Error {
+	return &Error{Status: http.StatusNotFound, Code: code, Detail: detail}
+}
+
+// Conflict reports a request that clashes with the current state of a resource
+func Conflict(code, detail string) *Error {
+	return &Error{Status: http.StatusConflict, Code: code, Detail: detail}
+}
+
+// PreconditionFailed reports a conditional request whose If-Match no longer
+// holds because the resource changed since the client read it
+func PreconditionFailed(code, detail string) *Error {
+	return &Error{Status: http.StatusPreconditionFailed, Code: code, Detail: detail}
+}
+
+// PreconditionRequired reports a write that must be made conditional
+func PreconditionRequired(detail string) *Error {
+	return &Error{Status: http.StatusPreconditionRequired, Code: "precondition_required", Detail: detail}
+}
+
+// FailedDependency reports an action not taken because another one it depended on failed
+func FailedDependency(code, detail string) *Error {
+	return &Error{Status: http.StatusFailedDependency, Code: code, Detail: detail}
+}
+
+// UnsupportedMediaType reports a body in a format the endpoint doesn't accept
+func UnsupportedMediaType(detail string) *Error {
+	return &Error{Status: http.StatusUnsupportedMediaType, Code: "unsupported_media_type", Detail: detail}
+}
+
+// DependencyUnavailable reports that a service the API relies on failed or timed out
+func DependencyUnavailable(code, detail string, cause error) *Error {
+	return &Error{Status: http.StatusServiceUnavailable, Code: code, Detail: detail, Cause: cause}
+}
+
+// Internal reports an unexpected failure
+func Internal(detail string, cause error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: "internal_error", Detail: detail, Cause: cause}
+}
+
+// Problem is the RFC 7807 body of an error response, with the code, request
+// ID and field errors as extension members.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// Extensions are rendered as members of the problem object itself
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	data, err := json.Marshal(plain(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+
+	members := make(map[string]interface{}, len(p.Extensions))
+	for name, value := range p.Extensions {
+		members[name] = value
+	}
+	// The standard members win over extensions with the same name
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// Abort writes err as a problem response and stops the handler chain. Errors
+// that aren't an *Error are reported as internal errors without their message.
+func Abort(c *gin.Context, err error) {
+	problem := Render(c, err)
+	data, err := json.Marshal(problem)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Abort()
+	c.Data(problem.Status, ContentType, data)
+}
+
+// Render builds the problem reporting err for the request, logging server
+// errors and causes the way Abort does. It is for errors reported inside a
+// larger response, like the results of a batch.
+func Render(c *gin.Context, err error) Problem {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = Internal("An unexpected error occurred", err)
+	}
+
+	requestID := c.GetString(RequestIDKey)
+	if e.Status >= http.StatusInternalServerError || e.Cause != nil {
+		log.Printf("%s %s [%s]: %v", c.Request.Method, c.Request.URL.Path, requestID, e)
+	}
+
+	// The codes are the identifiers, so the type stays about:blank and the title is the status text
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Detail,
+		Instance:  c.Request.URL.Path,
+		Code:      e.Code,
+		RequestID: requestID,
+		Errors:    e.Fields,
+
+		Extensions: e.Extensions,
+	}
+}
@@ -0,0 +1,297 @@
+// Package app wires the service together from its configuration and owns the
+// lifecycle of everything it starts.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/jinzhu/gorm"
+	"github.com/pmas98/go-todo-service/cache"
+	"github.com/pmas98/go-todo-service/config"
+	"github.com/pmas98/go-todo-service/controllers"
+	_ "github.com/pmas98/go-todo-service/docs"
+	"github.com/pmas98/go-todo-service/events"
+	"github.com/pmas98/go-todo-service/middleware"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/reminders"
+	"github.com/pmas98/go-todo-service/repository"
+	"github.com/pmas98/go-todo-service/routes"
+	"github.com/pmas98/go-todo-service/trash"
+	"github.com/pmas98/go-todo-service/utils"
+	"github.com/pmas98/go-todo-service/workflow"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// How long to wait before retrying a consumer group that failed to start
+const consumerRetryDelay = 5 * time.Second
+
+// App is the running service: its connections, background workers and HTTP server
+type App struct {
+	cfg      config.Config
+	db       *gorm.DB
+	rdb      *redis.Client
+	verifier middleware.TokenVerifier
+	caching  *middleware.CachingTokenVerifier
+	server   *http.Server
+	// instanceID tells this replica's token verification replies from the others'
+	instanceID string
+
+	// cancel stops the background workers started by Start
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+
+	consumersMu sync.Mutex
+	consumers   []sarama.ConsumerGroup
+	stopping    bool
+}
+
+// New connects to the database, Redis and Kafka and builds the router. Nothing
+// is served until Start is called; on error everything opened so far is closed.
+func New(ctx context.Context, cfg config.Config) (*App, error) {
+	workflows, err := workflow.Load(cfg.Workflows.File, cfg.Workflows.Default)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workflows: %w", err)
+	}
+
+	a := &App{cfg: cfg}
+	if err := a.connect(ctx); err != nil {
+		a.close()
+		return nil, err
+	}
+
+	if a.instanceID, err = utils.InstanceID(cfg.Kafka.InstanceID); err != nil {
+		a.close()
+		return nil, err
+	}
+	verifier, err := middleware.NewTokenVerifier(cfg.Auth, cfg.Kafka.Topics.TokenVerificationRequests, a.instanceID)
+	if err != nil {
+		a.close()
+		return nil, fmt.Errorf("failed to set up token verification: %w", err)
+	}
+	if cfg.Auth.CacheTTL > 0 {
+		a.caching = middleware.NewCachingTokenVerifier(verifier, cache.NewRedis(a.rdb), cfg.Auth.CacheTTL, cfg.Auth.NegativeCacheTTL, cfg.Auth.RevocationTTL)
+		verifier = a.caching
+	}
+	a.verifier = verifier
+
+	a.server = &http.Server{Addr: cfg.HTTP.Addr(), Handler: a.router(workflows)}
+	return a, nil
+}
+
+func (a *App) connect(ctx context.Context) error {
+	var err error
+	if a.db, err = config.OpenDatabase(a.cfg.Database.DSN); err != nil {
+		return err
+	}
+	if err := models.AutoMigrate(a.db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if a.rdb, err = config.OpenRedis(ctx, a.cfg.Redis); err != nil {
+		return err
+	}
+	if err := utils.InitKafkaProducer(a.cfg.Kafka.Brokers); err != nil {
+		return fmt.Errorf("failed to initialize Kafka producer: %w", err)
+	}
+	return nil
+}
+
+func (a *App) router(workflows *workflow.Registry) *gin.Engine {
+	store := a.store()
+	deps := controllers.Dependencies{
+		Todos:     store.Todos(),
+		Groups:    store.Groups(),
+		Tags:      store.Tags(),
+		Cache:     cache.NewRedis(a.rdb),
+		Workflows: workflows,
+		ItemTTL:   a.cfg.Cache.ItemTTL,
+		ListTTL:   a.cfg.Cache.ListTTL,
+
+		RequireIfMatch: a.cfg.HTTP.RequireIfMatch,
+		IdempotencyTTL: a.cfg.HTTP.IdempotencyRetention,
+	}
+	checks := map[string]controllers.DependencyCheck{
+		"database": func(ctx context.Context) error { return a.db.DB().PingContext(ctx) },
+		"redis":    deps.Cache.Ping,
+		"kafka": func(ctx context.Context) error {
+			return utils.SendMessageToKafka("test-topic", "Ping request!", "ping")
+		},
+	}
+
+	r := routes.SetupRouter(a.verifier, deps, checks)
+
+	// Serve Swagger UI
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	return r
+}
+
+// store keeps data in the database, recording events for the configured topics
+func (a *App) store() *repository.Gorm {
+	return repository.NewGorm(a.db, events.Topics{
+		ToDo:     a.cfg.Kafka.Topics.ToDoEvents,
+		Group:    a.cfg.Kafka.Topics.GroupEvents,
+		Reminder: a.cfg.Kafka.Topics.Reminders,
+	})
+}
+
+// Start starts the Kafka consumers, the outbox relay, the reminder scheduler
+// and the trash purger, then begins serving HTTP. With Kafka token verification it waits
+// for the response consumer first, since no request could be authenticated
+// without it. It returns once the server is listening; ctx only bounds the
+// startup.
+func (a *App) Start(ctx context.Context) error {
+	workerCtx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+
+	if a.caching != nil {
+		a.runWorker(func() { a.consumeTokenRevocations(workerCtx) })
+	}
+
+	// Local verification doesn't need the auth service, so there is nothing to wait for
+	if a.cfg.Auth.Mode != config.AuthModeLocal {
+		if err := a.startTokenVerificationConsumer(ctx, workerCtx); err != nil {
+			return err
+		}
+	}
+
+	// Publish the transactional outbox to Kafka in the background
+	relay := events.NewRelay(a.db, a.cfg.Outbox.RelayInterval, a.cfg.Outbox.BatchSize, a.cfg.Outbox.Retention)
+	a.runWorker(func() { relay.Run(workerCtx) })
+
+	// Reminders fire through the outbox too
+	scheduler := reminders.NewScheduler(a.store().Reminders(), a.cfg.Reminders.PollInterval, a.cfg.Reminders.BatchSize)
+	a.runWorker(func() { scheduler.Run(workerCtx) })
+
+	purger := trash.NewPurger(a.store().Trash(), a.cfg.Trash.Retention, a.cfg.Trash.PurgeInterval, a.cfg.Trash.BatchSize)
+	a.runWorker(func() { purger.Run(workerCtx) })
+
+	listener, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", a.server.Addr, err)
+	}
+	go func() {
+		log.Printf("Listening on %s", listener.Addr())
+		if err := a.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for in-flight ones, then stops
+// the background workers, closes the consumer groups and finally the
+// connections, in that order. ctx bounds how long draining may take.
+func (a *App) Shutdown(ctx context.Context) error {
+	var errs []error
+	if err := a.server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("draining HTTP requests: %w", err))
+	}
+
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.consumersMu.Lock()
+	for _, consumerGroup := range a.consumers {
+		if err := consumerGroup.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing consumer group: %w", err))
+		}
+	}
+	a.consumers = nil
+	a.stopping = true
+	a.consumersMu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("waiting for background workers: %w", ctx.Err()))
+	}
+
+	errs = append(errs, a.close())
+	return errors.Join(errs...)
+}
+
+// close releases the connections in the reverse order they were opened
+func (a *App) close() error {
+	var errs []error
+	if err := utils.CloseKafkaProducer(); err != nil {
+		errs = append(errs, fmt.Errorf("closing Kafka producer: %w", err))
+	}
+	if a.rdb != nil {
+		if err := a.rdb.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing Redis: %w", err))
+		}
+	}
+	if a.db != nil {
+		if err := a.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing database: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *App) runWorker(run func()) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		run()
+	}()
+}
+
+// addConsumer hands a consumer group to Shutdown, or closes it right away if
+// it only came up after shutdown began.
+func (a *App) addConsumer(consumerGroup sarama.ConsumerGroup) {
+	a.consumersMu.Lock()
+	defer a.consumersMu.Unlock()
+	if a.stopping {
+		consumerGroup.Close()
+		return
+	}
+	a.consumers = append(a.consumers, consumerGroup)
+}
+
+func (a *App) startTokenVerificationConsumer(startCtx, workerCtx context.Context) error {
+	for {
+		consumerGroup, err := utils.InitTokenVerificationConsumer(workerCtx, a.cfg.Kafka.ConsumerGroups.TokenVerification, a.instanceID, a.cfg.Kafka.Topics.TokenVerificationResponses)
+		if err == nil {
+			a.addConsumer(consumerGroup)
+			return nil
+		}
+		log.Printf("Failed to initialize token verification consumer: %v. Retrying in %s...", err, consumerRetryDelay)
+		select {
+		case <-startCtx.Done():
+			return fmt.Errorf("token verification consumer didn't start: %w", startCtx.Err())
+		case <-time.After(consumerRetryDelay):
+		}
+	}
+}
+
+func (a *App) consumeTokenRevocations(ctx context.Context) {
+	for {
+		consumerGroup, err := utils.InitTokenRevocationConsumer(ctx, a.cfg.Kafka.ConsumerGroups.TokenRevocation, a.cfg.Kafka.Topics.TokenRevoked, a.caching.HandleRevocation)
+		if err == nil {
+			a.addConsumer(consumerGroup)
+			return
+		}
+		log.Printf("Failed to initialize token revocation consumer: %v. Retrying in %s...", err, consumerRetryDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(consumerRetryDelay):
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// Package cache is the key/value store the handlers cache responses in.
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned by Get when the key isn't cached
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores opaque values with a time to live
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX sets the key only if it isn't set yet and reports whether it did
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, keys ...string) error
+	// Incr atomically increments a counter, creating it at 1
+	Incr(ctx context.Context, key string) (int64, error)
+	Ping(ctx context.Context) error
+}
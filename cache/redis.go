@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type redisCache struct {
+	rdb *redis.Client
+}
+
+// NewRedis returns a Cache backed by a Redis client
+func NewRedis(rdb *redis.Client) Cache {
+	return &redisCache{rdb: rdb}
+}
+
+func (r *redisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (r *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+func (r *redisCache) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return r.rdb.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (r *redisCache) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.rdb.Del(ctx, keys...).Err()
+}
+
+func (r *redisCache) Incr(ctx context.Context, key string) (int64, error) {
+	return r.rdb.Incr(ctx, key).Result()
+}
+
+func (r *redisCache) Ping(ctx context.Context) error {
+	return r.rdb.Ping(ctx).Err()
+}
@@ -2,55 +2,165 @@ package config
 
 import (
 	"context"
-	"log"
-	"os"
+	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
-	"github.com/joho/godotenv"
 )
 
-var (
-	DB  *gorm.DB
-	RDB *redis.Client
-	ctx = context.Background()
+// Config is everything the service needs to start. Load builds it; the
+// settings table in load.go lists every field with its file key, environment
+// variables and default.
+type Config struct {
+	HTTP      HTTPSettings
+	Database  DatabaseSettings
+	Redis     RedisSettings
+	Kafka     KafkaSettings
+	Auth      AuthSettings
+	Cache     CacheSettings
+	Outbox    OutboxSettings
+	Reminders ReminderSettings
+	Trash     TrashSettings
+	Workflows WorkflowSettings
+}
+
+// HTTPSettings configures the API server
+type HTTPSettings struct {
+	Port int
+	// ShutdownTimeout bounds how long in-flight requests may take to drain
+	ShutdownTimeout time.Duration
+	// RequireIfMatch makes PUT, PATCH and DELETE fail with 428 without If-Match
+	RequireIfMatch bool
+	// IdempotencyRetention is how long responses to POSTs are kept for retries with the same Idempotency-Key
+	IdempotencyRetention time.Duration
+}
+
+// Addr is the address the server listens on
+func (s HTTPSettings) Addr() string {
+	return ":" + strconv.Itoa(s.Port)
+}
+
+// DatabaseSettings locates the Postgres database
+type DatabaseSettings struct {
+	DSN string
+}
+
+// RedisSettings locates the Redis server
+type RedisSettings struct {
+	Addr     string
+	Username string
+	Password string
+}
+
+// KafkaSettings locates the Kafka cluster and names the topics and consumer groups the service uses
+type KafkaSettings struct {
+	Brokers []string
+	// InstanceID names this replica; it defaults to the host name with a
+	// random suffix and must be unique if set
+	InstanceID     string
+	Topics         KafkaTopics
+	ConsumerGroups KafkaConsumerGroups
+}
+
+type KafkaTopics struct {
+	ToDoEvents                 string
+	GroupEvents                string
+	Reminders                  string
+	TokenVerificationRequests  string
+	TokenVerificationResponses string
+	TokenRevoked               string
+}
+
+// KafkaConsumerGroups name the consumer groups. Every replica reads the token
+// verification responses in a group of its own, which TokenVerification is
+// the prefix of.
+type KafkaConsumerGroups struct {
+	TokenVerification string
+	TokenRevocation   string
+}
+
+const (
+	AuthModeKafka = "kafka"
+	AuthModeLocal = "local"
 )
 
-func init() {
-	// Load .env file
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
-	}
+// AuthSettings selects how bearer tokens are verified and how long results are cached
+type AuthSettings struct {
+	Mode      string
+	JWTSecret string
+	JWKSFile  string
+	// Issuer and Audience, when set, must match the iss and aud claims of
+	// tokens verified in local mode
+	Issuer   string
+	Audience string
+	// Timeout bounds how long to wait for the auth service in kafka mode
+	Timeout time.Duration
+	// A zero CacheTTL disables caching verification results
+	CacheTTL         time.Duration
+	NegativeCacheTTL time.Duration
+	// RevocationTTL is how long a revoked token whose expiry is unknown stays
+	// denylisted
+	RevocationTTL time.Duration
 }
 
-func Connect() {
-	var err error
-	dsn := os.Getenv("DB_DSN")
-	DB, err = gorm.Open("postgres", dsn)
-	if err != nil {
-		panic("failed to connect to database")
-	}
+// CacheSettings sets how long API responses stay in Redis
+type CacheSettings struct {
+	ItemTTL time.Duration
+	ListTTL time.Duration
+}
 
-	RDB = redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_ADDR"),
-		Username: os.Getenv("REDIS_USERNAME"),
-		Password: os.Getenv("REDIS_PASSWORD"),
-	})
+// OutboxSettings configures the relay publishing the outbox to Kafka
+type OutboxSettings struct {
+	RelayInterval time.Duration
+	BatchSize     int
+	// Retention is how long published events are kept before they are deleted
+	Retention time.Duration
+}
 
-	if err := RDB.Ping(ctx).Err(); err != nil {
-		log.Fatalf("failed to connect to redis: %v", err)
-	}
+// ReminderSettings configures the scheduler firing the reminders of todos
+type ReminderSettings struct {
+	PollInterval time.Duration
+	BatchSize    int
 }
 
-func GetDB() *gorm.DB {
-	return DB
+// TrashSettings configures how long deleted groups and todos can be restored,
+// and the purger deleting them for good after that
+type TrashSettings struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+	BatchSize     int
 }
 
-func GetRedis() *redis.Client {
-	return RDB
+// WorkflowSettings adds workflows to the built-in ones and picks the one new groups get
+type WorkflowSettings struct {
+	// File is an optional YAML file with a list of extra workflows
+	File    string
+	Default string
 }
 
-func GetContext() context.Context {
-	return ctx
+// OpenDatabase connects to Postgres
+func OpenDatabase(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// OpenRedis connects to Redis and checks the connection works
+func OpenRedis(ctx context.Context, settings RedisSettings) (*redis.Client, error) {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     settings.Addr,
+		Username: settings.Username,
+		Password: settings.Password,
+	})
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return rdb, nil
 }
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	toml "github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the environment variable pointing at the optional config file
+const ConfigFileEnv = "CONFIG_FILE"
+
+// setting is one configuration value: its dotted key in the config file, the
+// environment variables that override it (the first one set wins), its
+// default and how it is stored in Config.
+type setting struct {
+	key   string
+	env   []string
+	def   string
+	apply func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"http.port", []string{"PORT"}, "8081", intField(func(c *Config) *int { return &c.HTTP.Port })},
+	{"http.shutdown_timeout", []string{"SHUTDOWN_TIMEOUT"}, "15s", durationField(func(c *Config) *time.Duration { return &c.HTTP.ShutdownTimeout })},
+	{"http.require_if_match", []string{"REQUIRE_IF_MATCH"}, "false", boolField(func(c *Config) *bool { return &c.HTTP.RequireIfMatch })},
+	{"http.idempotency_retention", []string{"IDEMPOTENCY_RETENTION"}, "24h", durationField(func(c *Config) *time.Duration { return &c.HTTP.IdempotencyRetention })},
+
+	{"database.dsn", []string{"DB_DSN"}, "", stringField(func(c *Config) *string { return &c.Database.DSN })},
+
+	{"redis.addr", []string{"REDIS_ADDR"}, "", stringField(func(c *Config) *string { return &c.Redis.Addr })},
+	{"redis.username", []string{"REDIS_USERNAME"}, "", stringField(func(c *Config) *string { return &c.Redis.Username })},
+	{"redis.password", []string{"REDIS_PASSWORD"}, "", stringField(func(c *Config) *string { return &c.Redis.Password })},
+
+	// Kafka_URL is the variable older deployments set
+	{"kafka.brokers", []string{"KAFKA_BROKERS", "Kafka_URL"}, "", listField(func(c *Config) *[]string { return &c.Kafka.Brokers })},
+	{"kafka.instance_id", []string{"KAFKA_INSTANCE_ID"}, "", stringField(func(c *Config) *string { return &c.Kafka.InstanceID })},
+	{"kafka.topics.todo_events", []string{"KAFKA_TOPIC_TODO_EVENTS"}, "todo-events", stringField(func(c *Config) *string { return &c.Kafka.Topics.ToDoEvents })},
+	{"kafka.topics.group_events", []string{"KAFKA_TOPIC_GROUP_EVENTS"}, "group-events", stringField(func(c *Config) *string { return &c.Kafka.Topics.GroupEvents })},
+	{"kafka.topics.reminders", []string{"KAFKA_TOPIC_REMINDERS"}, "todo-reminders", stringField(func(c *Config) *string { return &c.Kafka.Topics.Reminders })},
+	{"kafka.topics.token_verification_requests", []string{"KAFKA_TOPIC_TOKEN_VERIFICATION_REQUESTS"}, "token_verification_requests", stringField(func(c *Config) *string { return &c.Kafka.Topics.TokenVerificationRequests })},
+	{"kafka.topics.token_verification_responses", []string{"KAFKA_TOPIC_TOKEN_VERIFICATION_RESPONSES"}, "token_verification_responses", stringField(func(c *Config) *string { return &c.Kafka.Topics.TokenVerificationResponses })},
+	{"kafka.topics.token_revoked", []string{"KAFKA_TOPIC_TOKEN_REVOKED"}, "token_revoked", stringField(func(c *Config) *string { return &c.Kafka.Topics.TokenRevoked })},
+	{"kafka.consumer_groups.token_verification", []string{"KAFKA_GROUP_TOKEN_VERIFICATION"}, "todo-service-consumer-group", stringField(func(c *Config) *string { return &c.Kafka.ConsumerGroups.TokenVerification })},
+	{"kafka.consumer_groups.token_revocation", []string{"KAFKA_GROUP_TOKEN_REVOCATION"}, "todo-service-revocation-group", stringField(func(c *Config) *string { return &c.Kafka.ConsumerGroups.TokenRevocation })},
+
+	{"auth.mode", []string{"AUTH_MODE"}, AuthModeKafka, stringField(func(c *Config) *string { return &c.Auth.Mode })},
+	{"auth.jwt_secret", []string{"JWT_SECRET"}, "", stringField(func(c *Config) *string { return &c.Auth.JWTSecret })},
+	{"auth.jwks_file", []string{"JWT_JWKS_FILE"}, "", stringField(func(c *Config) *string { return &c.Auth.JWKSFile })},
+	{"auth.issuer", []string{"JWT_ISSUER"}, "", stringField(func(c *Config) *string { return &c.Auth.Issuer })},
+	{"auth.audience", []string{"JWT_AUDIENCE"}, "", stringField(func(c *Config) *string { return &c.Auth.Audience })},
+	{"auth.timeout", []string{"AUTH_TIMEOUT"}, "10s", durationField(func(c *Config) *time.Duration { return &c.Auth.Timeout })},
+	{"auth.cache_ttl", []string{"TOKEN_CACHE_TTL"}, "5m", durationField(func(c *Config) *time.Duration { return &c.Auth.CacheTTL })},
+	{"auth.negative_cache_ttl", []string{"TOKEN_NEGATIVE_CACHE_TTL"}, "30s", durationField(func(c *Config) *time.Duration { return &c.Auth.NegativeCacheTTL })},
+	{"auth.revocation_ttl", []string{"TOKEN_REVOCATION_TTL"}, "24h", durationField(func(c *Config) *time.Duration { return &c.Auth.RevocationTTL })},
+
+	{"cache.item_ttl", []string{"CACHE_ITEM_TTL"}, "1h", durationField(func(c *Config) *time.Duration { return &c.Cache.ItemTTL })},
+	{"cache.list_ttl", []string{"CACHE_LIST_TTL"}, "5m", durationField(func(c *Config) *time.Duration { return &c.Cache.ListTTL })},
+
+	{"outbox.relay_interval", []string{"OUTBOX_RELAY_INTERVAL"}, "1s", durationField(func(c *Config) *time.Duration { return &c.Outbox.RelayInterval })},
+	{"outbox.batch_size", []string{"OUTBOX_BATCH_SIZE"}, "100", intField(func(c *Config) *int { return &c.Outbox.BatchSize })},
+	{"outbox.retention", []string{"OUTBOX_RETENTION"}, "168h", durationField(func(c *Config) *time.Duration { return &c.Outbox.Retention })},
+
+	{"reminders.poll_interval", []string{"REMINDER_POLL_INTERVAL"}, "5s", durationField(func(c *Config) *time.Duration { return &c.Reminders.PollInterval })},
+	{"reminders.batch_size", []string{"REMINDER_BATCH_SIZE"}, "100", intField(func(c *Config) *int { return &c.Reminders.BatchSize })},
+
+	{"trash.retention", []string{"TRASH_RETENTION"}, "720h", durationField(func(c *Config) *time.Duration { return &c.Trash.Retention })},
+	{"trash.purge_interval", []string{"TRASH_PURGE_INTERVAL"}, "1h", durationField(func(c *Config) *time.Duration { return &c.Trash.PurgeInterval })},
+	{"trash.batch_size", []string{"TRASH_BATCH_SIZE"}, "100", intField(func(c *Config) *int { return &c.Trash.BatchSize })},
+
+	{"workflows.file", []string{"WORKFLOWS_FILE"}, "", stringField(func(c *Config) *string { return &c.Workflows.File })},
+	{"workflows.default", []string{"WORKFLOW_DEFAULT"}, "basic", stringField(func(c *Config) *string { return &c.Workflows.Default })},
+}
+
+// Load builds the configuration from, in increasing precedence: the defaults,
+// the YAML or TOML file named by CONFIG_FILE, the .env file and the
+// environment. Variables already in the environment win over .env. Every
+// invalid or missing setting is reported in the returned error, not just the
+// first one.
+func Load() (Config, error) {
+	// Load .env file
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("reading .env: %w", err)
+	}
+
+	values := make(map[string]string, len(settings))
+	for _, s := range settings {
+		values[s.key] = s.def
+	}
+
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		fileValues, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		var unknown []string
+		for key, value := range fileValues {
+			if _, ok := values[key]; !ok {
+				unknown = append(unknown, key)
+				continue
+			}
+			values[key] = value
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return Config{}, fmt.Errorf("%s: unknown settings %s", path, strings.Join(unknown, ", "))
+		}
+		log.Printf("Loaded configuration from %s", path)
+	}
+
+	for _, s := range settings {
+		for _, name := range s.env {
+			if value, ok := os.LookupEnv(name); ok {
+				values[s.key] = value
+				break
+			}
+		}
+	}
+
+	var cfg Config
+	var errs []error
+	unparsed := make(map[string]bool)
+	for _, s := range settings {
+		if err := s.apply(&cfg, strings.TrimSpace(values[s.key])); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", s.key, strings.Join(s.env, " or "), err))
+			unparsed[s.key] = true
+		}
+	}
+	errs = append(errs, cfg.validate(unparsed)...)
+	if len(errs) > 0 {
+		return Config{}, fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+// validate checks the settings make sense together. Settings that failed to
+// parse were reported already and are skipped.
+func (c *Config) validate(unparsed map[string]bool) []error {
+	var errs []error
+	check := func(key string, ok bool, format string, args ...interface{}) {
+		if !ok && !unparsed[key] {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check("http.port", c.HTTP.Port > 0 && c.HTTP.Port < 65536, "http.port must be between 1 and 65535")
+	check("http.shutdown_timeout", c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout must be positive")
+	check("http.idempotency_retention", c.HTTP.IdempotencyRetention > 0, "http.idempotency_retention must be positive")
+	check("database.dsn", c.Database.DSN != "", "database.dsn (DB_DSN) is required")
+	check("redis.addr", c.Redis.Addr != "", "redis.addr (REDIS_ADDR) is required")
+
+	check("kafka.brokers", len(c.Kafka.Brokers) > 0, "kafka.brokers (KAFKA_BROKERS) is required")
+	for _, broker := range c.Kafka.Brokers {
+		_, port, err := net.SplitHostPort(broker)
+		check("kafka.brokers", err == nil && port != "", "kafka.brokers: %q is not a host:port address", broker)
+	}
+	topics := c.Kafka.Topics
+	for name, topic := range map[string]string{
+		"todo_events":                  topics.ToDoEvents,
+		"group_events":                 topics.GroupEvents,
+		"reminders":                    topics.Reminders,
+		"token_verification_requests":  topics.TokenVerificationRequests,
+		"token_verification_responses": topics.TokenVerificationResponses,
+		"token_revoked":                topics.TokenRevoked,
+	} {
+		check("kafka.topics."+name, topic != "", "kafka.topics.%s must not be empty", name)
+	}
+	check("kafka.consumer_groups.token_verification", c.Kafka.ConsumerGroups.TokenVerification != "", "kafka.consumer_groups.token_verification must not be empty")
+	check("kafka.consumer_groups.token_revocation", c.Kafka.ConsumerGroups.TokenRevocation != "", "kafka.consumer_groups.token_revocation must not be empty")
+
+	switch c.Auth.Mode {
+	case AuthModeKafka:
+	case AuthModeLocal:
+		check("auth.jwt_secret", c.Auth.JWTSecret != "" || c.Auth.JWKSFile != "", "auth.jwt_secret (JWT_SECRET) or auth.jwks_file (JWT_JWKS_FILE) is required in local auth mode")
+	default:
+		check("auth.mode", false, "auth.mode must be %s or %s, not %q", AuthModeKafka, AuthModeLocal, c.Auth.Mode)
+	}
+	check("auth.timeout", c.Auth.Timeout > 0, "auth.timeout must be positive")
+	check("auth.cache_ttl", c.Auth.CacheTTL >= 0, "auth.cache_ttl must not be negative")
+	check("auth.negative_cache_ttl", c.Auth.NegativeCacheTTL >= 0, "auth.negative_cache_ttl must not be negative")
+	check("auth.revocation_ttl", c.Auth.RevocationTTL >= 0, "auth.revocation_ttl must not be negative")
+
+	check("cache.item_ttl", c.Cache.ItemTTL > 0, "cache.item_ttl must be positive")
+	check("cache.list_ttl", c.Cache.ListTTL > 0, "cache.list_ttl must be positive")
+	check("outbox.relay_interval", c.Outbox.RelayInterval > 0, "outbox.relay_interval must be positive")
+	check("outbox.batch_size", c.Outbox.BatchSize > 0, "outbox.batch_size must be positive")
+	check("outbox.retention", c.Outbox.Retention > 0, "outbox.retention must be positive")
+	check("reminders.poll_interval", c.Reminders.PollInterval > 0, "reminders.poll_interval must be positive")
+	check("reminders.batch_size", c.Reminders.BatchSize > 0, "reminders.batch_size must be positive")
+	check("trash.retention", c.Trash.Retention > 0, "trash.retention must be positive")
+	check("trash.purge_interval", c.Trash.PurgeInterval > 0, "trash.purge_interval must be positive")
+	check("trash.batch_size", c.Trash.BatchSize > 0, "trash.batch_size must be positive")
+	check("workflows.default", c.Workflows.Default != "", "workflows.default must not be empty")
+
+	// The topic map above is iterated in random order
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// readFile reads a YAML or TOML config file, chosen by extension, into
+// dotted keys. Lists become comma-separated values like in the environment.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.NewDecoder(bytes.NewReader(data)).Decode(&tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", tree, values)
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]interface{}, values map[string]string) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(key, v, values)
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func stringField(field func(c *Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func intField(field func(c *Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func boolField(field func(c *Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func durationField(field func(c *Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 30s or 5m", value)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+// listField splits a comma-separated value, dropping empty items
+func listField(field func(c *Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}
+}
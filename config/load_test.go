@@ -0,0 +1,285 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolate runs the test in an empty directory, so no .env is picked up, with
+// every configuration variable unset. Variables Load sets from a .env file
+// are unset again afterwards.
+func isolate(t *testing.T) string {
+	t.Helper()
+	names := []string{ConfigFileEnv}
+	for _, s := range settings {
+		names = append(names, s.env...)
+	}
+	for _, name := range names {
+		// Setenv restores the variable at cleanup, even once unset below
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) string {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const requiredYAML = `
+database:
+  dsn: postgres://localhost/todo
+redis:
+  addr: localhost:6379
+kafka:
+  brokers: [localhost:9092]
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := isolate(t)
+	t.Setenv(ConfigFileEnv, writeFile(t, filepath.Join(dir, "config.yaml"), requiredYAML+`
+cache:
+  item_ttl: 2h
+  list_ttl: 1m
+outbox:
+  batch_size: 10
+reminders:
+  batch_size: 10
+`))
+	writeFile(t, filepath.Join(dir, ".env"), "CACHE_LIST_TTL=2m\nOUTBOX_BATCH_SIZE=20\nTRASH_BATCH_SIZE=20\n")
+	t.Setenv("OUTBOX_BATCH_SIZE", "30")
+	t.Setenv("TRASH_BATCH_SIZE", "30")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"default", cfg.HTTP.Port, 8081},
+		{"file over default", cfg.Cache.ItemTTL, 2 * time.Hour},
+		{".env over file", cfg.Cache.ListTTL, 2 * time.Minute},
+		{"environment over .env and file", cfg.Outbox.BatchSize, 30},
+		{"environment over .env", cfg.Trash.BatchSize, 30},
+		{"file only", cfg.Reminders.BatchSize, 10},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+http:
+  require_if_match: true
+  shutdown_timeout: 90s
+database:
+  dsn: postgres://localhost/todo
+redis:
+  addr: localhost:6379
+kafka:
+  brokers:
+    - kafka-1:9092
+    - kafka-2:9092
+auth:
+  mode: local
+  jwt_secret: secret
+`,
+		"config.yml": `
+http: {require_if_match: true, shutdown_timeout: 90s}
+database: {dsn: "postgres://localhost/todo"}
+redis: {addr: "localhost:6379"}
+kafka: {brokers: [kafka-1:9092, kafka-2:9092]}
+auth: {mode: local, jwt_secret: secret}
+`,
+		"config.toml": `
+[http]
+require_if_match = true
+shutdown_timeout = "90s"
+
+[database]
+dsn = "postgres://localhost/todo"
+
+[redis]
+addr = "localhost:6379"
+
+[kafka]
+brokers = ["kafka-1:9092", "kafka-2:9092"]
+
+[auth]
+mode = "local"
+jwt_secret = "secret"
+`,
+	}
+	var loaded []Config
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			dir := isolate(t)
+			t.Setenv(ConfigFileEnv, writeFile(t, filepath.Join(dir, name), content))
+			cfg, err := Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cfg.HTTP.RequireIfMatch || cfg.HTTP.ShutdownTimeout != 90*time.Second || cfg.Auth.Mode != AuthModeLocal ||
+				!reflect.DeepEqual(cfg.Kafka.Brokers, []string{"kafka-1:9092", "kafka-2:9092"}) {
+				t.Errorf("got %+v", cfg)
+			}
+			loaded = append(loaded, cfg)
+		})
+	}
+	for i := 1; i < len(loaded); i++ {
+		if cfg := loaded[i]; !reflect.DeepEqual(cfg, loaded[0]) {
+			t.Errorf("formats disagree:\n%+v\n%+v", cfg, loaded[0])
+		}
+	}
+}
+
+func TestLoadExampleFile(t *testing.T) {
+	example, err := filepath.Abs("../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	isolate(t)
+	t.Setenv(ConfigFileEnv, example)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Auth.RevocationTTL != 24*time.Hour || !reflect.DeepEqual(cfg.Kafka.Brokers, []string{"localhost:9092"}) {
+		t.Errorf("got %+v", cfg)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"unknown keys", "config.yaml", requiredYAML + "http: {prot: 80}\ncache: {ttl: 1m}\n", "unknown settings cache.ttl, http.prot"},
+		{"unsupported extension", "config.json", "{}", "must be .yaml, .yml or .toml"},
+		{"malformed YAML", "config.yaml", "http: [", "parsing"},
+		{"malformed TOML", "config.toml", "[http", "parsing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := isolate(t)
+			t.Setenv(ConfigFileEnv, writeFile(t, filepath.Join(dir, tt.file), tt.content))
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error about %q", err, tt.want)
+			}
+		})
+	}
+
+	isolate(t)
+	t.Setenv(ConfigFileEnv, filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "reading config file") {
+		t.Errorf("missing file: %v", err)
+	}
+}
+
+func TestLoadValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(cfg Config) bool
+	}{
+		{"brokers with spaces and empty items", map[string]string{"KAFKA_BROKERS": " kafka-1:9092, ,kafka-2:9092,"}, func(cfg Config) bool {
+			return reflect.DeepEqual(cfg.Kafka.Brokers, []string{"kafka-1:9092", "kafka-2:9092"})
+		}},
+		{"legacy broker variable", map[string]string{"Kafka_URL": "legacy:9092"}, func(cfg Config) bool {
+			return reflect.DeepEqual(cfg.Kafka.Brokers, []string{"legacy:9092"})
+		}},
+		{"new broker variable over the legacy one", map[string]string{"KAFKA_BROKERS": "kafka:9092", "Kafka_URL": "legacy:9092"}, func(cfg Config) bool {
+			return reflect.DeepEqual(cfg.Kafka.Brokers, []string{"kafka:9092"})
+		}},
+		{"durations", map[string]string{"KAFKA_BROKERS": "kafka:9092", "AUTH_TIMEOUT": "1m30s", "TOKEN_CACHE_TTL": "0", "TRASH_RETENTION": "1.5h", "OUTBOX_RETENTION": "48h"}, func(cfg Config) bool {
+			return cfg.Auth.Timeout == 90*time.Second && cfg.Auth.CacheTTL == 0 && cfg.Trash.Retention == 90*time.Minute && cfg.Outbox.Retention == 48*time.Hour
+		}},
+		{"surrounding spaces", map[string]string{"KAFKA_BROKERS": "kafka:9092", "PORT": " 9000 ", "REQUIRE_IF_MATCH": " TRUE "}, func(cfg Config) bool {
+			return cfg.HTTP.Port == 9000 && cfg.HTTP.RequireIfMatch
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolate(t)
+			t.Setenv("DB_DSN", "postgres://localhost/todo")
+			t.Setenv("REDIS_ADDR", "localhost:6379")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("got %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadCollectsEveryError(t *testing.T) {
+	isolate(t)
+	for name, value := range map[string]string{
+		"PORT":              "http",
+		"REDIS_ADDR":        "localhost:6379",
+		"KAFKA_BROKERS":     "kafka-1:9092,kafka-2",
+		"AUTH_MODE":         "local",
+		"CACHE_ITEM_TTL":    "5 minutes",
+		"REQUIRE_IF_MATCH":  "maybe",
+		"OUTBOX_BATCH_SIZE": "0",
+		"TRASH_RETENTION":   "-1h",
+	} {
+		t.Setenv(name, value)
+	}
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("invalid configuration loaded")
+	}
+	for _, want := range []string{
+		`http.port (PORT): "http" is not a whole number`,
+		`http.require_if_match (REQUIRE_IF_MATCH): "maybe" is not true or false`,
+		`cache.item_ttl (CACHE_ITEM_TTL): "5 minutes" is not a duration like 30s or 5m`,
+		"database.dsn (DB_DSN) is required",
+		`kafka.brokers: "kafka-2" is not a host:port address`,
+		"auth.jwt_secret (JWT_SECRET) or auth.jwks_file (JWT_JWKS_FILE) is required in local auth mode",
+		"outbox.batch_size must be positive",
+		"trash.retention must be positive",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error doesn't mention %q:\n%v", want, err)
+		}
+	}
+	// Settings that don't parse are reported once
+	for _, unwanted := range []string{"http.port must be", "cache.item_ttl must be", "redis.addr", "kafka-1"} {
+		if strings.Contains(err.Error(), unwanted) {
+			t.Errorf("error mentions %q:\n%v", unwanted, err)
+		}
+	}
+	if n := len(strings.Split(err.Error(), "\n")); n != 8 {
+		t.Errorf("%d errors, want 8:\n%v", n, err)
+	}
+}
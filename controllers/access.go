@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// loadGroupForRole loads a group the caller holds at least the required role in,
+// writing the error response itself when that isn't the case. Groups the caller
+// can't see at all are reported as not found.
+func (d Dependencies) loadGroupForRole(c *gin.Context, id uint, required string) (*models.Group, string, bool) {
+	return d.authorizeGroup(c, id, required, groupNotFound())
+}
+
+// loadPathGroup is loadGroupForRole for the group named by the id path parameter
+func (d Dependencies) loadPathGroup(c *gin.Context, required string) (*models.Group, string, bool) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, groupNotFound())
+		return nil, "", false
+	}
+	return d.loadGroupForRole(c, id, required)
+}
+
+// loadToDoGroup is loadGroupForRole for the group a todo lives in, so a todo in
+// a group the caller can't see is reported as a missing todo.
+func (d Dependencies) loadToDoGroup(c *gin.Context, todo *models.ToDo, required string) (*models.Group, bool) {
+	group, _, ok := d.authorizeGroup(c, todo.GroupID, required, todoNotFound())
+	return group, ok
+}
+
+// targetGroup checks the group a todo is being created in or moved to
+func (d Dependencies) targetGroup(ctx context.Context, userID int, groupID uint) (*models.Group, *apierror.Error) {
+	group, _, problem := d.groupForRole(ctx, userID, groupID, models.RoleEditor, invalidField("group_id", "does not exist"))
+	return group, problem
+}
+
+// checkGroupRole is loadGroupForRole for a group that is already loaded
+func (d Dependencies) checkGroupRole(c *gin.Context, group *models.Group, required string) (string, bool) {
+	return d.authorizeLoadedGroup(c, group, required, groupNotFound())
+}
+
+// authorizeGroup reports missing when the group doesn't exist or the caller isn't in it
+func (d Dependencies) authorizeGroup(c *gin.Context, id uint, required string, missing *apierror.Error) (*models.Group, string, bool) {
+	group, role, problem := d.groupForRole(c.Request.Context(), currentUserID(c), id, required, missing)
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return nil, "", false
+	}
+	return group, role, true
+}
+
+func (d Dependencies) authorizeLoadedGroup(c *gin.Context, group *models.Group, required string, missing *apierror.Error) (string, bool) {
+	role, problem := d.roleIn(c.Request.Context(), group, currentUserID(c), required, missing)
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return "", false
+	}
+	return role, true
+}
+
+// groupForRole is authorizeGroup for callers that report problems themselves
+func (d Dependencies) groupForRole(ctx context.Context, userID int, id uint, required string, missing *apierror.Error) (*models.Group, string, *apierror.Error) {
+	group, err := d.Groups.Get(ctx, id, false)
+	if err == repository.ErrNotFound {
+		return nil, "", missing
+	} else if err != nil {
+		return nil, "", apierror.Internal("Failed to retrieve group", err)
+	}
+	role, problem := d.roleIn(ctx, group, userID, required, missing)
+	if problem != nil {
+		return nil, "", problem
+	}
+	return group, role, nil
+}
+
+func (d Dependencies) roleIn(ctx context.Context, group *models.Group, userID int, required string, missing *apierror.Error) (string, *apierror.Error) {
+	role, err := d.Groups.Role(ctx, group, userID)
+	if err == repository.ErrNotFound {
+		return "", missing
+	} else if err != nil {
+		return "", apierror.Internal("Failed to retrieve group", err)
+	}
+	if !models.RoleAllows(role, required) {
+		return "", apierror.Forbidden("insufficient_role", "Your role in this group doesn't allow this action")
+	}
+	return role, nil
+}
+
+// invalidateToDoCaches drops the cached todos, and their parents, whose
+// progress counts them
+func (d Dependencies) invalidateToDoCaches(c *gin.Context, todos ...*models.ToDo) {
+	keys := make([]string, 0, len(todos))
+	for _, todo := range todos {
+		keys = append(keys, todoCacheKey(todo.ID))
+		if todo.ParentID != nil {
+			keys = append(keys, todoCacheKey(*todo.ParentID))
+		}
+	}
+	if err := d.Cache.Del(c.Request.Context(), keys...); err != nil {
+		log.Printf("Error dropping cached todos: %v", err)
+	}
+}
+
+// toDoRefs points at each of the todos
+func toDoRefs(todos []models.ToDo) []*models.ToDo {
+	refs := make([]*models.ToDo, len(todos))
+	for i := range todos {
+		refs[i] = &todos[i]
+	}
+	return refs
+}
+
+// invalidateGroupCaches drops the cached groups and the cached lists of everyone they are shared with
+func (d Dependencies) invalidateGroupCaches(c *gin.Context, groups ...*models.Group) {
+	keys := make([]string, 0, len(groups))
+	users := map[int]bool{}
+	for _, group := range groups {
+		keys = append(keys, groupCacheKey(group.ID))
+		users[group.OwnerID] = true
+		members, err := d.Groups.Members(c.Request.Context(), group.ID)
+		if err != nil {
+			log.Printf("Error loading the members of group %d to drop their cached lists: %v", group.ID, err)
+		}
+		for _, member := range members {
+			users[member.UserID] = true
+		}
+	}
+
+	userIDs := make([]int, 0, len(users))
+	for userID := range users {
+		userIDs = append(userIDs, userID)
+	}
+	if err := d.Cache.Del(c.Request.Context(), keys...); err != nil {
+		log.Printf("Error dropping cached groups: %v", err)
+	}
+	d.invalidateListCaches(c, userIDs...)
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/dto"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// errBatchFailed rolls back an atomic batch once one of its operations failed
+var errBatchFailed = errors.New("batch operation failed")
+
+// BatchToDos godoc
+// @Summary      Create, update, move and delete ToDos in one request
+// @Description  Apply up to 100 operations in order. Each is checked like the request it stands for: create like POST /todos, update like a merge PATCH /todos/{id}, move like POST /todos/{id}/move, delete like DELETE /todos/{id}. An atomic batch (the default) runs in one transaction and is rolled back entirely if any operation fails; an independent batch keeps every operation that succeeds. The response has one result per operation with the status it would have got on its own; operations rolled back with a failed atomic batch report 424.
+// @Tags         todos
+// @Accept       json
+// @Produce      json
+// @Param        batch             body    dto.BatchRequest   true   "Operations to apply"
+// @Param        Idempotency-Key   header  string  false  "Key that makes retries of this request return the first response instead of running again"
+// @Success      200     {object}  dto.BatchResponse   "Result of each operation"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      422     {object}  apierror.Problem   "Invalid operations"
+// @Router       /todos:batch [post]
+func (h *ToDoHandler) BatchToDos(c *gin.Context) {
+	var input dto.BatchRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+	if input.Mode == "" {
+		input.Mode = dto.BatchAtomic
+	}
+
+	batch := &toDoBatch{
+		Dependencies:  h.Dependencies,
+		ctx:           c.Request.Context(),
+		userID:        currentUserID(c),
+		editable:      map[uint]*models.Group{},
+		touchedGroups: map[uint]*models.Group{},
+	}
+	results := make([]dto.BatchResult, len(input.Operations))
+	run := func(todos repository.TodoRepository, i int) bool {
+		result, problem := batch.run(todos, &input.Operations[i])
+		if problem != nil {
+			rendered := apierror.Render(c, problem)
+			result.Status, result.Error = rendered.Status, &rendered
+		}
+		results[i] = result
+		return problem == nil
+	}
+
+	committed := true
+	if input.Mode == dto.BatchAtomic {
+		failed := -1
+		err := h.Todos.Transaction(batch.ctx, func(todos repository.TodoRepository) error {
+			for i := range input.Operations {
+				if !run(todos, i) {
+					failed = i
+					return errBatchFailed
+				}
+			}
+			return nil
+		})
+		if err != nil && failed < 0 {
+			apierror.Abort(c, apierror.Internal("Failed to apply the batch", err))
+			return
+		}
+		if failed >= 0 {
+			committed = false
+			batch.rolledBack(c, input.Operations, results, failed)
+		}
+	} else {
+		for i := range input.Operations {
+			run(h.Todos, i)
+		}
+	}
+
+	batch.invalidateCaches(c)
+	c.JSON(http.StatusOK, dto.BatchResponse{Mode: input.Mode, Committed: committed, Results: results})
+}
+
+// toDoBatch is what the operations of a batch share: who runs it, the groups
+// already checked and what to drop from the caches once it is done.
+type toDoBatch struct {
+	Dependencies
+	ctx    context.Context
+	userID int
+	// editable holds the groups the caller was found to be allowed to edit
+	editable      map[uint]*models.Group
+	touchedToDos  []*models.ToDo
+	touchedGroups map[uint]*models.Group
+}
+
+// run applies one operation with todos, returning its result or its problem
+func (b *toDoBatch) run(todos repository.TodoRepository, op *dto.BatchOperation) (dto.BatchResult, *apierror.Error) {
+	result := dto.BatchResult{Op: op.Op, ID: op.ID}
+	if op.Op == dto.BatchCreate {
+		todo, group, problem := b.createToDo(b.ctx, todos, b.userID, op.ToDo)
+		if problem != nil {
+			return result, problem
+		}
+		b.touch(todo, group)
+		return b.done(result, http.StatusCreated, todo), nil
+	}
+
+	todo, group, problem := b.loadToDo(todos, op.ID)
+	if problem != nil {
+		return result, problem
+	}
+	conditional := op.Version != 0
+	if conditional && op.Version != todo.Version {
+		return result, preconditionFailed()
+	}
+
+	if op.Op == dto.BatchDelete {
+		subtasks, err := todos.Delete(b.ctx, todo, b.userID)
+		if err != nil {
+			return result, saveError(err, conditional, "Failed to delete todo")
+		}
+		b.touch(todo, group)
+		b.touchedToDos = append(b.touchedToDos, toDoRefs(subtasks)...)
+		result.Status = http.StatusNoContent
+		return result, nil
+	}
+
+	previous := *todo
+	var target *models.Group
+	if op.Op == dto.BatchMove {
+		target, problem = b.moveToDo(b.ctx, todos, b.userID, todo, group, &op.MoveToDoRequest, conditional)
+	} else {
+		var input dto.ToDoRequest
+		if input, problem = patchToDoRequest(todo, op.Patch); problem == nil {
+			target, _, problem = b.updateToDo(b.ctx, todos, b.userID, todo, group, &input, conditional)
+		}
+	}
+	if problem != nil {
+		return result, problem
+	}
+	b.touch(todo, group, target)
+	b.touchedToDos = append(b.touchedToDos, &previous)
+	return b.done(result, http.StatusOK, todo), nil
+}
+
+// loadToDo loads a todo in a group the caller may edit
+func (b *toDoBatch) loadToDo(todos repository.TodoRepository, id uint) (*models.ToDo, *models.Group, *apierror.Error) {
+	todo, err := todos.Get(b.ctx, id)
+	if err == repository.ErrNotFound {
+		return nil, nil, todoNotFound()
+	} else if err != nil {
+		return nil, nil, apierror.Internal("Failed to retrieve todo", err)
+	}
+	if group, ok := b.editable[todo.GroupID]; ok {
+		return todo, group, nil
+	}
+	group, _, problem := b.groupForRole(b.ctx, b.userID, todo.GroupID, models.RoleEditor, todoNotFound())
+	if problem != nil {
+		return nil, nil, problem
+	}
+	b.editable[group.ID] = group
+	return todo, group, nil
+}
+
+func (b *toDoBatch) done(result dto.BatchResult, status int, todo *models.ToDo) dto.BatchResult {
+	response := dto.NewToDoResponse(todo)
+	result.ID, result.Status, result.ToDo = todo.ID, status, &response
+	return result
+}
+
+// touch notes a changed todo and the groups it was or is in
+func (b *toDoBatch) touch(todo *models.ToDo, groups ...*models.Group) {
+	b.touchedToDos = append(b.touchedToDos, todo)
+	for _, group := range groups {
+		b.touchedGroups[group.ID] = group
+	}
+}
+
+// rolledBack turns the results of an atomic batch that failed at operation
+// failed into reports of operations that weren't applied
+func (b *toDoBatch) rolledBack(c *gin.Context, ops []dto.BatchOperation, results []dto.BatchResult, failed int) {
+	b.touchedToDos = nil
+	b.touchedGroups = map[uint]*models.Group{}
+	for i := range results {
+		if i == failed {
+			continue
+		}
+		aborted := apierror.Render(c, apierror.FailedDependency("batch_aborted", fmt.Sprintf("Not applied because operation %d failed", failed)))
+		results[i] = dto.BatchResult{Op: ops[i].Op, ID: ops[i].ID, Status: aborted.Status, Error: &aborted}
+	}
+}
+
+// invalidateCaches drops everything the batch changed from the caches at once
+func (b *toDoBatch) invalidateCaches(c *gin.Context) {
+	if len(b.touchedToDos) == 0 {
+		return
+	}
+	b.invalidateToDoCaches(c, b.touchedToDos...)
+
+	groups := make([]*models.Group, 0, len(b.touchedGroups))
+	for _, group := range b.touchedGroups {
+		groups = append(groups, group)
+	}
+	b.invalidateGroupCaches(c, groups...)
+}
+
+// patchToDoRequest applies a merge patch to the request that would leave todo as it is
+func patchToDoRequest(todo *models.ToDo, patch json.RawMessage) (dto.ToDoRequest, *apierror.Error) {
+	var input dto.ToDoRequest
+	original, err := json.Marshal(dto.ToDoRequestFrom(todo))
+	if err != nil {
+		return input, apierror.Internal("Failed to encode todo", err)
+	}
+	patched, problem := mergePatch(original, patch)
+	if problem != nil {
+		return input, problem
+	}
+	return input, decodePatched(patched, &input)
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// versionETag is the strong entity tag of a todo or group at version
+func versionETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// respondVersioned writes body with the ETag of version. A GET whose
+// If-None-Match already names that version gets an empty 304 instead.
+func respondVersioned(c *gin.Context, status, version int, body interface{}) {
+	etag := versionETag(version)
+	c.Header("ETag", etag)
+	if c.Request.Method == http.MethodGet && etagListMatches(c.GetHeader("If-None-Match"), etag, false) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(status, body)
+}
+
+// checkIfMatch makes a write conditional on the resource still being at
+// version, writing the error response itself when it isn't. Without If-Match
+// the write goes ahead unless required is set.
+func checkIfMatch(c *gin.Context, version int, required bool) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if required {
+			apierror.Abort(c, apierror.PreconditionRequired("This request must send If-Match with the ETag of the resource"))
+			return false
+		}
+		return true
+	}
+	if !etagListMatches(header, versionETag(version), true) {
+		c.Header("ETag", versionETag(version))
+		apierror.Abort(c, preconditionFailed())
+		return false
+	}
+	return true
+}
+
+// writeConflict is saveError for a request conditional on If-Match
+func writeConflict(c *gin.Context, err error, detail string) *apierror.Error {
+	return saveError(err, c.GetHeader("If-Match") != "", detail)
+}
+
+// saveError reports a failed write. One that lost a race with another write is
+// a failed precondition if the client made it conditional, a conflict
+// otherwise.
+func saveError(err error, conditional bool, detail string) *apierror.Error {
+	if !errors.Is(err, repository.ErrVersionConflict) {
+		return apierror.Internal(detail, err)
+	}
+	if conditional {
+		return preconditionFailed()
+	}
+	return apierror.Conflict("edit_conflict", "The resource was changed by another request; fetch it again and retry")
+}
+
+func preconditionFailed() *apierror.Error {
+	return apierror.PreconditionFailed("precondition_failed", "The resource changed since the ETag in If-Match; fetch it again and retry")
+}
+
+// etagListMatches reports whether an If-Match or If-None-Match header names
+// etag. "*" matches anything. Strong comparison, used for If-Match, never
+// matches weak tags; weak comparison ignores the W/ prefix.
+func etagListMatches(header, etag string, strong bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if strong {
+				continue
+			}
+			tag = tag[len("W/"):]
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
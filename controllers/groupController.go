@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/cache"
+	"github.com/pmas98/go-todo-service/dto"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// GetGroups godoc
+// @Summary      Retrieve groups
+// @Description  Get a page of the groups the caller owns or is a member of, including their associated ToDos. Pages are cached in Redis per query.
+// @Tags         groups
+// @Produce      json
+// @Param        limit            query  int     false  "Page size (default 50, max 200)"
+// @Param        cursor           query  string  false  "Cursor from the previous page's next_cursor"
+// @Param        sort             query  string  false  "created_at, name or id, prefixed with - for descending (default created_at)"
+// @Param        q                query  string  false  "Case-insensitive substring of the name"
+// @Param        created_after    query  string  false  "Only groups created at or after this RFC 3339 time"
+// @Param        created_before   query  string  false  "Only groups created before this RFC 3339 time"
+// @Success      200  {object}  dto.GroupPage
+// @Failure      400  {object}  apierror.Problem
+// @Failure      500  {object}  apierror.Problem
+// @Router       /groups [get]
+func (h *GroupHandler) GetGroups(c *gin.Context) {
+	userID := currentUserID(c)
+	q, problem := parseListQuery(c, repository.GroupSortFields, "created_at")
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
+
+	cacheKey, err := h.listCacheKey(c, "groups", userID, q)
+	if err != nil {
+		apierror.Abort(c, cacheUnavailable(err))
+		return
+	}
+
+	var page dto.GroupPage
+
+	// Try to get the page from Redis cache
+	result, err := h.Cache.Get(c.Request.Context(), cacheKey)
+	if err == cache.ErrMiss {
+		// If not in cache, query the database
+		groups, err := h.Groups.List(c.Request.Context(), userID, q.repositoryQuery())
+		if errors.Is(err, repository.ErrInvalidQuery) {
+			apierror.Abort(c, invalidQuery("cursor", "is not a cursor issued for this sort"))
+			return
+		} else if err != nil {
+			apierror.Abort(c, apierror.Internal("Failed to retrieve groups", err))
+			return
+		}
+		count, next := q.nextCursor(len(groups), func(i int) (string, uint) {
+			return repository.GroupSortValue(&groups[i], q.field()), groups[i].ID
+		})
+		page = dto.GroupPage{Items: dto.NewGroupResponses(groups[:count]), NextCursor: next}
+
+		// Cache the result
+		data, err := json.Marshal(page)
+		if err != nil {
+			apierror.Abort(c, apierror.Internal("Failed to marshal groups", err))
+			return
+		}
+		// The page is good even if it can't be cached
+		if err := h.Cache.Set(c.Request.Context(), cacheKey, data, h.ListTTL); err != nil {
+			log.Printf("Error caching groups: %v", err)
+		}
+	} else if err != nil {
+		apierror.Abort(c, cacheUnavailable(err))
+		return
+	} else {
+		// If found in cache, unmarshal the data
+		if err := json.Unmarshal(result, &page); err != nil {
+			apierror.Abort(c, apierror.Internal("Failed to unmarshal groups", err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetGroup godoc
+// @Summary      Retrieve a group by ID
+// @Description  Get details of a specific group shared with the caller, including its associated ToDos. This endpoint first tries to fetch data from the Redis cache; if not available, it queries the database and caches the result. The ETag is the version of the group, which also changes with its ToDos.
+// @Tags         groups
+// @Produce      json
+// @Param        id    path      string                       true  "Group ID"
+// @Param        If-None-Match   header  string  false  "ETag from an earlier response; answered with 304 if still current"
+// @Success      200   {object}  dto.GroupResponse
+// @Header       200     {string}  ETag   "Version of the group"
+// @Success      304   "Not modified"
+// @Failure      404   {object}  apierror.Problem       "Group not found"
+// @Failure      500   {object}  apierror.Problem       "Internal Server Error"
+// @Router       /groups/{id} [get]
+func (h *GroupHandler) GetGroup(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, groupNotFound())
+		return
+	}
+
+	var group models.Group
+
+	// Try to get the group from Redis cache
+	result, err := h.Cache.Get(c.Request.Context(), groupCacheKey(id))
+
+	if err == nil {
+		// Found in cache, unmarshal and return
+		if err := json.Unmarshal(result, &group); err == nil {
+			if _, ok := h.checkGroupRole(c, &group, models.RoleViewer); ok {
+				respondVersioned(c, http.StatusOK, group.Version, dto.NewGroupResponse(&group))
+			}
+			return
+		}
+		// If unmarshaling fails, we'll fall through to querying the database
+	} else if err != cache.ErrMiss {
+		// An error occurred that wasn't just a cache miss
+		apierror.Abort(c, cacheUnavailable(err))
+		return
+	}
+
+	// Not found in cache or error occurred, query the database
+	loaded, err := h.Groups.Get(c.Request.Context(), id, true)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			apierror.Abort(c, groupNotFound())
+		} else {
+			apierror.Abort(c, apierror.Internal("Failed to retrieve group", err))
+		}
+		return
+	}
+	group = *loaded
+	if _, ok := h.checkGroupRole(c, &group, models.RoleViewer); !ok {
+		return
+	}
+
+	// Cache the group for future requests
+	groupJSON, err := json.Marshal(group)
+	if err == nil {
+		if err := h.Cache.Set(c.Request.Context(), groupCacheKey(id), groupJSON, h.ItemTTL); err != nil {
+			log.Printf("Error caching group %d: %v", id, err)
+		}
+	}
+
+	respondVersioned(c, http.StatusOK, group.Version, dto.NewGroupResponse(&group))
+}
+
+// CreateGroup godoc
+// @Summary      Create a new group
+// @Description  Create a new group with the provided JSON data. Its todos follow the named workflow, or the default one if none is given.
+// @Tags         groups
+// @Accept       json
+// @Produce      json
+// @Param        group   body   dto.CreateGroupRequest   true   "Group to be created"
+// @Param        Idempotency-Key   header  string  false  "Key that makes retries of this request return the first response instead of running again"
+// @Success      201     {object}        dto.GroupResponse   "Created group"
+// @Failure      400     {object}        apierror.Problem   "Malformed body"
+// @Failure      409     {object}        apierror.Problem   "Group with this name already exists"
+// @Failure      422     {object}        apierror.Problem   "Invalid fields"
+// @Router       /groups [post]
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	userID := currentUserID(c)
+	var input dto.CreateGroupRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+	workflowName, problem := h.pickWorkflow(input.Workflow)
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
+	group := models.Group{Name: string(input.Name), OwnerID: userID, Workflow: workflowName}
+
+	if _, err := h.Groups.FindByName(c.Request.Context(), userID, group.Name); err == nil {
+		// If group with the same name exists, return a 409 Conflict error
+		apierror.Abort(c, apierror.Conflict("group_name_taken", "Group with this name already exists"))
+		return
+	} else if err != repository.ErrNotFound {
+		// For other errors, return a 500 Internal Server Error
+		apierror.Abort(c, apierror.Internal("Database error", err))
+		return
+	}
+
+	if err := h.Groups.Create(c.Request.Context(), &group, userID); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to create group", err))
+		return
+	}
+	h.invalidateListCaches(c, userID)
+	respondVersioned(c, http.StatusCreated, group.Version, dto.NewGroupResponse(&group))
+}
+
+// UpdateGroup godoc
+// @Summary      Update a group by ID
+// @Description  Update the name and optionally the workflow of a specific group identified by its ID. The workflow can only change to one that has the statuses of all the group's todos. Requires the editor or owner role.
+// @Tags         groups
+// @Accept       json
+// @Produce      json
+// @Param        id     path    string   true   "Group ID"
+// @Param        group  body     dto.UpdateGroupRequest   true   "New name for the group"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  dto.GroupResponse   "Updated group"
+// @Header       200     {string}  ETag   "Version of the group"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "Group not found"
+// @Failure      409     {object}  apierror.Problem   "Todos are in statuses the new workflow lacks"
+// @Failure      412     {object}  apierror.Problem   "Group changed since the If-Match ETag"
+// @Failure      422     {object}  apierror.Problem   "Invalid fields"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /groups/{id} [put]
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	// Recebe o nome e, opcionalmente, o workflow
+	var input dto.UpdateGroupRequest
+
+	// Vincula o JSON do corpo da requisição à estrutura input
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+
+	// Busca o grupo existente
+	group, _, ok := h.loadPathGroup(c, models.RoleEditor)
+	if !ok || !checkIfMatch(c, group.Version, h.RequireIfMatch) {
+		return
+	}
+
+	h.saveGroup(c, group, &input)
+}
+
+// PatchGroup godoc
+// @Summary      Partially update a group by ID
+// @Description  Change the name or workflow of a group with a JSON Merge Patch (application/merge-patch+json) or a JSON Patch (application/json-patch+json) against {"name", "workflow"}. The result is validated like a PUT body. Requires the editor or owner role.
+// @Tags         groups
+// @Accept       application/merge-patch+json
+// @Accept       application/json-patch+json
+// @Produce      json
+// @Param        id      path    string   true   "Group ID"
+// @Param        patch   body    object   true   "Merge patch object or JSON Patch operations"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  dto.GroupResponse   "Updated group"
+// @Header       200     {string}  ETag   "Version of the group"
+// @Failure      400     {object}  apierror.Problem   "Malformed patch"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "Group not found"
+// @Failure      409     {object}  apierror.Problem   "Failed test operation or todos in statuses the new workflow lacks"
+// @Failure      412     {object}  apierror.Problem   "Group changed since the If-Match ETag"
+// @Failure      415     {object}  apierror.Problem   "Not a patch media type"
+// @Failure      422     {object}  apierror.Problem   "Invalid result"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Router       /groups/{id} [patch]
+func (h *GroupHandler) PatchGroup(c *gin.Context) {
+	group, _, ok := h.loadPathGroup(c, models.RoleEditor)
+	if !ok || !checkIfMatch(c, group.Version, h.RequireIfMatch) {
+		return
+	}
+	original, err := json.Marshal(dto.UpdateGroupRequestFrom(group))
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to encode group", err))
+		return
+	}
+	patched, problem := applyPatch(c, original)
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
+	var input dto.UpdateGroupRequest
+	if problem := decodePatched(patched, &input); problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
+	h.saveGroup(c, group, &input)
+}
+
+// saveGroup applies an update request to group and saves the fields it
+// changed. A missing workflow keeps the current one.
+func (h *GroupHandler) saveGroup(c *gin.Context, group *models.Group, input *dto.UpdateGroupRequest) {
+	before := dto.UpdateGroupRequestFrom(group)
+	if input.Workflow == "" {
+		input.Workflow = group.Workflow
+	}
+	changes := diffFields(before, input)
+	if len(changes) == 0 {
+		respondVersioned(c, http.StatusOK, group.Version, dto.NewGroupResponse(group))
+		return
+	}
+
+	// Troca o workflow só se as tarefas existentes couberem nele
+	if changes.Has("workflow") {
+		if _, problem := h.pickWorkflow(input.Workflow); problem != nil {
+			apierror.Abort(c, problem)
+			return
+		}
+		if !h.checkWorkflowChange(c, group, input.Workflow) {
+			return
+		}
+	}
+
+	group.Name = string(input.Name)
+	group.Workflow = input.Workflow
+	if err := h.Groups.Update(c.Request.Context(), group, changes, currentUserID(c)); err != nil {
+		apierror.Abort(c, writeConflict(c, err, "Failed to update group"))
+		return
+	}
+
+	// Invalida o cache
+	h.invalidateGroupCaches(c, group)
+
+	// Retorna o grupo atualizado
+	respondVersioned(c, http.StatusOK, group.Version, dto.NewGroupResponse(group))
+}
+
+// DeleteGroup godoc
+// @Summary      Delete a group by ID
+// @Description  Move a specific group identified by its ID to the trash, along with its ToDos. It can be restored with its ToDos and memberships until it is purged for good once the retention period is over. Requires the owner role.
+// @Tags         groups
+// @Produce      json
+// @Param        id     path    string   true   "Group ID"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  string   "Group deleted"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "Group not found"
+// @Failure      412     {object}  apierror.Problem   "Group changed since the If-Match ETag"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /groups/{id} [delete]
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	// Finding the group
+	group, _, ok := h.loadPathGroup(c, models.RoleOwner)
+	if !ok || !checkIfMatch(c, group.Version, h.RequireIfMatch) {
+		return
+	}
+
+	// Clear caches while the group still says who can see it
+	h.invalidateGroupCaches(c, group)
+
+	// The group goes to the trash together with its ToDos
+	if err := h.Groups.Delete(c.Request.Context(), group, currentUserID(c)); err != nil {
+		apierror.Abort(c, writeConflict(c, err, "Failed to delete group"))
+		return
+	}
+
+	h.invalidateToDoCaches(c, toDoRefs(group.ToDos)...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group and associated ToDos deleted"})
+}
+
+// checkWorkflowChange makes sure every todo of the group has a status that
+// exists in the workflow it is switching to.
+func (h *GroupHandler) checkWorkflowChange(c *gin.Context, group *models.Group, name string) bool {
+	w, _ := h.Workflows.Get(name)
+	loaded, err := h.Groups.Get(c.Request.Context(), group.ID, true)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve group", err))
+		return false
+	}
+
+	var missing []string
+	for _, todo := range loaded.ToDos {
+		if !w.Has(todo.Status) && !containsString(missing, todo.Status) {
+			missing = append(missing, todo.Status)
+		}
+	}
+	if len(missing) > 0 {
+		detail := fmt.Sprintf("The %s workflow has no %s status, which todos of this group are in", name, strings.Join(missing, ", "))
+		apierror.Abort(c, apierror.Conflict("workflow_incompatible", detail).With("missing_statuses", missing))
+		return false
+	}
+	return true
+}
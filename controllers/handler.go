@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/cache"
+	"github.com/pmas98/go-todo-service/repository"
+	"github.com/pmas98/go-todo-service/workflow"
+)
+
+// Dependencies are the services the handlers are built from
+type Dependencies struct {
+	Todos  repository.TodoRepository
+	Groups repository.GroupRepository
+	Tags   repository.TagRepository
+	Cache  cache.Cache
+	// Workflows are the status workflows groups can pick from
+	Workflows *workflow.Registry
+
+	// How long single groups and todos, and pages of lists, stay cached
+	ItemTTL time.Duration
+	ListTTL time.Duration
+	// RequireIfMatch refuses updates and deletes that don't send If-Match
+	RequireIfMatch bool
+	// IdempotencyTTL is how long responses to POSTs with an Idempotency-Key are kept for retries
+	IdempotencyTTL time.Duration
+}
+
+// GroupHandler serves the group endpoints
+type GroupHandler struct {
+	Dependencies
+}
+
+func NewGroupHandler(deps Dependencies) *GroupHandler {
+	return &GroupHandler{Dependencies: deps}
+}
+
+// ToDoHandler serves the todo endpoints
+type ToDoHandler struct {
+	Dependencies
+}
+
+func NewToDoHandler(deps Dependencies) *ToDoHandler {
+	return &ToDoHandler{Dependencies: deps}
+}
+
+// MemberHandler serves the group membership endpoints
+type MemberHandler struct {
+	Dependencies
+}
+
+func NewMemberHandler(deps Dependencies) *MemberHandler {
+	return &MemberHandler{Dependencies: deps}
+}
+
+// TagHandler serves the tag endpoints
+type TagHandler struct {
+	Dependencies
+}
+
+func NewTagHandler(deps Dependencies) *TagHandler {
+	return &TagHandler{Dependencies: deps}
+}
+
+// TrashHandler serves the trash listing; restoring is done by the group and
+// todo endpoints
+type TrashHandler struct {
+	Dependencies
+}
+
+func NewTrashHandler(deps Dependencies) *TrashHandler {
+	return &TrashHandler{Dependencies: deps}
+}
+
+// currentUserID returns the caller's user ID as set by the auth middleware
+func currentUserID(c *gin.Context) int {
+	return c.GetInt("userID")
+}
+
+// pathID parses a numeric ID path parameter
+func pathID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func groupCacheKey(id uint) string {
+	return "group:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func todoCacheKey(id uint) string {
+	return "todo:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// callerLocation resolves the caller's timezone from the tz query parameter or
+// the X-Timezone header, defaulting to UTC.
+func callerLocation(c *gin.Context) (*time.Location, bool) {
+	name := c.Query("tz")
+	if name == "" {
+		name = c.GetHeader("X-Timezone")
+	}
+	if name == "" {
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		apierror.Abort(c, invalidQuery("tz", "Unknown timezone "+strconv.Quote(name)))
+		return nil, false
+	}
+	return loc, true
+}
+
+// validateDueDate rejects due dates no calendar would show; a missing one is fine
+func validateDueDate(due *time.Time) *apierror.Error {
+	if due == nil {
+		return nil
+	}
+	if due.IsZero() || due.Year() < 1970 || due.Year() > 9999 {
+		return invalidField("due_date", "must be a timestamp between 1970 and 9999")
+	}
+	return nil
+}
+
+func groupNotFound() *apierror.Error {
+	return apierror.NotFound("group_not_found", "Group not found")
+}
+
+func todoNotFound() *apierror.Error {
+	return apierror.NotFound("todo_not_found", "ToDo not found")
+}
+
+// invalidField reports a single invalid field of the request body
+func invalidField(field, message string) *apierror.Error {
+	return apierror.Validation("The request has invalid fields", apierror.FieldError{Field: field, Message: message})
+}
+
+// cacheUnavailable reports a Redis failure without leaking its details to the client
+func cacheUnavailable(err error) *apierror.Error {
+	return apierror.DependencyUnavailable("cache_unavailable", "The cache is unavailable, try again later", err)
+}
@@ -0,0 +1,2023 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/cache"
+	"github.com/pmas98/go-todo-service/controllers"
+	"github.com/pmas98/go-todo-service/dto"
+	"github.com/pmas98/go-todo-service/events"
+	"github.com/pmas98/go-todo-service/middleware"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/repository"
+	"github.com/pmas98/go-todo-service/routes"
+	"github.com/pmas98/go-todo-service/workflow"
+)
+
+const (
+	alice = 1
+	bob   = 2
+	carol = 3
+)
+
+// stubVerifier accepts the tokens in its table as the mapped user IDs
+type stubVerifier map[string]int
+
+func (v stubVerifier) Verify(ctx context.Context, token string) (*models.TokenVerificationResponse, error) {
+	userID, ok := v[token]
+	return &models.TokenVerificationResponse{Valid: ok, UserID: userID}, nil
+}
+
+var tokens = map[int]string{alice: "alice", bob: "bob", carol: "carol"}
+
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	store  *repository.Memory
+}
+
+// newTestServer serves the API from memory; options adjust its dependencies
+func newTestServer(t *testing.T, options ...func(*controllers.Dependencies)) *testServer {
+	gin.SetMode(gin.TestMode)
+	store := repository.NewMemory()
+	deps := controllers.Dependencies{
+		Todos:     store.Todos(),
+		Groups:    store.Groups(),
+		Tags:      store.Tags(),
+		Cache:     cache.NewMemory(),
+		Workflows: workflow.Default(),
+		ItemTTL:   time.Hour,
+		ListTTL:   5 * time.Minute,
+
+		IdempotencyTTL: time.Hour,
+	}
+	for _, option := range options {
+		option(&deps)
+	}
+	checks := map[string]controllers.DependencyCheck{
+		"database": func(ctx context.Context) error { return nil },
+		"kafka":    func(ctx context.Context) error { return errors.New("unreachable") },
+	}
+	verifier := stubVerifier{"alice": alice, "bob": bob, "carol": carol}
+	return &testServer{t: t, router: routes.SetupRouter(verifier, deps, checks), store: store}
+}
+
+// do sends a request as the given user (0 for anonymous) and returns the recorder
+func (s *testServer) do(userID int, method, path string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.doWith(userID, method, path, body, nil)
+}
+
+// doWith is do with extra request headers
+func (s *testServer) doWith(userID int, method, path string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	all := http.Header{"Content-Type": {"application/json"}}
+	for name, values := range header {
+		all[name] = values
+	}
+	return s.request(userID, method, path, string(data), all)
+}
+
+// send is do with a raw body of the given content type
+func (s *testServer) send(userID int, method, path, contentType, body string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.request(userID, method, path, body, http.Header{"Content-Type": {contentType}})
+}
+
+func (s *testServer) request(userID int, method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header = header
+	if userID != 0 {
+		req.Header.Set("Authorization", "Bearer "+tokens[userID])
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// must sends a request that is expected to succeed with the given status and decodes the response into out
+func (s *testServer) must(userID int, method, path string, body interface{}, status int, out interface{}) {
+	s.t.Helper()
+	w := s.do(userID, method, path, body)
+	if w.Code != status {
+		s.t.Fatalf("%s %s: status %d, want %d: %s", method, path, w.Code, status, w.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s: decoding %s: %v", method, path, w.Body.String(), err)
+		}
+	}
+}
+
+func (s *testServer) createGroup(userID int, name string) dto.GroupResponse {
+	s.t.Helper()
+	var group dto.GroupResponse
+	s.must(userID, http.MethodPost, "/api/v1/groups", gin.H{"name": name}, http.StatusCreated, &group)
+	return group
+}
+
+func (s *testServer) createToDo(userID int, groupID uint, title string, due *time.Time) dto.ToDoResponse {
+	s.t.Helper()
+	var todo dto.ToDoResponse
+	body := gin.H{"title": title, "group_id": groupID}
+	if due != nil {
+		body["due_date"] = due.Format(time.RFC3339)
+	}
+	s.must(userID, http.MethodPost, "/api/v1/todos", body, http.StatusCreated, &todo)
+	return todo
+}
+
+func (s *testServer) share(ownerID int, groupID uint, userID int, role string) {
+	s.t.Helper()
+	s.must(ownerID, http.MethodPost, path("/api/v1/groups/%d/members", groupID), gin.H{"user_id": userID, "role": role}, http.StatusCreated, nil)
+}
+
+func path(format string, id uint) string {
+	return fmt.Sprintf(format, id)
+}
+
+func TestAuthentication(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"missing header", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic alice", http.StatusUnauthorized},
+		{"unknown token", "Bearer mallory", http.StatusUnauthorized},
+		{"valid token", "Bearer alice", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/groups", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	s := newTestServer(t)
+
+	var body struct {
+		Status   string            `json:"status"`
+		Services map[string]string `json:"services"`
+	}
+	s.must(alice, http.MethodGet, "/api/v1/health", nil, http.StatusServiceUnavailable, &body)
+	if body.Status != "degraded" || body.Services["database"] != "up" || body.Services["kafka"] != "down" {
+		t.Errorf("unexpected health report %+v", body)
+	}
+}
+
+func TestGroupHandlers(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Home")
+	s.createToDo(alice, group.ID, "Water plants", nil)
+
+	tests := []struct {
+		name   string
+		user   int
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"owner reads group", alice, http.MethodGet, path("/api/v1/groups/%d", group.ID), nil, http.StatusOK},
+		{"stranger can't see group", bob, http.MethodGet, path("/api/v1/groups/%d", group.ID), nil, http.StatusNotFound},
+		{"malformed id", alice, http.MethodGet, "/api/v1/groups/abc", nil, http.StatusNotFound},
+		{"missing group", alice, http.MethodGet, "/api/v1/groups/999", nil, http.StatusNotFound},
+		{"duplicate name", alice, http.MethodPost, "/api/v1/groups", gin.H{"name": "Home"}, http.StatusConflict},
+		{"same name for another user", bob, http.MethodPost, "/api/v1/groups", gin.H{"name": "Home"}, http.StatusCreated},
+		{"rename without name", alice, http.MethodPut, path("/api/v1/groups/%d", group.ID), gin.H{}, http.StatusUnprocessableEntity},
+		{"stranger can't rename", bob, http.MethodPut, path("/api/v1/groups/%d", group.ID), gin.H{"name": "Mine"}, http.StatusNotFound},
+		{"owner renames", alice, http.MethodPut, path("/api/v1/groups/%d", group.ID), gin.H{"name": "House"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(tt.user, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	// The rename must not be hidden by the cached copy of the group
+	var renamed dto.GroupResponse
+	s.must(alice, http.MethodGet, path("/api/v1/groups/%d", group.ID), nil, http.StatusOK, &renamed)
+	if renamed.Name != "House" || len(renamed.ToDos) != 1 {
+		t.Errorf("got group %+v, want renamed group with one todo", renamed)
+	}
+
+	s.must(alice, http.MethodDelete, path("/api/v1/groups/%d", group.ID), nil, http.StatusOK, nil)
+	s.must(alice, http.MethodGet, path("/api/v1/groups/%d", group.ID), nil, http.StatusNotFound, nil)
+
+	var types []string
+	for _, event := range s.store.Events() {
+		types = append(types, event.EventType)
+	}
+	want := []string{events.GroupCreated, events.ToDoCreated, events.GroupCreated, events.GroupUpdated, events.ToDoDeleted, events.GroupDeleted}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("recorded events %v, want %v", types, want)
+	}
+}
+
+func TestToDoHandlers(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Work")
+	other := s.createGroup(bob, "Private")
+	todo := s.createToDo(alice, group.ID, "Write report", nil)
+
+	tests := []struct {
+		name   string
+		user   int
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"owner reads todo", alice, http.MethodGet, path("/api/v1/todos/%d", todo.ID), nil, http.StatusOK},
+		{"stranger can't see todo", bob, http.MethodGet, path("/api/v1/todos/%d", todo.ID), nil, http.StatusNotFound},
+		{"missing todo", alice, http.MethodGet, "/api/v1/todos/999", nil, http.StatusNotFound},
+		{"create in unknown group", alice, http.MethodPost, "/api/v1/todos", gin.H{"title": "x", "group_id": 999}, http.StatusUnprocessableEntity},
+		{"create in someone else's group", alice, http.MethodPost, "/api/v1/todos", gin.H{"title": "x", "group_id": other.ID}, http.StatusUnprocessableEntity},
+		{"create with invalid due date", alice, http.MethodPost, "/api/v1/todos", gin.H{"title": "x", "group_id": group.ID, "due_date": "0001-01-01T00:00:00Z"}, http.StatusUnprocessableEntity},
+		{"stranger can't update", bob, http.MethodPut, path("/api/v1/todos/%d", todo.ID), gin.H{"title": "Mine", "group_id": group.ID}, http.StatusNotFound},
+		{"move to someone else's group", alice, http.MethodPut, path("/api/v1/todos/%d", todo.ID), gin.H{"title": "x", "group_id": other.ID}, http.StatusUnprocessableEntity},
+		{"owner updates", alice, http.MethodPut, path("/api/v1/todos/%d", todo.ID), gin.H{"title": "Write summary", "status": "done", "group_id": group.ID}, http.StatusOK},
+		{"stranger can't delete", bob, http.MethodDelete, path("/api/v1/todos/%d", todo.ID), nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(tt.user, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	var updated dto.ToDoResponse
+	s.must(alice, http.MethodGet, path("/api/v1/todos/%d", todo.ID), nil, http.StatusOK, &updated)
+	if updated.Title != "Write summary" || updated.Status != models.StatusDone || updated.OwnerID != alice {
+		t.Errorf("got todo %+v after update", updated)
+	}
+
+	s.must(alice, http.MethodDelete, path("/api/v1/todos/%d", todo.ID), nil, http.StatusOK, nil)
+	s.must(alice, http.MethodGet, path("/api/v1/todos/%d", todo.ID), nil, http.StatusNotFound, nil)
+}
+
+func TestMemberRoles(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Family")
+	todo := s.createToDo(alice, group.ID, "Buy milk", nil)
+	s.share(alice, group.ID, bob, models.RoleEditor)
+	s.share(alice, group.ID, carol, models.RoleViewer)
+
+	tests := []struct {
+		name   string
+		user   int
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"viewer reads group", carol, http.MethodGet, path("/api/v1/groups/%d", group.ID), nil, http.StatusOK},
+		{"viewer reads todo", carol, http.MethodGet, path("/api/v1/todos/%d", todo.ID), nil, http.StatusOK},
+		{"viewer can't create todo", carol, http.MethodPost, "/api/v1/todos", gin.H{"title": "x", "group_id": group.ID}, http.StatusForbidden},
+		{"viewer can't update todo", carol, http.MethodPut, path("/api/v1/todos/%d", todo.ID), gin.H{"title": "x", "group_id": group.ID}, http.StatusForbidden},
+		{"viewer can't rename group", carol, http.MethodPut, path("/api/v1/groups/%d", group.ID), gin.H{"name": "x"}, http.StatusForbidden},
+		{"editor creates todo", bob, http.MethodPost, "/api/v1/todos", gin.H{"title": "Bake bread", "group_id": group.ID}, http.StatusCreated},
+		{"editor renames group", bob, http.MethodPut, path("/api/v1/groups/%d", group.ID), gin.H{"name": "Household"}, http.StatusOK},
+		{"editor can't delete group", bob, http.MethodDelete, path("/api/v1/groups/%d", group.ID), nil, http.StatusForbidden},
+		{"editor can't add members", bob, http.MethodPost, path("/api/v1/groups/%d/members", group.ID), gin.H{"user_id": 4, "role": "viewer"}, http.StatusForbidden},
+		{"duplicate member", alice, http.MethodPost, path("/api/v1/groups/%d/members", group.ID), gin.H{"user_id": bob, "role": "viewer"}, http.StatusConflict},
+		{"owner as member", alice, http.MethodPost, path("/api/v1/groups/%d/members", group.ID), gin.H{"user_id": alice, "role": "viewer"}, http.StatusConflict},
+		{"invalid role", alice, http.MethodPost, path("/api/v1/groups/%d/members", group.ID), gin.H{"user_id": 4, "role": "admin"}, http.StatusUnprocessableEntity},
+		{"creator can't be demoted", alice, http.MethodPut, path("/api/v1/groups/%d/members/1", group.ID), gin.H{"role": "viewer"}, http.StatusForbidden},
+		{"unknown member", alice, http.MethodPut, path("/api/v1/groups/%d/members/9", group.ID), gin.H{"role": "viewer"}, http.StatusNotFound},
+		{"viewer can't remove others", carol, http.MethodDelete, path("/api/v1/groups/%d/members/2", group.ID), nil, http.StatusForbidden},
+		{"owner promotes viewer", alice, http.MethodPut, path("/api/v1/groups/%d/members/3", group.ID), gin.H{"role": "editor"}, http.StatusOK},
+		{"promoted member edits todo", carol, http.MethodPut, path("/api/v1/todos/%d", todo.ID), gin.H{"title": "Buy oat milk", "group_id": group.ID}, http.StatusOK},
+		{"member leaves", bob, http.MethodDelete, path("/api/v1/groups/%d/members/2", group.ID), nil, http.StatusOK},
+		{"former member loses access", bob, http.MethodGet, path("/api/v1/groups/%d", group.ID), nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(tt.user, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	var members []models.GroupMember
+	s.must(carol, http.MethodGet, path("/api/v1/groups/%d/members", group.ID), nil, http.StatusOK, &members)
+	if len(members) != 2 || members[0].UserID != alice || members[0].Role != models.RoleOwner || members[1].UserID != carol {
+		t.Errorf("got members %+v, want owner then carol", members)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Errands")
+	for _, title := range []string{"e", "a", "d", "b", "c"} {
+		s.createToDo(alice, group.ID, title, nil)
+	}
+	s.createGroup(bob, "Hidden")
+
+	var titles []string
+	next := "/api/v1/todos?sort=title&limit=2"
+	for pages := 0; next != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination didn't terminate")
+		}
+		var page dto.ToDoPage
+		s.must(alice, http.MethodGet, next, nil, http.StatusOK, &page)
+		for _, todo := range page.Items {
+			titles = append(titles, todo.Title)
+		}
+		next = ""
+		if page.NextCursor != "" {
+			next = "/api/v1/todos?sort=title&limit=2&cursor=" + page.NextCursor
+		}
+	}
+	if got := strings.Join(titles, ""); got != "abcde" {
+		t.Errorf("paged titles %q, want %q", got, "abcde")
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		count  int
+	}{
+		{"filter by status", "/api/v1/todos?status=done", http.StatusOK, 0},
+		{"search title", "/api/v1/todos?q=C", http.StatusOK, 1},
+		{"descending", "/api/v1/todos?sort=-title&limit=1", http.StatusOK, 1},
+		{"unknown sort", "/api/v1/todos?sort=owner", http.StatusBadRequest, 0},
+		{"limit too large", "/api/v1/todos?limit=1000", http.StatusBadRequest, 0},
+		{"cursor from another sort", "/api/v1/todos?sort=id&cursor=eyJzIjoidGl0bGUiLCJ2IjoiYiIsImlkIjoyfQ", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(alice, http.MethodGet, tt.path, nil)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var page dto.ToDoPage
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Items) != tt.count {
+				t.Errorf("got %d todos, want %d", len(page.Items), tt.count)
+			}
+		})
+	}
+
+	// Bob only sees his own group, and a new group shows up despite the cached list
+	var groups dto.GroupPage
+	s.must(bob, http.MethodGet, "/api/v1/groups", nil, http.StatusOK, &groups)
+	s.createGroup(bob, "Another")
+	s.must(bob, http.MethodGet, "/api/v1/groups", nil, http.StatusOK, &groups)
+	if len(groups.Items) != 2 {
+		t.Errorf("bob sees %d groups, want 2", len(groups.Items))
+	}
+}
+
+func TestDueDateQueries(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Deadlines")
+
+	now := time.Now().UTC()
+	yesterday := now.Add(-24 * time.Hour)
+	soon := now.Add(time.Hour)
+	later := now.AddDate(0, 0, 30)
+	s.createToDo(alice, group.ID, "overdue", &yesterday)
+	s.createToDo(alice, group.ID, "soon", &soon)
+	s.createToDo(alice, group.ID, "later", &later)
+	s.createToDo(alice, group.ID, "undated", nil)
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		titles string
+	}{
+		{"overdue", "/api/v1/todos/overdue", http.StatusOK, "overdue"},
+		{"upcoming week", "/api/v1/todos/upcoming", http.StatusOK, "soon"},
+		{"upcoming month", "/api/v1/todos/upcoming?days=31", http.StatusOK, "soon,later"},
+		{"by date", "/api/v1/todos/date/" + later.Format("2006-01-02"), http.StatusOK, "later"},
+		{"bad days", "/api/v1/todos/upcoming?days=400", http.StatusBadRequest, ""},
+		{"bad date", "/api/v1/todos/date/tomorrow", http.StatusBadRequest, ""},
+		{"bad timezone", "/api/v1/todos/upcoming?tz=Mars/Olympus", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(alice, http.MethodGet, tt.path, nil)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var todos []models.ToDo
+			if err := json.Unmarshal(w.Body.Bytes(), &todos); err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for _, todo := range todos {
+				titles = append(titles, todo.Title)
+			}
+			if got := strings.Join(titles, ","); got != tt.titles {
+				t.Errorf("got %q, want %q", got, tt.titles)
+			}
+		})
+	}
+
+	// Due dates are private to the group's members too
+	var todos []models.ToDo
+	s.must(bob, http.MethodGet, "/api/v1/todos/overdue", nil, http.StatusOK, &todos)
+	if len(todos) != 0 {
+		t.Errorf("bob sees %d overdue todos, want 0", len(todos))
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Home")
+
+	tests := []struct {
+		name   string
+		userID int
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+		field  string
+	}{
+		{"missing token", 0, http.MethodGet, "/api/v1/groups", nil, http.StatusUnauthorized, "missing_token", ""},
+		{"unknown group", alice, http.MethodGet, "/api/v1/groups/999", nil, http.StatusNotFound, "group_not_found", ""},
+		{"hidden group", bob, http.MethodGet, path("/api/v1/groups/%d", group.ID), nil, http.StatusNotFound, "group_not_found", ""},
+		{"duplicate name", alice, http.MethodPost, "/api/v1/groups", gin.H{"name": "Home"}, http.StatusConflict, "group_name_taken", ""},
+		{"wrong type", alice, http.MethodPost, "/api/v1/groups", gin.H{"name": 5}, http.StatusBadRequest, "malformed_body", "name"},
+		{"bad limit", alice, http.MethodGet, "/api/v1/todos?limit=0", nil, http.StatusBadRequest, "invalid_parameters", "limit"},
+		{"bad role", alice, http.MethodPost, path("/api/v1/groups/%d/members", group.ID), gin.H{"user_id": bob, "role": "admin"}, http.StatusUnprocessableEntity, "validation_failed", "role"},
+		{"unknown route", alice, http.MethodGet, "/api/v1/nothing", nil, http.StatusNotFound, "route_not_found", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(tt.userID, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != apierror.ContentType {
+				t.Errorf("Content-Type %q, want %q", got, apierror.ContentType)
+			}
+			var problem apierror.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Status != tt.status || problem.Code != tt.code {
+				t.Errorf("got status %d code %q, want %d %q", problem.Status, problem.Code, tt.status, tt.code)
+			}
+			if problem.RequestID == "" || problem.RequestID != w.Header().Get(middleware.RequestIDHeader) {
+				t.Errorf("request_id %q doesn't match the %s header", problem.RequestID, middleware.RequestIDHeader)
+			}
+			if tt.field != "" && (len(problem.Errors) != 1 || problem.Errors[0].Field != tt.field) {
+				t.Errorf("field errors %+v, want one for %q", problem.Errors, tt.field)
+			}
+		})
+	}
+
+	// A request ID sent by the client is echoed back
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/groups/999", nil)
+	req.Header.Set("Authorization", "Bearer alice")
+	req.Header.Set(middleware.RequestIDHeader, "trace-123")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"request_id":"trace-123"`) {
+		t.Errorf("client request ID not echoed: %s", w.Body.String())
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "  Trip  ")
+	if group.Name != "Trip" {
+		t.Errorf("group name %q, want it trimmed to %q", group.Name, "Trip")
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		field  string
+	}{
+		{"blank group name", http.MethodPost, "/api/v1/groups", gin.H{"name": "   "}, "name"},
+		{"long group name", http.MethodPost, "/api/v1/groups", gin.H{"name": strings.Repeat("g", 101)}, "name"},
+		{"blank title", http.MethodPost, "/api/v1/todos", gin.H{"title": " ", "group_id": group.ID}, "title"},
+		{"long title", http.MethodPost, "/api/v1/todos", gin.H{"title": strings.Repeat("t", 201), "group_id": group.ID}, "title"},
+		{"unknown status", http.MethodPost, "/api/v1/todos", gin.H{"title": "Pack", "status": "archived", "group_id": group.ID}, "status"},
+		{"missing group", http.MethodPost, "/api/v1/todos", gin.H{"title": "Pack"}, "group_id"},
+		{"unknown group", http.MethodPost, "/api/v1/todos", gin.H{"title": "Pack", "group_id": 999}, "group_id"},
+		{"bad member id", http.MethodPost, path("/api/v1/groups/%d/members", group.ID), gin.H{"user_id": -1, "role": "viewer"}, "user_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(alice, tt.method, tt.path, tt.body)
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body.String())
+			}
+			var problem apierror.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if len(problem.Errors) != 1 || problem.Errors[0].Field != tt.field {
+				t.Errorf("field errors %+v, want one for %q", problem.Errors, tt.field)
+			}
+		})
+	}
+
+	// Server-managed fields in the body are ignored and the status defaults to pending
+	var todo dto.ToDoResponse
+	body := gin.H{"id": 77, "owner_id": bob, "created_at": "2000-01-01T00:00:00Z", "title": " Pack ", "group_id": group.ID}
+	s.must(alice, http.MethodPost, "/api/v1/todos", body, http.StatusCreated, &todo)
+	if todo.ID == 77 || todo.OwnerID != alice || todo.CreatedAt.Year() == 2000 || todo.Title != "Pack" || todo.Status != models.StatusPending {
+		t.Errorf("got todo %+v", todo)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/groups", strings.NewReader(`{"name":`))
+	req.Header.Set("Authorization", "Bearer alice")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":"malformed_body"`) {
+		t.Errorf("truncated body: status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWorkflows(t *testing.T) {
+	s := newTestServer(t)
+	var group dto.GroupResponse
+	s.must(alice, http.MethodPost, "/api/v1/groups", gin.H{"name": "Sprint", "workflow": workflow.Kanban}, http.StatusCreated, &group)
+	s.share(alice, group.ID, carol, models.RoleViewer)
+	todo := s.createToDo(alice, group.ID, "Ship it", nil)
+	blocked := s.createToDo(alice, group.ID, "Wait for review", nil)
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", blocked.ID), gin.H{"to": "in_progress"}, http.StatusCreated, nil)
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", blocked.ID), gin.H{"to": "blocked"}, http.StatusCreated, nil)
+
+	tests := []struct {
+		name   string
+		user   int
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"unknown workflow", alice, http.MethodPost, "/api/v1/groups", gin.H{"name": "Other", "workflow": "scrum"}, http.StatusUnprocessableEntity},
+		{"status outside the workflow", alice, http.MethodPost, "/api/v1/todos", gin.H{"title": "x", "status": "pending", "group_id": group.ID}, http.StatusUnprocessableEntity},
+		{"skipping a step on update", alice, http.MethodPut, path("/api/v1/todos/%d", todo.ID), gin.H{"title": "Ship it", "status": "done", "group_id": group.ID}, http.StatusConflict},
+		{"skipping a step", alice, http.MethodPost, path("/api/v1/todos/%d/transitions", todo.ID), gin.H{"to": "done"}, http.StatusConflict},
+		{"staying put", alice, http.MethodPost, path("/api/v1/todos/%d/transitions", todo.ID), gin.H{"to": "todo"}, http.StatusConflict},
+		{"unknown status", alice, http.MethodPost, path("/api/v1/todos/%d/transitions", todo.ID), gin.H{"to": "pending"}, http.StatusUnprocessableEntity},
+		{"viewer can't transition", carol, http.MethodPost, path("/api/v1/todos/%d/transitions", todo.ID), gin.H{"to": "in_progress"}, http.StatusForbidden},
+		{"stranger can't see history", bob, http.MethodGet, path("/api/v1/todos/%d/transitions", todo.ID), nil, http.StatusNotFound},
+		{"workflow lacking blocked", alice, http.MethodPut, path("/api/v1/groups/%d", group.ID), gin.H{"name": "Sprint", "workflow": workflow.Basic}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(tt.user, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	// A refused transition lists where the todo can go instead
+	w := s.do(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", todo.ID), gin.H{"to": "done"})
+	var problem struct {
+		Code    string   `json:"code"`
+		Allowed []string `json:"allowed_transitions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Code != "invalid_transition" || strings.Join(problem.Allowed, ",") != "in_progress,cancelled" {
+		t.Errorf("got problem %+v", problem)
+	}
+
+	var transition dto.TransitionResponse
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", todo.ID), gin.H{"to": "in_progress"}, http.StatusCreated, &transition)
+	if transition.FromStatus != "todo" || transition.ToStatus != "in_progress" || transition.ActorID != alice || transition.ToDo == nil || transition.ToDo.StatusChangedBy != alice {
+		t.Errorf("got transition %+v", transition)
+	}
+	s.must(alice, http.MethodPut, path("/api/v1/todos/%d", todo.ID), gin.H{"title": "Ship it", "status": "done", "group_id": group.ID}, http.StatusOK, nil)
+
+	var history []dto.TransitionResponse
+	s.must(carol, http.MethodGet, path("/api/v1/todos/%d/transitions", todo.ID), nil, http.StatusOK, &history)
+	if len(history) != 2 || history[0].ToStatus != "in_progress" || history[1].FromStatus != "in_progress" || history[1].ToStatus != "done" {
+		t.Errorf("got history %+v", history)
+	}
+
+	var changes int
+	for _, event := range s.store.Events() {
+		if event.EventType == events.ToDoStatusChanged {
+			changes++
+		}
+	}
+	if changes != 4 {
+		t.Errorf("recorded %d status changes, want 4", changes)
+	}
+
+	var workflows []dto.WorkflowResponse
+	s.must(alice, http.MethodGet, "/api/v1/workflows", nil, http.StatusOK, &workflows)
+	if len(workflows) != 2 || workflows[0].Name != workflow.Basic || !workflows[0].Default {
+		t.Errorf("got workflows %+v", workflows)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Home")
+	other := s.createGroup(alice, "Work")
+	due := time.Date(2030, 1, 2, 15, 0, 0, 0, time.UTC)
+	todo := s.createToDo(alice, group.ID, "Water plants", &due)
+	url := path("/api/v1/todos/%d", todo.ID)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"plain JSON", "application/json", `{"title": "x"}`, http.StatusUnsupportedMediaType},
+		{"merge patch that isn't an object", controllers.MergePatchContentType, `["title"]`, http.StatusBadRequest},
+		{"read-only field", controllers.MergePatchContentType, `{"id": 7}`, http.StatusUnprocessableEntity},
+		{"removing a required field", controllers.MergePatchContentType, `{"title": null}`, http.StatusUnprocessableEntity},
+		{"skipping the workflow", controllers.MergePatchContentType, `{"status": "bogus"}`, http.StatusUnprocessableEntity},
+		{"failed test operation", controllers.JSONPatchContentType, `[{"op": "test", "path": "/title", "value": "Feed cat"}]`, http.StatusConflict},
+		{"unknown path", controllers.JSONPatchContentType, `[{"op": "replace", "path": "/owner", "value": 1}]`, http.StatusUnprocessableEntity},
+		{"malformed operations", controllers.JSONPatchContentType, `{"op": "replace"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.send(alice, http.MethodPatch, url, tt.contentType, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if accept := w.Header().Get("Accept-Patch"); !strings.Contains(accept, controllers.MergePatchContentType) {
+				t.Errorf("Accept-Patch %q", accept)
+			}
+		})
+	}
+	if w := s.send(carol, http.MethodPatch, url, controllers.MergePatchContentType, `{"title": "x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("stranger patching: status %d, want 404", w.Code)
+	}
+
+	decode := func(w *httptest.ResponseRecorder) dto.ToDoResponse {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		var out dto.ToDoResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	updates := func() []events.Envelope {
+		var envelopes []events.Envelope
+		for _, event := range s.store.Events() {
+			if event.EventType != events.ToDoUpdated {
+				continue
+			}
+			var envelope events.Envelope
+			if err := json.Unmarshal([]byte(event.Payload), &envelope); err != nil {
+				t.Fatal(err)
+			}
+			envelopes = append(envelopes, envelope)
+		}
+		return envelopes
+	}
+
+	// A merge patch only touches the fields it names
+	patched := decode(s.send(alice, http.MethodPatch, url, controllers.MergePatchContentType, `{"status": "in_progress"}`))
+	if patched.Status != "in_progress" || patched.Title != "Water plants" || patched.DueDate == nil {
+		t.Errorf("got %+v", patched)
+	}
+	patched = decode(s.send(alice, http.MethodPatch, url, controllers.MergePatchContentType, `{"due_date": null}`))
+	if patched.DueDate != nil {
+		t.Errorf("due date not cleared: %+v", patched)
+	}
+
+	// A JSON Patch can guard its changes with test operations
+	patched = decode(s.send(alice, http.MethodPatch, url, controllers.JSONPatchContentType, fmt.Sprintf(
+		`[{"op": "test", "path": "/title", "value": "Water plants"}, {"op": "replace", "path": "/title", "value": "Water the plants"}, {"op": "replace", "path": "/group_id", "value": %d}]`, other.ID)))
+	if patched.Title != "Water the plants" || patched.GroupID != other.ID {
+		t.Errorf("got %+v", patched)
+	}
+
+	// Patches that change nothing don't record anything
+	before := len(updates())
+	decode(s.send(alice, http.MethodPatch, url, controllers.MergePatchContentType, `{"title": "Water the plants"}`))
+	decode(s.do(alice, http.MethodPut, url, gin.H{"title": "Water the plants", "group_id": other.ID}))
+	envelopes := updates()
+	if len(envelopes) != before {
+		t.Fatalf("no-op updates recorded %d events", len(envelopes)-before)
+	}
+
+	last := envelopes[len(envelopes)-1]
+	if got := strings.Join(last.Changes.Fields(), ","); got != "group_id,title" {
+		t.Errorf("changed fields %s, want group_id,title", got)
+	}
+	if change := last.Changes["title"]; change.From != "Water plants" || change.To != "Water the plants" {
+		t.Errorf("title change %+v", change)
+	}
+
+	// Groups take the same patches
+	var renamed dto.GroupResponse
+	w := s.send(alice, http.MethodPatch, path("/api/v1/groups/%d", group.ID), controllers.MergePatchContentType, `{"name": "  House  "}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &renamed); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if renamed.Name != "House" || renamed.Workflow != workflow.Basic {
+		t.Errorf("got %+v", renamed)
+	}
+	if w := s.send(alice, http.MethodPatch, path("/api/v1/groups/%d", group.ID), controllers.JSONPatchContentType, `[{"op": "replace", "path": "/workflow", "value": "scrum"}]`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown workflow: status %d, want 422", w.Code)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Home")
+	todo := s.createToDo(alice, group.ID, "Water plants", nil)
+	url := path("/api/v1/todos/%d", todo.ID)
+	groupURL := path("/api/v1/groups/%d", group.ID)
+	ifMatch := func(etag string) http.Header { return http.Header{"If-Match": {etag}} }
+	ifNoneMatch := func(etag string) http.Header { return http.Header{"If-None-Match": {etag}} }
+
+	// The first GET fills the cache and the second is served from it
+	var etag string
+	for _, source := range []string{"database", "cache"} {
+		w := s.do(alice, http.MethodGet, url, nil)
+		etag = w.Header().Get("ETag")
+		if w.Code != http.StatusOK || etag != `"1"` {
+			t.Fatalf("%s: status %d, ETag %s", source, w.Code, etag)
+		}
+		if w := s.doWith(alice, http.MethodGet, url, nil, ifNoneMatch(`"7", W/`+etag)); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("%s: If-None-Match got status %d: %s", source, w.Code, w.Body.String())
+		}
+	}
+	groupETag := s.do(alice, http.MethodGet, groupURL, nil).Header().Get("ETag")
+	if w := s.doWith(alice, http.MethodGet, groupURL, nil, ifNoneMatch(groupETag)); w.Code != http.StatusNotModified {
+		t.Errorf("cached group: If-None-Match got status %d", w.Code)
+	}
+
+	body := gin.H{"title": "Water the plants", "group_id": group.ID}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		status int
+	}{
+		{"stale todo", http.MethodPut, url, ifMatch(`"0"`), http.StatusPreconditionFailed},
+		{"weak tag", http.MethodPut, url, ifMatch("W/" + etag), http.StatusPreconditionFailed},
+		{"stale delete", http.MethodDelete, url, ifMatch(`"0"`), http.StatusPreconditionFailed},
+		{"stale group", http.MethodDelete, groupURL, ifMatch(`"0"`), http.StatusPreconditionFailed},
+		{"stranger", http.MethodPut, url, ifMatch(`"0"`), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := alice
+			if tt.name == "stranger" {
+				user = bob
+			}
+			w := s.doWith(user, tt.method, tt.path, body, tt.header)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	// A write with the current ETag moves the version and the ETag on
+	w := s.doWith(alice, http.MethodPut, url, body, ifMatch(etag))
+	var updated dto.ToDoResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if updated.Version != 2 || w.Header().Get("ETag") != `"2"` {
+		t.Errorf("version %d, ETag %s", updated.Version, w.Header().Get("ETag"))
+	}
+	if w := s.doWith(alice, http.MethodGet, url, nil, ifNoneMatch(etag)); w.Code != http.StatusOK {
+		t.Errorf("old ETag after the update: status %d", w.Code)
+	}
+	if w := s.doWith(alice, http.MethodPut, url, body, ifMatch(etag)); w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != `"2"` {
+		t.Errorf("second write with the old ETag: status %d, ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	// The group's todos are part of it, so its ETag moved too
+	if w := s.doWith(alice, http.MethodGet, groupURL, nil, ifNoneMatch(groupETag)); w.Code != http.StatusOK {
+		t.Errorf("group after a todo changed: status %d", w.Code)
+	}
+	if w := s.doWith(alice, http.MethodPatch, groupURL, nil, ifMatch(groupETag)); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("renaming with a stale group ETag: status %d", w.Code)
+	}
+
+	// A write racing past the If-Match check still can't overwrite a newer version
+	stale, err := s.store.Todos().Get(context.Background(), todo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", todo.ID), gin.H{"to": "in_progress"}, http.StatusCreated, nil)
+	if err := s.store.Todos().Update(context.Background(), stale, models.ChangeSet{"title": {}}, alice); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Errorf("stale update: got %v", err)
+	}
+	if _, err := s.store.Todos().Delete(context.Background(), stale, alice); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Errorf("stale delete: got %v", err)
+	}
+
+	s.must(alice, http.MethodGet, url, nil, http.StatusOK, &updated)
+	if w := s.doWith(alice, http.MethodDelete, url, nil, ifMatch(fmt.Sprintf(`"%d"`, updated.Version))); w.Code != http.StatusOK {
+		t.Errorf("delete with the current ETag: status %d: %s", w.Code, w.Body.String())
+	}
+
+	strict := newTestServer(t, func(deps *controllers.Dependencies) { deps.RequireIfMatch = true })
+	todo = strict.createToDo(alice, strict.createGroup(alice, "Home").ID, "Water plants", nil)
+	if w := strict.do(alice, http.MethodDelete, path("/api/v1/todos/%d", todo.ID), nil); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("delete without If-Match when required: status %d", w.Code)
+	}
+	if w := strict.doWith(alice, http.MethodDelete, path("/api/v1/todos/%d", todo.ID), nil, ifMatch("*")); w.Code != http.StatusOK {
+		t.Errorf("delete with If-Match * when required: status %d", w.Code)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Home")
+	s.share(alice, group.ID, bob, models.RoleEditor)
+	key := func(k string) http.Header { return http.Header{middleware.IdempotencyKeyHeader: {k}} }
+	body := gin.H{"title": "Water plants", "group_id": group.ID}
+
+	first := s.doWith(alice, http.MethodPost, "/api/v1/todos", body, key("retry-1"))
+	retry := s.doWith(alice, http.MethodPost, "/api/v1/todos", body, key("retry-1"))
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated {
+		t.Fatalf("statuses %d and %d: %s", first.Code, retry.Code, retry.Body.String())
+	}
+	if retry.Body.String() != first.Body.String() || retry.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Errorf("replayed %s, first response was %s", retry.Body.String(), first.Body.String())
+	}
+	if retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" || first.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Error("only the retry should be marked as replayed")
+	}
+
+	tests := []struct {
+		name   string
+		user   int
+		key    string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{"same key, different body", alice, "retry-1", gin.H{"title": "Feed cat", "group_id": group.ID}, http.StatusUnprocessableEntity, "idempotency_key_reused"},
+		{"same key, other user", bob, "retry-1", body, http.StatusCreated, ""},
+		{"new key", alice, "retry-2", body, http.StatusCreated, ""},
+		{"key too long", alice, strings.Repeat("k", 256), body, http.StatusBadRequest, "invalid_idempotency_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.doWith(tt.user, http.MethodPost, "/api/v1/todos", tt.body, key(tt.key))
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.code != "" && !strings.Contains(w.Body.String(), `"code":"`+tt.code+`"`) {
+				t.Errorf("got %s, want code %s", w.Body.String(), tt.code)
+			}
+		})
+	}
+
+	// Failed requests are replayed too rather than run again
+	invalid := gin.H{"title": "", "group_id": group.ID}
+	for i := 0; i < 2; i++ {
+		if w := s.doWith(alice, http.MethodPost, "/api/v1/todos", invalid, key("invalid")); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("attempt %d: status %d", i+1, w.Code)
+		}
+	}
+
+	var created int
+	for _, event := range s.store.Events() {
+		if event.EventType == events.ToDoCreated {
+			created++
+		}
+	}
+	if created != 3 {
+		t.Errorf("created %d todos, want 3", created)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	s := newTestServer(t)
+	home := s.createGroup(alice, "Home")
+	work := s.createGroup(alice, "Work")
+	private := s.createGroup(carol, "Private")
+	plants := s.createToDo(alice, home.ID, "Water plants", nil)
+	cat := s.createToDo(alice, home.ID, "Feed cat", nil)
+	hidden := s.createToDo(carol, private.ID, "Diary", nil)
+	const batchURL = "/api/v1/todos:batch"
+
+	batch := func(body interface{}) dto.BatchResponse {
+		t.Helper()
+		var out dto.BatchResponse
+		s.must(alice, http.MethodPost, batchURL, body, http.StatusOK, &out)
+		return out
+	}
+	statuses := func(out dto.BatchResponse) string {
+		codes := make([]string, len(out.Results))
+		for i, result := range out.Results {
+			codes[i] = fmt.Sprint(result.Status)
+		}
+		return strings.Join(codes, ",")
+	}
+	title := func(id uint) string {
+		t.Helper()
+		var todo dto.ToDoResponse
+		s.must(alice, http.MethodGet, path("/api/v1/todos/%d", id), nil, http.StatusOK, &todo)
+		return todo.Title
+	}
+
+	tests := []struct {
+		name string
+		body interface{}
+	}{
+		{"no operations", gin.H{"operations": []gin.H{}}},
+		{"unknown mode", gin.H{"mode": "eventual", "operations": []gin.H{{"op": "delete", "id": plants.ID}}}},
+		{"unknown op", gin.H{"operations": []gin.H{{"op": "rename", "id": plants.ID}}}},
+		{"create without todo", gin.H{"operations": []gin.H{{"op": "create"}}}},
+		{"update without patch", gin.H{"operations": []gin.H{{"op": "update", "id": plants.ID}}}},
+		{"delete without id", gin.H{"operations": []gin.H{{"op": "delete"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := s.do(alice, http.MethodPost, batchURL, tt.body); w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("status %d, want 422: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+	for _, url := range []string{"/api/v1/todos:purge", "/api/v1/todosbatch"} {
+		if w := s.do(alice, http.MethodPost, url, gin.H{}); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", url, w.Code)
+		}
+	}
+
+	// Cached reads must see what a batch changed
+	title(plants.ID)
+	events := len(s.store.Events())
+	out := batch(gin.H{"operations": []gin.H{
+		{"op": "create", "todo": gin.H{"title": "Buy soil", "group_id": home.ID}},
+		{"op": "update", "id": plants.ID, "patch": gin.H{"title": "Water the plants"}},
+		{"op": "move", "id": cat.ID, "group_id": work.ID},
+		{"op": "delete", "id": plants.ID, "version": plants.Version + 1},
+	}})
+	if !out.Committed || out.Mode != dto.BatchAtomic || statuses(out) != "201,200,200,204" {
+		t.Fatalf("got %+v", out)
+	}
+	if out.Results[2].ToDo.GroupID != work.ID {
+		t.Errorf("moved into group %d", out.Results[2].ToDo.GroupID)
+	}
+	if w := s.do(alice, http.MethodGet, path("/api/v1/todos/%d", plants.ID), nil); w.Code != http.StatusNotFound {
+		t.Errorf("deleted todo: status %d", w.Code)
+	}
+	if got := len(s.store.Events()) - events; got != 4 {
+		t.Errorf("recorded %d events, want 4", got)
+	}
+
+	// An atomic batch is rolled back with its first failed operation
+	created := out.Results[0].ToDo
+	title(created.ID)
+	events = len(s.store.Events())
+	out = batch(gin.H{"operations": []gin.H{
+		{"op": "update", "id": created.ID, "patch": gin.H{"title": "Buy compost"}},
+		{"op": "delete", "id": hidden.ID},
+		{"op": "delete", "id": cat.ID},
+	}})
+	if out.Committed || statuses(out) != "424,404,424" || out.Results[0].Error.Code != "batch_aborted" {
+		t.Fatalf("got %+v", out)
+	}
+	if got := title(created.ID); got != "Buy soil" {
+		t.Errorf("title %q after rollback", got)
+	}
+	if got := len(s.store.Events()) - events; got != 0 {
+		t.Errorf("rolled back batch recorded %d events", got)
+	}
+
+	// An independent batch keeps what succeeded
+	out = batch(gin.H{"mode": dto.BatchIndependent, "operations": []gin.H{
+		{"op": "update", "id": created.ID, "version": created.Version + 5, "patch": gin.H{"title": "Buy compost"}},
+		{"op": "update", "id": created.ID, "patch": gin.H{"status": "bogus"}},
+		{"op": "update", "id": created.ID, "patch": gin.H{"title": "Buy compost"}},
+	}})
+	if !out.Committed || statuses(out) != "412,422,200" {
+		t.Fatalf("got %+v", out)
+	}
+	if got := title(created.ID); got != "Buy compost" {
+		t.Errorf("title %q", got)
+	}
+	if w := s.do(carol, http.MethodGet, path("/api/v1/todos/%d", hidden.ID), nil); w.Code != http.StatusOK {
+		t.Errorf("other user's todo: status %d", w.Code)
+	}
+}
+
+func TestMoveToDo(t *testing.T) {
+	s := newTestServer(t)
+	home := s.createGroup(alice, "Home")
+	var sprint dto.GroupResponse
+	s.must(alice, http.MethodPost, "/api/v1/groups", gin.H{"name": "Sprint", "workflow": workflow.Kanban}, http.StatusCreated, &sprint)
+	todos := map[string]dto.ToDoResponse{}
+	for _, title := range []string{"a", "b", "c"} {
+		todos[title] = s.createToDo(alice, home.ID, title, nil)
+	}
+	sprintToDo := s.createToDo(alice, sprint.ID, "s", nil)
+	todos["s"] = sprintToDo
+
+	order := func(groupID uint) string {
+		t.Helper()
+		var page dto.ToDoPage
+		s.must(alice, http.MethodGet, path("/api/v1/todos?group_id=%d", groupID), nil, http.StatusOK, &page)
+		var group dto.GroupResponse
+		s.must(alice, http.MethodGet, path("/api/v1/groups/%d", groupID), nil, http.StatusOK, &group)
+		titles := make([]string, len(page.Items))
+		for i, todo := range page.Items {
+			titles[i] = todo.Title
+			if group.ToDos[i].ID != todo.ID {
+				t.Errorf("group lists %s at %d, todo list %s", group.ToDos[i].Title, i, todo.Title)
+			}
+		}
+		return strings.Join(titles, ",")
+	}
+	move := func(title string, body gin.H, status int) {
+		t.Helper()
+		var moved dto.ToDoResponse
+		w := s.do(alice, http.MethodPost, path("/api/v1/todos/%d/move", todos[title].ID), body)
+		if w.Code != status {
+			t.Fatalf("moving %s with %v: status %d, want %d: %s", title, body, w.Code, status, w.Body.String())
+		}
+		if status == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &moved); err != nil {
+				t.Fatal(err)
+			}
+			todos[title] = moved
+		}
+	}
+
+	if got := order(home.ID); got != "a,b,c" {
+		t.Fatalf("order %s, want creation order", got)
+	}
+
+	steps := []struct {
+		title string
+		body  gin.H
+		want  string
+	}{
+		{"c", gin.H{"after_id": todos["a"].ID}, "a,c,b"},
+		{"a", gin.H{"before_id": todos["b"].ID}, "c,a,b"},
+		{"b", gin.H{"after_id": todos["c"].ID, "before_id": todos["a"].ID}, "c,b,a"},
+		{"c", gin.H{}, "b,a,c"},
+		{"c", gin.H{"before_id": todos["b"].ID}, "c,b,a"},
+	}
+	for _, step := range steps {
+		untouched := todos["b"]
+		move(step.title, step.body, http.StatusOK)
+		if got := order(home.ID); got != step.want {
+			t.Fatalf("after moving %s with %v: order %s, want %s", step.title, step.body, got, step.want)
+		}
+		if step.title != "b" {
+			var b dto.ToDoResponse
+			s.must(alice, http.MethodGet, path("/api/v1/todos/%d", untouched.ID), nil, http.StatusOK, &b)
+			if b.Version != untouched.Version || b.Rank != untouched.Rank {
+				t.Errorf("moving %s changed b", step.title)
+			}
+		}
+	}
+
+	failures := []struct {
+		name   string
+		body   gin.H
+		status int
+	}{
+		{"neighbours out of order", gin.H{"after_id": todos["a"].ID, "before_id": todos["b"].ID}, http.StatusUnprocessableEntity},
+		{"itself as neighbour", gin.H{"after_id": todos["c"].ID}, http.StatusUnprocessableEntity},
+		{"neighbour in another group", gin.H{"after_id": sprintToDo.ID}, http.StatusUnprocessableEntity},
+		{"unknown neighbour", gin.H{"before_id": 999}, http.StatusUnprocessableEntity},
+		{"unknown group", gin.H{"group_id": 999}, http.StatusUnprocessableEntity},
+		{"status not in the target workflow", gin.H{"group_id": sprint.ID}, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			move("c", tt.body, tt.status)
+		})
+	}
+	stale := http.Header{"If-Match": {`"1"`}}
+	if w := s.doWith(alice, http.MethodPost, path("/api/v1/todos/%d/move", todos["a"].ID), gin.H{}, stale); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: status %d, want 412", w.Code)
+	}
+	if w := s.do(carol, http.MethodPost, path("/api/v1/todos/%d/move", todos["a"].ID), gin.H{}); w.Code != http.StatusNotFound {
+		t.Errorf("stranger: status %d, want 404", w.Code)
+	}
+
+	// Moving to another group places the todo among that group's todos
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", todos["b"].ID), gin.H{"to": "done"}, http.StatusCreated, nil)
+	move("b", gin.H{"group_id": sprint.ID, "before_id": sprintToDo.ID}, http.StatusOK)
+	if got := order(sprint.ID); got != "b,s" {
+		t.Errorf("sprint order %s", got)
+	}
+	if got := order(home.ID); got != "c,a" {
+		t.Errorf("home order %s", got)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	s := newTestServer(t)
+	home := s.createGroup(alice, "Home")
+	other := s.createGroup(alice, "Other")
+	parent := s.createToDo(alice, home.ID, "Move house", nil)
+	parentURL := path("/api/v1/todos/%d", parent.ID)
+	subtasksURL := path("/api/v1/todos/%d/subtasks", parent.ID)
+
+	patch := func(id uint, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return s.send(alice, http.MethodPatch, path("/api/v1/todos/%d", id), "application/merge-patch+json", body)
+	}
+	get := func(id uint) dto.ToDoResponse {
+		t.Helper()
+		var todo dto.ToDoResponse
+		s.must(alice, http.MethodGet, path("/api/v1/todos/%d", id), nil, http.StatusOK, &todo)
+		return todo
+	}
+	if get(parent.ID).Progress != nil {
+		t.Error("todo without subtasks has a progress")
+	}
+
+	var box, van dto.ToDoResponse
+	s.must(alice, http.MethodPost, subtasksURL, gin.H{"title": "Pack boxes"}, http.StatusCreated, &box)
+	s.must(alice, http.MethodPost, "/api/v1/todos", gin.H{"title": "Rent a van", "group_id": home.ID, "parent_id": parent.ID}, http.StatusCreated, &van)
+	if box.ParentID == nil || *box.ParentID != parent.ID || box.GroupID != home.ID {
+		t.Errorf("subtask %+v isn't under its parent", box)
+	}
+	cached := get(parent.ID)
+	if cached.Progress == nil || *cached.Progress != (dto.Progress{Completed: 0, Total: 2}) {
+		t.Fatalf("progress %+v, want 0 of 2", cached.Progress)
+	}
+
+	var subtasks []dto.ToDoResponse
+	s.must(alice, http.MethodGet, subtasksURL, nil, http.StatusOK, &subtasks)
+	if len(subtasks) != 2 || subtasks[0].ID != box.ID || subtasks[1].ID != van.ID {
+		t.Errorf("subtasks %+v, want box then van", subtasks)
+	}
+	if w := s.do(carol, http.MethodGet, subtasksURL, nil); w.Code != http.StatusNotFound {
+		t.Errorf("stranger listing subtasks: status %d, want 404", w.Code)
+	}
+
+	// Subtasks nest three levels deep at most, and never under themselves
+	var tape dto.ToDoResponse
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/subtasks", box.ID), gin.H{"title": "Buy tape"}, http.StatusCreated, &tape)
+	invalid := []struct {
+		name string
+		send func() *httptest.ResponseRecorder
+	}{
+		{"too deep", func() *httptest.ResponseRecorder {
+			return s.do(alice, http.MethodPost, path("/api/v1/todos/%d/subtasks", tape.ID), gin.H{"title": "Find a shop"})
+		}},
+		{"under its own subtask", func() *httptest.ResponseRecorder { return patch(parent.ID, fmt.Sprintf(`{"parent_id": %d}`, tape.ID)) }},
+		{"under itself", func() *httptest.ResponseRecorder {
+			return patch(parent.ID, fmt.Sprintf(`{"parent_id": %d}`, parent.ID))
+		}},
+		{"under a todo of another group", func() *httptest.ResponseRecorder {
+			return s.do(alice, http.MethodPost, "/api/v1/todos", gin.H{"title": "x", "group_id": other.ID, "parent_id": parent.ID})
+		}},
+		{"bringing its subtasks too deep", func() *httptest.ResponseRecorder { return patch(box.ID, fmt.Sprintf(`{"parent_id": %d}`, van.ID)) }},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.send()
+			if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "parent_id") {
+				t.Errorf("status %d, want 422 on parent_id: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Todos stay in the group of their parent and subtasks
+	if w := patch(parent.ID, fmt.Sprintf(`{"group_id": %d}`, other.ID)); w.Code != http.StatusConflict {
+		t.Errorf("moving a parent to another group: status %d, want 409", w.Code)
+	}
+	if w := s.do(alice, http.MethodPost, path("/api/v1/todos/%d/move", van.ID), gin.H{"group_id": other.ID}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("moving a subtask to another group: status %d, want 422", w.Code)
+	}
+
+	// A parent can't be closed before its subtasks, whose progress it tracks
+	w := s.do(alice, http.MethodPost, parentURL+"/transitions", gin.H{"to": "done"})
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "open_subtasks") {
+		t.Fatalf("closing a parent with open subtasks: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := patch(van.ID, `{"status": "done"}`); w.Code != http.StatusOK {
+		t.Fatalf("closing a subtask: status %d: %s", w.Code, w.Body.String())
+	}
+	updated := get(parent.ID)
+	if *updated.Progress != (dto.Progress{Completed: 1, Total: 2}) || updated.Version == cached.Version {
+		t.Errorf("after closing a subtask: progress %+v, version %d (was %d)", updated.Progress, updated.Version, cached.Version)
+	}
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", tape.ID), gin.H{"to": "done"}, http.StatusCreated, nil)
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", box.ID), gin.H{"to": "done"}, http.StatusCreated, nil)
+	s.must(alice, http.MethodPost, parentURL+"/transitions", gin.H{"to": "done"}, http.StatusCreated, nil)
+	if progress := get(parent.ID).Progress; *progress != (dto.Progress{Completed: 2, Total: 2}) {
+		t.Errorf("progress %+v, want 2 of 2", progress)
+	}
+
+	// Deleting a parent deletes its subtasks all the way down
+	before := len(s.store.Events())
+	s.must(alice, http.MethodDelete, parentURL, nil, http.StatusOK, nil)
+	for _, id := range []uint{parent.ID, box.ID, van.ID, tape.ID} {
+		if w := s.do(alice, http.MethodGet, path("/api/v1/todos/%d", id), nil); w.Code != http.StatusNotFound {
+			t.Errorf("todo %d after deleting its parent: status %d, want 404", id, w.Code)
+		}
+	}
+	deleted := 0
+	for _, event := range s.store.Events()[before:] {
+		if event.EventType == events.ToDoDeleted {
+			deleted++
+		}
+	}
+	if deleted != 4 {
+		t.Errorf("%d delete events, want 4", deleted)
+	}
+}
+
+func TestTags(t *testing.T) {
+	s := newTestServer(t)
+	home := s.createGroup(alice, "Home")
+	work := s.createGroup(alice, "Work")
+	s.share(alice, home.ID, bob, models.RoleEditor)
+
+	createTag := func(userID int, name, color string) dto.TagResponse {
+		t.Helper()
+		var tag dto.TagResponse
+		s.must(userID, http.MethodPost, "/api/v1/tags", gin.H{"name": name, "color": color}, http.StatusCreated, &tag)
+		return tag
+	}
+	urgent := createTag(alice, "urgent", "#E53935")
+	backend := createTag(alice, "backend", "")
+	bobs := createTag(bob, "urgent", "#000")
+	if urgent.Color != "#e53935" || backend.Color != models.DefaultTagColor {
+		t.Errorf("colors %q and %q", urgent.Color, backend.Color)
+	}
+	if w := s.do(alice, http.MethodPost, "/api/v1/tags", gin.H{"name": "urgent"}); w.Code != http.StatusConflict {
+		t.Errorf("duplicate name: status %d, want 409", w.Code)
+	}
+	if w := s.do(alice, http.MethodPost, "/api/v1/tags", gin.H{"name": "red", "color": "red"}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid color: status %d, want 422", w.Code)
+	}
+	if w := s.do(alice, http.MethodGet, path("/api/v1/tags/%d", bobs.ID), nil); w.Code != http.StatusNotFound {
+		t.Errorf("someone else's tag: status %d, want 404", w.Code)
+	}
+	var tags []dto.TagResponse
+	s.must(alice, http.MethodGet, "/api/v1/tags", nil, http.StatusOK, &tags)
+	if len(tags) != 2 || tags[0].Name != "backend" || tags[1].Name != "urgent" {
+		t.Errorf("tags %+v, want backend and urgent", tags)
+	}
+
+	var both, onlyUrgent dto.ToDoResponse
+	s.must(alice, http.MethodPost, "/api/v1/todos", gin.H{"title": "Fix login", "group_id": work.ID, "tag_ids": []uint{urgent.ID, backend.ID}}, http.StatusCreated, &both)
+	s.must(alice, http.MethodPost, "/api/v1/todos", gin.H{"title": "Water plants", "group_id": home.ID, "tag_ids": []uint{urgent.ID}}, http.StatusCreated, &onlyUrgent)
+	untagged := s.createToDo(alice, home.ID, "Read", nil)
+	if len(both.Tags) != 2 || both.Tags[0].Name != "backend" || both.Tags[1].Name != "urgent" {
+		t.Errorf("tags %+v, want backend and urgent", both.Tags)
+	}
+	if untagged.Tags == nil || len(untagged.Tags) != 0 {
+		t.Errorf("untagged todo has tags %v", untagged.Tags)
+	}
+	if w := s.do(alice, http.MethodPost, "/api/v1/todos", gin.H{"title": "x", "group_id": home.ID, "tag_ids": []uint{bobs.ID}}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("someone else's tag on a new todo: status %d, want 422", w.Code)
+	}
+
+	titles := func(userID int, query string) string {
+		t.Helper()
+		var page dto.ToDoPage
+		s.must(userID, http.MethodGet, "/api/v1/todos?sort=id&"+query, nil, http.StatusOK, &page)
+		var titles []string
+		for _, todo := range page.Items {
+			titles = append(titles, todo.Title)
+		}
+		return strings.Join(titles, ",")
+	}
+	filters := []struct {
+		query string
+		want  string
+	}{
+		{"tags=urgent", "Fix login,Water plants"},
+		{"tags=urgent,backend", "Fix login"},
+		{"tags=urgent,backend&tag_mode=any", "Fix login,Water plants"},
+		{"tags=backend,unknown&tag_mode=any", "Fix login"},
+		{"tags=backend,unknown", ""},
+	}
+	for _, tt := range filters {
+		if got := titles(alice, tt.query); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.query, got, tt.want)
+		}
+	}
+	if got := titles(bob, "tags=urgent"); got != "" {
+		t.Errorf("bob's urgent matched %q", got)
+	}
+	if w := s.do(alice, http.MethodGet, "/api/v1/todos?tags=urgent&tag_mode=some", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid tag_mode: status %d, want 400", w.Code)
+	}
+
+	// Editors keep the tags others put on a todo but only add their own
+	patch := func(userID int, id uint, body string) *httptest.ResponseRecorder {
+		return s.send(userID, http.MethodPatch, path("/api/v1/todos/%d", id), "application/merge-patch+json", body)
+	}
+	if w := patch(bob, onlyUrgent.ID, fmt.Sprintf(`{"tag_ids": [%d, %d]}`, urgent.ID, bobs.ID)); w.Code != http.StatusOK {
+		t.Fatalf("bob adding his tag: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := patch(bob, onlyUrgent.ID, fmt.Sprintf(`{"tag_ids": [%d, %d, %d]}`, urgent.ID, bobs.ID, backend.ID)); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("bob adding alice's tag: status %d, want 422", w.Code)
+	}
+	if got := titles(bob, "tags=urgent"); got != "Water plants" {
+		t.Errorf("bob's urgent matched %q", got)
+	}
+
+	// Renames show on the tagged todos, whose versions move on
+	var before dto.ToDoResponse
+	s.must(alice, http.MethodGet, path("/api/v1/todos/%d", both.ID), nil, http.StatusOK, &before)
+	s.must(alice, http.MethodPut, path("/api/v1/tags/%d", backend.ID), gin.H{"name": "api"}, http.StatusOK, nil)
+	var renamed dto.ToDoResponse
+	s.must(alice, http.MethodGet, path("/api/v1/todos/%d", both.ID), nil, http.StatusOK, &renamed)
+	if renamed.Tags[0].Name != "api" || renamed.Tags[0].Color != models.DefaultTagColor || renamed.Version == before.Version {
+		t.Errorf("after renaming: tags %+v, version %d (was %d)", renamed.Tags, renamed.Version, before.Version)
+	}
+	if got := titles(alice, "tags=api"); got != "Fix login" {
+		t.Errorf("renamed tag matched %q", got)
+	}
+	if w := s.do(alice, http.MethodPut, path("/api/v1/tags/%d", backend.ID), gin.H{"name": "urgent"}); w.Code != http.StatusConflict {
+		t.Errorf("renaming to a taken name: status %d, want 409", w.Code)
+	}
+
+	// Deleting a tag takes it off its todos
+	if w := s.do(alice, http.MethodDelete, path("/api/v1/tags/%d", urgent.ID), nil); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", w.Code)
+	}
+	var detached dto.ToDoResponse
+	s.must(alice, http.MethodGet, path("/api/v1/todos/%d", onlyUrgent.ID), nil, http.StatusOK, &detached)
+	if len(detached.Tags) != 1 || detached.Tags[0].ID != bobs.ID {
+		t.Errorf("tags after deleting urgent: %+v", detached.Tags)
+	}
+	var group dto.GroupResponse
+	s.must(alice, http.MethodGet, path("/api/v1/groups/%d", work.ID), nil, http.StatusOK, &group)
+	if len(group.ToDos[0].Tags) != 1 || group.ToDos[0].Tags[0].Name != "api" {
+		t.Errorf("group todo tags %+v", group.ToDos[0].Tags)
+	}
+	if got := titles(alice, "tags=urgent"); got != "" {
+		t.Errorf("deleted tag matched %q", got)
+	}
+}
+
+func TestPriorities(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Chores")
+	past, future := time.Now().Add(-48*time.Hour), time.Now().Add(48*time.Hour)
+
+	create := func(body gin.H) dto.ToDoResponse {
+		t.Helper()
+		body["group_id"] = group.ID
+		var todo dto.ToDoResponse
+		s.must(alice, http.MethodPost, "/api/v1/todos", body, http.StatusCreated, &todo)
+		return todo
+	}
+	plain := create(gin.H{"title": "Plain"})
+	if plain.Priority != models.DefaultPriority || plain.EstimateMinutes != nil {
+		t.Errorf("defaults: priority %q, estimate %v", plain.Priority, plain.EstimateMinutes)
+	}
+	create(gin.H{"title": "Late", "priority": "P3", "due_date": past})
+	done := create(gin.H{"title": "Done late", "priority": "P0", "due_date": past})
+	create(gin.H{"title": "Soon", "priority": "P0", "due_date": future, "estimate_minutes": 30})
+	create(gin.H{"title": "Urgent", "priority": "P0"})
+
+	for _, body := range []gin.H{
+		{"title": "x", "group_id": group.ID, "priority": "P4"},
+		{"title": "x", "group_id": group.ID, "estimate_minutes": 0},
+		{"title": "x", "group_id": group.ID, "estimate_minutes": 525601},
+	} {
+		if w := s.do(alice, http.MethodPost, "/api/v1/todos", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%v: status %d, want 422", body, w.Code)
+		}
+	}
+
+	var patched dto.ToDoResponse
+	w := s.send(alice, http.MethodPatch, path("/api/v1/todos/%d", done.ID), "application/merge-patch+json", `{"status": "done", "estimate_minutes": 45}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch: status %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &patched); err != nil {
+		t.Fatal(err)
+	}
+	if patched.Priority != "P0" || patched.EstimateMinutes == nil || *patched.EstimateMinutes != 45 {
+		t.Errorf("after patch: priority %q, estimate %v", patched.Priority, patched.EstimateMinutes)
+	}
+	s.send(alice, http.MethodPatch, path("/api/v1/todos/%d", plain.ID), "application/merge-patch+json", `{"priority": "P1"}`)
+
+	// Overdue open todos come first, a closed one sorts by its priority
+	var titles []string
+	next := "/api/v1/todos?sort=smart&limit=2"
+	for pages := 0; next != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination didn't terminate")
+		}
+		var page dto.ToDoPage
+		s.must(alice, http.MethodGet, next, nil, http.StatusOK, &page)
+		for _, todo := range page.Items {
+			titles = append(titles, todo.Title)
+		}
+		next = ""
+		if page.NextCursor != "" {
+			next = "/api/v1/todos?sort=smart&limit=2&cursor=" + page.NextCursor
+		}
+	}
+	if got, want := strings.Join(titles, ","), "Late,Done late,Soon,Urgent,Plain"; got != want {
+		t.Errorf("smart order %q, want %q", got, want)
+	}
+}
+
+// writeOnlyCache records the keys set in it and can fail every write
+type writeOnlyCache struct {
+	cache.Cache
+	fail bool
+	set  []string
+}
+
+func (c *writeOnlyCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if c.fail {
+		return errors.New("cache is read-only")
+	}
+	c.set = append(c.set, key)
+	return c.Cache.Set(ctx, key, value, ttl)
+}
+
+func (c *writeOnlyCache) Del(ctx context.Context, keys ...string) error {
+	if c.fail {
+		return errors.New("cache is read-only")
+	}
+	return c.Cache.Del(ctx, keys...)
+}
+
+func (c *writeOnlyCache) Incr(ctx context.Context, key string) (int64, error) {
+	if c.fail {
+		return 0, errors.New("cache is read-only")
+	}
+	return c.Cache.Incr(ctx, key)
+}
+
+// listed counts the list pages of kind cached so far
+func (c *writeOnlyCache) listed(kind string) int {
+	n := 0
+	for _, key := range c.set {
+		if strings.HasPrefix(key, kind+":list:") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestResponseCaching(t *testing.T) {
+	c := &writeOnlyCache{Cache: cache.NewMemory()}
+	s := newTestServer(t, func(deps *controllers.Dependencies) { deps.Cache = c })
+	group := s.createGroup(alice, "Chores")
+	late := time.Now().Add(-time.Hour)
+	s.createToDo(alice, group.ID, "Late", &late)
+	s.createToDo(alice, group.ID, "Undated", nil)
+
+	// A smart-sorted first page is listed afresh every time, since which
+	// todos are overdue changes with the time; later pages are cached
+	var page dto.ToDoPage
+	s.must(alice, http.MethodGet, "/api/v1/todos?sort=smart&limit=1", nil, http.StatusOK, &page)
+	s.must(alice, http.MethodGet, "/api/v1/todos?sort=smart&limit=1", nil, http.StatusOK, nil)
+	if n := c.listed("todos"); n != 0 {
+		t.Errorf("%d smart first pages cached", n)
+	}
+	if len(page.Items) != 1 || page.Items[0].Title != "Late" || page.NextCursor == "" {
+		t.Fatalf("smart first page %+v", page)
+	}
+	s.must(alice, http.MethodGet, "/api/v1/todos?sort=smart&limit=1&cursor="+page.NextCursor, nil, http.StatusOK, nil)
+	s.must(alice, http.MethodGet, "/api/v1/todos?sort=created_at&limit=1", nil, http.StatusOK, nil)
+	if n := c.listed("todos"); n != 2 {
+		t.Errorf("%d pages cached, want the smart second page and the created_at one", n)
+	}
+
+	// Reads succeed even when their result can't be cached, and writes when
+	// the caches can't be invalidated; the failures are logged
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	c.fail = true
+	todo := s.createToDo(alice, group.ID, "Sweep", nil)
+	s.must(alice, http.MethodDelete, path("/api/v1/todos/%d", s.createToDo(alice, group.ID, "Mop", nil).ID), nil, http.StatusOK, nil)
+	for _, want := range []string{"Error dropping cached todos", "Error dropping cached groups", "Error retiring the cached todos lists of user 1"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("%q not logged:\n%s", want, logs.String())
+		}
+	}
+	for _, url := range []string{
+		"/api/v1/groups",
+		path("/api/v1/groups/%d", group.ID),
+		"/api/v1/todos",
+		path("/api/v1/todos/%d", todo.ID),
+	} {
+		if w := s.do(alice, http.MethodGet, url, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Chores") && !strings.Contains(w.Body.String(), "Sweep") {
+			t.Errorf("GET %s with a failing cache: status %d: %s", url, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRecurrence(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Chores")
+	var tag dto.TagResponse
+	s.must(alice, http.MethodPost, "/api/v1/tags", gin.H{"name": "home"}, http.StatusCreated, &tag)
+	due := time.Date(2025, 3, 29, 8, 0, 0, 0, time.UTC)
+
+	var first dto.ToDoResponse
+	s.must(alice, http.MethodPost, "/api/v1/todos", gin.H{
+		"title": "Water plants", "group_id": group.ID, "due_date": due, "priority": "P1", "tag_ids": []uint{tag.ID},
+		"recurrence": "rrule:freq=daily", "timezone": "Europe/Berlin",
+	}, http.StatusCreated, &first)
+	if first.Recurrence != "FREQ=DAILY" || first.RecurrenceStart == nil || !first.RecurrenceStart.Equal(due) || first.SeriesID != nil {
+		t.Errorf("recurrence %q from %v, series %v", first.Recurrence, first.RecurrenceStart, first.SeriesID)
+	}
+
+	invalid := []gin.H{
+		{"title": "x", "group_id": group.ID, "recurrence": "FREQ=DAILY"},
+		{"title": "x", "group_id": group.ID, "due_date": due, "recurrence": "FREQ=SOMETIMES"},
+		{"title": "x", "group_id": group.ID, "due_date": due, "recurrence": "FREQ=DAILY", "timezone": "Europe/Atlantis"},
+		{"title": "x", "group_id": group.ID, "due_date": due, "recurrence": "FREQ=DAILY", "parent_id": first.ID},
+	}
+	for _, body := range invalid {
+		if w := s.do(alice, http.MethodPost, "/api/v1/todos", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%v: status %d, want 422", body, w.Code)
+		}
+	}
+
+	// occurrences lists the open todos of the group by due date
+	occurrences := func() []dto.ToDoResponse {
+		t.Helper()
+		var page dto.ToDoPage
+		s.must(alice, http.MethodGet, path("/api/v1/todos?group_id=%d&status=pending&sort=due_date", group.ID), nil, http.StatusOK, &page)
+		return page.Items
+	}
+	next := func(previous dto.ToDoResponse, want time.Time) dto.ToDoResponse {
+		t.Helper()
+		open := occurrences()
+		if len(open) != 1 {
+			t.Fatalf("%d open occurrences, want 1", len(open))
+		}
+		todo := open[0]
+		if !todo.DueDate.Equal(want) || todo.Recurrence != "FREQ=DAILY" || todo.Timezone != "Europe/Berlin" {
+			t.Errorf("next occurrence due %v, recurrence %q in %q", todo.DueDate, todo.Recurrence, todo.Timezone)
+		}
+		if todo.SeriesID == nil || *todo.SeriesID != first.ID || todo.ID == previous.ID {
+			t.Errorf("next occurrence %d in series %v", todo.ID, todo.SeriesID)
+		}
+		if todo.Priority != "P1" || len(todo.Tags) != 1 || todo.Tags[0].ID != tag.ID || todo.GroupID != group.ID {
+			t.Errorf("next occurrence priority %q, tags %+v, group %d", todo.Priority, todo.Tags, todo.GroupID)
+		}
+		return todo
+	}
+
+	// Completing an occurrence hands the recurrence over to the next one, at
+	// 09:00 in Berlin even after the clocks went forward
+	var done dto.ToDoResponse
+	w := s.send(alice, http.MethodPatch, path("/api/v1/todos/%d", first.ID), "application/merge-patch+json", `{"status": "done"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("complete: status %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.Recurrence != "" || done.SeriesID == nil || *done.SeriesID != first.ID {
+		t.Errorf("completed occurrence still recurs %q, series %v", done.Recurrence, done.SeriesID)
+	}
+	second := next(first, time.Date(2025, 3, 30, 7, 0, 0, 0, time.UTC))
+
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", second.ID), gin.H{"to": "done"}, http.StatusCreated, nil)
+	third := next(second, time.Date(2025, 3, 31, 7, 0, 0, 0, time.UTC))
+
+	var skipped dto.ToDoResponse
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/skip", third.ID), nil, http.StatusOK, &skipped)
+	if want := time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC); skipped.ID != third.ID || !skipped.DueDate.Equal(want) {
+		t.Errorf("skipped to %v, want %v", skipped.DueDate, want)
+	}
+
+	var stopped dto.ToDoResponse
+	s.must(alice, http.MethodDelete, path("/api/v1/todos/%d/recurrence", third.ID), nil, http.StatusOK, &stopped)
+	if stopped.Recurrence != "" || stopped.Timezone != "" || stopped.RecurrenceStart != nil {
+		t.Errorf("stopped todo still recurs: %+v", stopped)
+	}
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", third.ID), gin.H{"to": "done"}, http.StatusCreated, nil)
+	if open := occurrences(); len(open) != 0 {
+		t.Errorf("%d occurrences after the series stopped", len(open))
+	}
+	if w := s.do(alice, http.MethodPost, path("/api/v1/todos/%d/skip", third.ID), nil); w.Code != http.StatusConflict {
+		t.Errorf("skipping a todo that doesn't recur: status %d, want 409", w.Code)
+	}
+
+	// COUNT ends the series
+	var last dto.ToDoResponse
+	s.must(alice, http.MethodPost, "/api/v1/todos", gin.H{
+		"title": "Twice", "group_id": group.ID, "due_date": due, "recurrence": "FREQ=WEEKLY;COUNT=2",
+	}, http.StatusCreated, &last)
+	if last.Timezone != "UTC" {
+		t.Errorf("default timezone %q, want UTC", last.Timezone)
+	}
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", last.ID), gin.H{"to": "done"}, http.StatusCreated, nil)
+	open := occurrences()
+	if len(open) != 1 || !open[0].DueDate.Equal(due.AddDate(0, 0, 7)) {
+		t.Fatalf("occurrences after the first of two: %+v", open)
+	}
+	if w := s.do(alice, http.MethodPost, path("/api/v1/todos/%d/skip", open[0].ID), nil); w.Code != http.StatusConflict {
+		t.Errorf("skipping the last occurrence: status %d, want 409", w.Code)
+	}
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", open[0].ID), gin.H{"to": "done"}, http.StatusCreated, nil)
+	if open := occurrences(); len(open) != 0 {
+		t.Errorf("%d occurrences after the last one", len(open))
+	}
+}
+
+func TestRecurrenceUnderKanban(t *testing.T) {
+	s := newTestServer(t)
+	var group dto.GroupResponse
+	s.must(alice, http.MethodPost, "/api/v1/groups", gin.H{"name": "Sprint", "workflow": workflow.Kanban}, http.StatusCreated, &group)
+	due := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+	var first dto.ToDoResponse
+	s.must(alice, http.MethodPost, "/api/v1/todos", gin.H{
+		"title": "Standup", "group_id": group.ID, "due_date": due, "recurrence": "FREQ=DAILY",
+	}, http.StatusCreated, &first)
+
+	// next is the only open occurrence, due on day of the series
+	next := func(day int) dto.ToDoResponse {
+		t.Helper()
+		var page dto.ToDoPage
+		s.must(alice, http.MethodGet, path("/api/v1/todos?group_id=%d&status=todo,in_progress,blocked&sort=due_date", group.ID), nil, http.StatusOK, &page)
+		if len(page.Items) != 1 {
+			t.Fatalf("%d open occurrences, want 1", len(page.Items))
+		}
+		todo := page.Items[0]
+		if want := due.AddDate(0, 0, day); !todo.DueDate.Equal(want) || todo.Recurrence != "FREQ=DAILY" {
+			t.Errorf("occurrence due %v recurring %q, want due %v", todo.DueDate, todo.Recurrence, want)
+		}
+		return todo
+	}
+	transition := func(todo dto.ToDoResponse, statuses ...string) {
+		t.Helper()
+		for _, status := range statuses {
+			s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", todo.ID), gin.H{"to": status}, http.StatusCreated, nil)
+		}
+	}
+
+	// Cancelling an occurrence finishes it like completing it does
+	transition(first, "cancelled")
+	second := next(1)
+	if second.Status != "todo" {
+		t.Errorf("next occurrence in %q, want the kanban initial status", second.Status)
+	}
+
+	// Statuses short of complete keep the occurrence open
+	transition(second, "in_progress", "blocked")
+	if got := next(1); got.ID != second.ID {
+		t.Errorf("blocking an occurrence moved the series on to %d", got.ID)
+	}
+	transition(second, "done")
+	third := next(2)
+
+	w := s.send(alice, http.MethodPatch, path("/api/v1/todos/%d", third.ID), "application/merge-patch+json", `{"status": "cancelled"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", w.Code, w.Body.String())
+	}
+	next(3)
+
+	var workflows []dto.WorkflowResponse
+	s.must(alice, http.MethodGet, "/api/v1/workflows", nil, http.StatusOK, &workflows)
+	for _, w := range workflows {
+		if w.Name == workflow.Kanban && strings.Join(w.Complete, ",") != "done,cancelled" {
+			t.Errorf("kanban completes with %v", w.Complete)
+		}
+	}
+}
+
+func TestCustomCompleteStatus(t *testing.T) {
+	support := workflow.Workflow{
+		Name:    "support",
+		Initial: "open",
+		Transitions: map[string][]string{
+			"open":      {"waiting", "cancelled"},
+			"waiting":   {"open", "cancelled"},
+			"cancelled": {"open"},
+		},
+		Complete: []string{"cancelled"},
+	}
+	// Statuses that don't close a todo can't complete it, or it would stay overdue
+	shipped := support
+	shipped.Name = "shipping"
+	shipped.Transitions = map[string][]string{"open": {"shipped"}, "shipped": {}}
+	shipped.Complete = []string{"shipped"}
+	if _, err := workflow.NewRegistry(workflow.Basic, append(workflow.Builtin(), shipped)...); err == nil {
+		t.Error("workflow completing with shipped accepted")
+	}
+
+	workflows, err := workflow.NewRegistry(workflow.Basic, append(workflow.Builtin(), support)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, func(deps *controllers.Dependencies) { deps.Workflows = workflows })
+	var group dto.GroupResponse
+	s.must(alice, http.MethodPost, "/api/v1/groups", gin.H{"name": "Helpdesk", "workflow": "support"}, http.StatusCreated, &group)
+	due := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	var first dto.ToDoResponse
+	s.must(alice, http.MethodPost, "/api/v1/todos", gin.H{
+		"title": "Rotate the logs", "group_id": group.ID, "due_date": due, "recurrence": "FREQ=WEEKLY",
+	}, http.StatusCreated, &first)
+
+	list := func(path string) []models.ToDo {
+		t.Helper()
+		var todos []models.ToDo
+		s.must(alice, http.MethodGet, path, nil, http.StatusOK, &todos)
+		return todos
+	}
+	if overdue := list("/api/v1/todos/overdue"); len(overdue) != 1 || overdue[0].ID != first.ID {
+		t.Fatalf("overdue %+v, want the first occurrence", overdue)
+	}
+
+	// Cancelling completes the occurrence, which is no longer overdue
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", first.ID), gin.H{"to": "cancelled"}, http.StatusCreated, nil)
+	if overdue := list("/api/v1/todos/overdue"); len(overdue) != 0 {
+		t.Errorf("overdue %+v after cancelling, want none", overdue)
+	}
+	upcoming := list("/api/v1/todos/upcoming")
+	if len(upcoming) != 1 || upcoming[0].ID == first.ID || upcoming[0].Status != "open" || !upcoming[0].DueDate.Equal(due.AddDate(0, 0, 7)) {
+		t.Errorf("upcoming %+v, want the next occurrence open in a week", upcoming)
+	}
+}
+
+func TestReminders(t *testing.T) {
+	s := newTestServer(t)
+	group := s.createGroup(alice, "Errands")
+	now := time.Now().UTC().Truncate(time.Second)
+	due := now.Add(2 * time.Hour)
+
+	var todo dto.ToDoResponse
+	s.must(alice, http.MethodPost, "/api/v1/todos", gin.H{
+		"title": "Post the parcel", "group_id": group.ID, "due_date": due, "reminder_offsets": []int{60, 30, 180, 60},
+	}, http.StatusCreated, &todo)
+	// The reminder three hours ahead of a todo due in two won't fire
+	at := func(t time.Time) *time.Time { return &t }
+	want := []struct {
+		offset int
+		at     *time.Time
+	}{{180, nil}, {60, at(due.Add(-time.Hour))}, {30, at(due.Add(-30 * time.Minute))}}
+	if len(todo.Reminders) != len(want) {
+		t.Fatalf("reminders %+v, want offsets 180, 60 and 30", todo.Reminders)
+	}
+	for i, w := range want {
+		got := todo.Reminders[i]
+		if got.OffsetMinutes != w.offset || (got.RemindAt == nil) != (w.at == nil) || w.at != nil && !got.RemindAt.Equal(*w.at) {
+			t.Errorf("reminder %d is %d minutes ahead at %v, want %d at %v", i, got.OffsetMinutes, got.RemindAt, w.offset, w.at)
+		}
+	}
+
+	for _, offsets := range [][]int{{-5}, {1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}} {
+		body := gin.H{"title": "x", "group_id": group.ID, "reminder_offsets": offsets}
+		if w := s.do(alice, http.MethodPost, "/api/v1/todos", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("offsets %v: status %d, want 422", offsets, w.Code)
+		}
+	}
+
+	// fire fires the reminders due at the given time and returns their events
+	fire := func(now time.Time) []models.OutboxEvent {
+		t.Helper()
+		before := len(s.store.Events())
+		if _, err := s.store.Reminders().FireDue(context.Background(), now, 10); err != nil {
+			t.Fatal(err)
+		}
+		return s.store.Events()[before:]
+	}
+	fired := fire(now.Add(75 * time.Minute))
+	if len(fired) != 1 || fired[0].EventType != events.ToDoReminder || fired[0].Topic != events.DefaultTopics.Reminder || fired[0].Key != fmt.Sprint(todo.ID) {
+		t.Fatalf("fired %+v, want the reminder an hour ahead", fired)
+	}
+	var envelope struct {
+		Data events.ReminderData `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(fired[0].Payload), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Data.OffsetMinutes != 60 || envelope.Data.ToDo.ID != todo.ID || !envelope.Data.RemindAt.Equal(due.Add(-time.Hour)) {
+		t.Errorf("reminder payload %+v", envelope.Data)
+	}
+	if again := fire(now.Add(75 * time.Minute)); len(again) != 0 {
+		t.Errorf("reminder fired again: %+v", again)
+	}
+	var sent dto.ToDoResponse
+	s.must(alice, http.MethodGet, path("/api/v1/todos/%d", todo.ID), nil, http.StatusOK, &sent)
+	if sent.Reminders[1].SentAt == nil {
+		t.Errorf("fired reminder not marked sent: %+v", sent.Reminders[1])
+	}
+
+	// A new due date schedules every reminder again, including the one sent
+	later := due.Add(3 * time.Hour)
+	w := s.send(alice, http.MethodPatch, path("/api/v1/todos/%d", todo.ID), "application/merge-patch+json", fmt.Sprintf(`{"due_date": %q}`, later.Format(time.RFC3339)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("reschedule: status %d: %s", w.Code, w.Body.String())
+	}
+	var rescheduled dto.ToDoResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &rescheduled); err != nil {
+		t.Fatal(err)
+	}
+	for _, reminder := range rescheduled.Reminders {
+		if reminder.SentAt != nil || reminder.RemindAt == nil || !reminder.RemindAt.Equal(later.Add(-time.Duration(reminder.OffsetMinutes)*time.Minute)) {
+			t.Errorf("rescheduled reminder %+v", reminder)
+		}
+	}
+
+	// Completing the todo cancels its pending reminders
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", todo.ID), gin.H{"to": "done"}, http.StatusCreated, nil)
+	var done dto.ToDoResponse
+	s.must(alice, http.MethodGet, path("/api/v1/todos/%d", todo.ID), nil, http.StatusOK, &done)
+	for _, reminder := range done.Reminders {
+		if reminder.RemindAt != nil {
+			t.Errorf("reminder of a done todo still pending: %+v", reminder)
+		}
+	}
+	if fired := fire(later); len(fired) != 0 {
+		t.Errorf("reminders of a done todo fired: %+v", fired)
+	}
+
+	// The next occurrence of a recurring todo gets the same reminders
+	var recurring dto.ToDoResponse
+	s.must(alice, http.MethodPost, "/api/v1/todos", gin.H{
+		"title": "Take out the bins", "group_id": group.ID, "due_date": due, "recurrence": "FREQ=WEEKLY", "reminder_offsets": []int{15},
+	}, http.StatusCreated, &recurring)
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/transitions", recurring.ID), gin.H{"to": "done"}, http.StatusCreated, nil)
+	var page dto.ToDoPage
+	s.must(alice, http.MethodGet, path("/api/v1/todos?group_id=%d&status=pending", group.ID), nil, http.StatusOK, &page)
+	if len(page.Items) != 1 || len(page.Items[0].Reminders) != 1 || page.Items[0].Reminders[0].RemindAt == nil ||
+		!page.Items[0].Reminders[0].RemindAt.Equal(due.AddDate(0, 0, 7).Add(-15*time.Minute)) {
+		t.Errorf("next occurrence %+v", page.Items)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	s := newTestServer(t)
+	home := s.createGroup(alice, "Home")
+	s.share(alice, home.ID, bob, models.RoleEditor)
+	parent := s.createToDo(alice, home.ID, "Move house", nil)
+	var box dto.ToDoResponse
+	s.must(alice, http.MethodPost, path("/api/v1/todos/%d/subtasks", parent.ID), gin.H{"title": "Pack boxes"}, http.StatusCreated, &box)
+	later := s.createToDo(alice, home.ID, "Water the plants", nil)
+
+	trash := func(userID int) dto.TrashResponse {
+		t.Helper()
+		var trash dto.TrashResponse
+		s.must(userID, http.MethodGet, "/api/v1/trash", nil, http.StatusOK, &trash)
+		return trash
+	}
+	count := func(eventType string) int {
+		n := 0
+		for _, event := range s.store.Events() {
+			if event.EventType == eventType {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Deleting a todo puts it in the trash with its subtask, which isn't listed
+	s.must(alice, http.MethodDelete, path("/api/v1/todos/%d", parent.ID), nil, http.StatusOK, nil)
+	if w := s.do(alice, http.MethodGet, path("/api/v1/todos/%d", box.ID), nil); w.Code != http.StatusNotFound {
+		t.Errorf("deleted subtask: status %d, want 404", w.Code)
+	}
+	for _, userID := range []int{alice, bob} {
+		if got := trash(userID); len(got.ToDos) != 1 || got.ToDos[0].ID != parent.ID || got.ToDos[0].DeletedAt == nil || len(got.Groups) != 0 {
+			t.Errorf("trash of user %d is %+v, want the parent only", userID, got)
+		}
+	}
+	if got := trash(carol); len(got.ToDos) != 0 {
+		t.Errorf("stranger sees %+v in the trash", got.ToDos)
+	}
+	if w := s.do(carol, http.MethodPost, path("/api/v1/todos/%d/restore", parent.ID), nil); w.Code != http.StatusNotFound {
+		t.Errorf("stranger restoring: status %d, want 404", w.Code)
+	}
+	w := s.do(alice, http.MethodPost, path("/api/v1/todos/%d/restore", box.ID), nil)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"code":"parent_deleted"`) {
+		t.Errorf("restoring a subtask of a deleted todo: status %d, want 409 parent_deleted: %s", w.Code, w.Body.String())
+	}
+
+	// Restoring brings the subtask back, both ranked last
+	var restored dto.ToDoResponse
+	s.must(bob, http.MethodPost, path("/api/v1/todos/%d/restore", parent.ID), nil, http.StatusOK, &restored)
+	if restored.DeletedAt != nil || restored.Rank <= later.Rank || restored.Version <= parent.Version {
+		t.Errorf("restored todo %+v, want it ranked after %q", restored, later.Rank)
+	}
+	var reloaded dto.ToDoResponse
+	s.must(alice, http.MethodGet, path("/api/v1/todos/%d", parent.ID), nil, http.StatusOK, &reloaded)
+	if reloaded.Progress == nil || *reloaded.Progress != (dto.Progress{Completed: 0, Total: 1}) {
+		t.Errorf("progress of the restored todo %+v, want 0 of 1", reloaded.Progress)
+	}
+	s.must(alice, http.MethodGet, path("/api/v1/todos/%d", box.ID), nil, http.StatusOK, nil)
+	if got := trash(alice); len(got.ToDos) != 0 {
+		t.Errorf("trash after restoring %+v, want it empty", got.ToDos)
+	}
+	if w := s.do(alice, http.MethodPost, path("/api/v1/todos/%d/restore", parent.ID), nil); w.Code != http.StatusNotFound {
+		t.Errorf("restoring twice: status %d, want 404", w.Code)
+	}
+	if n := count(events.ToDoRestored); n != 2 {
+		t.Errorf("%d todo.restored events, want 2", n)
+	}
+
+	// A deleted group comes back with the todos deleted with it, but not with
+	// those deleted before
+	s.must(alice, http.MethodDelete, path("/api/v1/todos/%d", later.ID), nil, http.StatusOK, nil)
+	s.must(alice, http.MethodDelete, path("/api/v1/groups/%d", home.ID), nil, http.StatusOK, nil)
+	if w := s.do(alice, http.MethodGet, path("/api/v1/groups/%d", home.ID), nil); w.Code != http.StatusNotFound {
+		t.Errorf("deleted group: status %d, want 404", w.Code)
+	}
+	if got := trash(alice); len(got.Groups) != 1 || got.Groups[0].ID != home.ID || len(got.ToDos) != 0 {
+		t.Errorf("trash after deleting the group %+v, want only the group", got)
+	}
+	if got := trash(bob); len(got.Groups) != 0 || len(got.ToDos) != 0 {
+		t.Errorf("member sees %+v in the trash", got)
+	}
+	if w := s.do(bob, http.MethodPost, path("/api/v1/groups/%d/restore", home.ID), nil); w.Code != http.StatusNotFound {
+		t.Errorf("member restoring the group: status %d, want 404", w.Code)
+	}
+	var group dto.GroupResponse
+	s.must(alice, http.MethodPost, path("/api/v1/groups/%d/restore", home.ID), nil, http.StatusOK, &group)
+	if len(group.ToDos) != 2 || group.DeletedAt != nil {
+		t.Errorf("restored group %+v, want it back with the parent and its subtask", group)
+	}
+	if got := trash(alice); len(got.ToDos) != 1 || got.ToDos[0].ID != later.ID {
+		t.Errorf("trash after restoring the group %+v, want the todo deleted before it", got.ToDos)
+	}
+	s.must(bob, http.MethodGet, path("/api/v1/groups/%d", home.ID), nil, http.StatusOK, nil)
+	if n := count(events.GroupRestored); n != 1 {
+		t.Errorf("%d group.restored events, want 1", n)
+	}
+
+	// A group can't come back under a name that was taken in the meantime
+	s.must(alice, http.MethodDelete, path("/api/v1/groups/%d", home.ID), nil, http.StatusOK, nil)
+	s.createGroup(alice, "Home")
+	w = s.do(alice, http.MethodPost, path("/api/v1/groups/%d/restore", home.ID), nil)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"code":"group_name_taken"`) {
+		t.Errorf("restoring over a taken name: status %d, want 409 group_name_taken: %s", w.Code, w.Body.String())
+	}
+
+	// Purging deletes it for good, todos included
+	if n, err := s.store.Trash().Purge(context.Background(), time.Now().Add(-time.Hour), 10); err != nil || n != 0 {
+		t.Errorf("purging before the retention is over deleted %d: %v", n, err)
+	}
+	if n, err := s.store.Trash().Purge(context.Background(), time.Now().Add(time.Second), 10); err != nil || n != 1 {
+		t.Errorf("purge deleted %d: %v, want the group", n, err)
+	}
+	if w := s.do(alice, http.MethodPost, path("/api/v1/groups/%d/restore", home.ID), nil); w.Code != http.StatusNotFound {
+		t.Errorf("restoring a purged group: status %d, want 404", w.Code)
+	}
+	if got := trash(alice); len(got.Groups) != 0 || len(got.ToDos) != 0 {
+		t.Errorf("trash after purging %+v, want it empty", got)
+	}
+}
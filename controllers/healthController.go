@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DependencyCheck reports whether a service the API depends on is reachable
+type DependencyCheck func(ctx context.Context) error
+
+// HealthHandler serves the health endpoint from a set of named checks
+type HealthHandler struct {
+	checks map[string]DependencyCheck
+}
+
+func NewHealthHandler(checks map[string]DependencyCheck) *HealthHandler {
+	return &HealthHandler{checks: checks}
+}
+
+// HealthCheck godoc
+// @Summary      Health Check
+// @Description  Get the health status of the service and its dependencies (database, Redis and Kafka).
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Failure      503  {object}  map[string]interface{}
+// @Router       /health [get]
+func (h *HealthHandler) HealthCheck(c *gin.Context) {
+	services := gin.H{}
+
+	// Prepare response
+	response := gin.H{
+		"status":    "up",
+		"timestamp": time.Now().Format(time.RFC3339),
+		"services":  services,
+	}
+
+	statusCode := http.StatusOK
+
+	// Check each dependency and update response accordingly
+	for name, check := range h.checks {
+		services[name] = "up"
+		if err := check(c.Request.Context()); err != nil {
+			services[name] = "down"
+			response["status"] = "degraded"
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	// Send response
+	c.JSON(statusCode, response)
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/cache"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// listQuery is a parsed list request. Its JSON form identifies the query shape
+// for caching, so every field that changes the result must be serialized.
+type listQuery struct {
+	Limit         int        `json:"limit"`
+	Sort          string     `json:"sort"`
+	Cursor        string     `json:"cursor,omitempty"`
+	Status        []string   `json:"status,omitempty"`
+	GroupID       uint       `json:"group_id,omitempty"`
+	Search        string     `json:"q,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	DueAfter      *time.Time `json:"due_after,omitempty"`
+	DueBefore     *time.Time `json:"due_before,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	TagMode       string     `json:"tag_mode,omitempty"`
+
+	after *pageCursor
+	// now is only set for the smart sort
+	now *time.Time
+}
+
+// pageCursor points just past the last item of a page. It is handed to clients
+// as opaque base64 and only valid for the sort it was issued for. Now keeps
+// the time the smart sort of the first page was made at, so later pages
+// agree on which todos are overdue.
+type pageCursor struct {
+	Sort  string     `json:"s"`
+	Value string     `json:"v"`
+	ID    uint       `json:"id"`
+	Now   *time.Time `json:"now,omitempty"`
+}
+
+// parseListQuery reads limit, cursor, sort, q and the created range from the
+// query string; fields lists the sorts the endpoint supports.
+func parseListQuery(c *gin.Context, fields []string, defaultSort string) (*listQuery, *apierror.Error) {
+	q := &listQuery{
+		Limit:  defaultPageLimit,
+		Sort:   c.DefaultQuery("sort", defaultSort),
+		Cursor: c.Query("cursor"),
+		Search: strings.TrimSpace(c.Query("q")),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return nil, invalidQuery("limit", fmt.Sprintf("must be a number between 1 and %d", maxPageLimit))
+		}
+		q.Limit = n
+	}
+
+	if !containsString(fields, q.field()) {
+		return nil, invalidQuery("sort", fmt.Sprintf("must be one of %s, optionally prefixed with -", strings.Join(fields, ", ")))
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil || cursor.Sort != q.Sort {
+			return nil, invalidQuery("cursor", "is not a cursor issued for this sort")
+		}
+		q.after = cursor
+	}
+
+	var err *apierror.Error
+	if q.CreatedAfter, err = timeQuery(c, "created_after"); err != nil {
+		return nil, err
+	}
+	if q.CreatedBefore, err = timeQuery(c, "created_before"); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// parseToDoListQuery adds the todo-only filters: status, group_id, the due
+// range and tags with tag_mode. The todos of one group are listed in rank order
+// unless sorted otherwise.
+func parseToDoListQuery(c *gin.Context) (*listQuery, *apierror.Error) {
+	defaultSort := "created_at"
+	if c.Query("group_id") != "" {
+		defaultSort = "rank"
+	}
+	q, err := parseListQuery(c, repository.ToDoSortFields, defaultSort)
+	if err != nil {
+		return nil, err
+	}
+
+	if status := c.Query("status"); status != "" {
+		q.Status = strings.Split(status, ",")
+	}
+	if groupID := c.Query("group_id"); groupID != "" {
+		id, err := strconv.ParseUint(groupID, 10, 64)
+		if err != nil {
+			return nil, invalidQuery("group_id", "must be a number")
+		}
+		q.GroupID = uint(id)
+	}
+	if q.DueAfter, err = timeQuery(c, "due_after"); err != nil {
+		return nil, err
+	}
+	if q.DueBefore, err = timeQuery(c, "due_before"); err != nil {
+		return nil, err
+	}
+
+	mode := c.DefaultQuery("tag_mode", repository.TagsAll)
+	if mode != repository.TagsAll && mode != repository.TagsAny {
+		return nil, invalidQuery("tag_mode", "must be all or any")
+	}
+	for _, name := range strings.Split(c.Query("tags"), ",") {
+		if name = strings.TrimSpace(name); name != "" && !containsString(q.Tags, name) {
+			q.Tags = append(q.Tags, name)
+		}
+	}
+	if len(q.Tags) > 0 {
+		q.TagMode = mode
+	}
+
+	if q.field() == "smart" {
+		now := time.Now()
+		if q.after != nil && q.after.Now != nil {
+			now = *q.after.Now
+		}
+		q.now = &now
+	}
+	return q, nil
+}
+
+// repositoryQuery is the query handed to the repositories
+func (q *listQuery) repositoryQuery() repository.ListQuery {
+	rq := repository.ListQuery{
+		Limit:         q.Limit,
+		Sort:          q.field(),
+		Desc:          strings.HasPrefix(q.Sort, "-"),
+		Status:        q.Status,
+		GroupID:       q.GroupID,
+		Search:        q.Search,
+		CreatedAfter:  q.CreatedAfter,
+		CreatedBefore: q.CreatedBefore,
+		DueAfter:      q.DueAfter,
+		DueBefore:     q.DueBefore,
+		Tags:          q.Tags,
+		TagMode:       q.TagMode,
+	}
+	if q.after != nil {
+		rq.After = &repository.Cursor{Value: q.after.Value, ID: q.after.ID}
+	}
+	if q.now != nil {
+		rq.Now = *q.now
+	}
+	return rq
+}
+
+// nextCursor trims the extra row the repositories fetch and returns the cursor
+// for the following page, or "" on the last page.
+func (q *listQuery) nextCursor(count int, last func(i int) (string, uint)) (int, string) {
+	if count <= q.Limit {
+		return count, ""
+	}
+	value, id := last(q.Limit - 1)
+	return q.Limit, encodeCursor(pageCursor{Sort: q.Sort, Value: value, ID: id, Now: q.now})
+}
+
+// cacheable tells whether the page can be cached under its shape. The first
+// page of the smart sort can't: which todos are overdue depends on when it is
+// listed, while later pages take that time from their cursor.
+func (q *listQuery) cacheable() bool {
+	return q.now == nil || q.after != nil
+}
+
+// shape identifies the query for caching
+func (q *listQuery) shape() string {
+	data, _ := json.Marshal(q)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:12])
+}
+
+func (q *listQuery) field() string {
+	return strings.TrimPrefix(q.Sort, "-")
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(encoded string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func timeQuery(c *gin.Context, name string) (*time.Time, *apierror.Error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, invalidQuery(name, "must be an RFC 3339 timestamp")
+	}
+	return &t, nil
+}
+
+func invalidQuery(field, message string) *apierror.Error {
+	return apierror.InvalidParameters("The query parameters are invalid", apierror.FieldError{Field: field, Message: message})
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// listCacheKey names the cached page for a query shape. The per-user list
+// version is part of the key, so bumping it retires every cached page at once.
+func (d Dependencies) listCacheKey(c *gin.Context, kind string, userID int, q *listQuery) (string, error) {
+	version, err := d.Cache.Get(c.Request.Context(), listVersionKey(kind, userID))
+	if err == cache.ErrMiss {
+		version = []byte("0")
+	} else if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:list:%d:v%s:%s", kind, userID, version, q.shape()), nil
+}
+
+func listVersionKey(kind string, userID int) string {
+	return kind + ":version:" + strconv.Itoa(userID)
+}
+
+// invalidateListCaches retires the cached group and todo lists of the given users
+func (d Dependencies) invalidateListCaches(c *gin.Context, userIDs ...int) {
+	for _, userID := range userIDs {
+		for _, kind := range []string{"groups", "todos"} {
+			if _, err := d.Cache.Incr(c.Request.Context(), listVersionKey(kind, userID)); err != nil {
+				log.Printf("Error retiring the cached %s lists of user %d: %v", kind, userID, err)
+			}
+		}
+	}
+}
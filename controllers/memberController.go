@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/dto"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// GetGroupMembers godoc
+// @Summary      List group members
+// @Description  List everyone the group is shared with, including its owner. Any member may list the group's members.
+// @Tags         members
+// @Produce      json
+// @Param        id     path    string   true   "Group ID"
+// @Success      200     {array}   dto.MemberResponse   "Group members"
+// @Failure      404     {object}  apierror.Problem   "Group not found"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /groups/{id}/members [get]
+func (h *MemberHandler) GetGroupMembers(c *gin.Context) {
+	group, _, ok := h.loadPathGroup(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := h.Groups.Members(c.Request.Context(), group.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve members", err))
+		return
+	}
+
+	// The owner is implied by the group itself, so list it first
+	owner := models.GroupMember{GroupID: group.ID, UserID: group.OwnerID, Role: models.RoleOwner, CreatedAt: group.CreatedAt}
+	c.JSON(http.StatusOK, dto.NewMemberResponses(append([]models.GroupMember{owner}, members...)))
+}
+
+// AddGroupMember godoc
+// @Summary      Share a group with a user
+// @Description  Invite a user to the group with the given role (owner, editor or viewer). Only owners can manage members.
+// @Tags         members
+// @Accept       json
+// @Produce      json
+// @Param        id       path    string   true   "Group ID"
+// @Param        member   body    dto.AddMemberRequest   true   "User ID and role"
+// @Param        Idempotency-Key   header  string  false  "Key that makes retries of this request return the first response instead of running again"
+// @Success      201     {object}  dto.MemberResponse   "Created membership"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "Group not found"
+// @Failure      409     {object}  apierror.Problem   "User is already a member"
+// @Failure      422     {object}  apierror.Problem   "Invalid fields"
+// @Router       /groups/{id}/members [post]
+func (h *MemberHandler) AddGroupMember(c *gin.Context) {
+	var input dto.AddMemberRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+
+	group, _, ok := h.loadPathGroup(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	if input.UserID == group.OwnerID {
+		apierror.Abort(c, apierror.Conflict("already_member", "User is already a member of this group"))
+		return
+	}
+	if _, err := h.Groups.GetMember(c.Request.Context(), group.ID, input.UserID); err == nil {
+		apierror.Abort(c, apierror.Conflict("already_member", "User is already a member of this group"))
+		return
+	} else if err != repository.ErrNotFound {
+		apierror.Abort(c, apierror.Internal("Database error", err))
+		return
+	}
+
+	member := models.GroupMember{GroupID: group.ID, UserID: input.UserID, Role: input.Role}
+	if err := h.Groups.AddMember(c.Request.Context(), &member); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to add member", err))
+		return
+	}
+	h.invalidateGroupCaches(c, group)
+
+	c.JSON(http.StatusCreated, dto.NewMemberResponse(&member))
+}
+
+// UpdateGroupMember godoc
+// @Summary      Change a member's role
+// @Description  Change the role of a user the group is shared with. Only owners can manage members.
+// @Tags         members
+// @Accept       json
+// @Produce      json
+// @Param        id       path    string   true   "Group ID"
+// @Param        userId   path    string   true   "Member user ID"
+// @Param        role     body    dto.UpdateMemberRequest   true   "New role"
+// @Success      200     {object}  dto.MemberResponse   "Updated membership"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "Group or member not found"
+// @Failure      422     {object}  apierror.Problem   "Invalid fields"
+// @Router       /groups/{id}/members/{userId} [put]
+func (h *MemberHandler) UpdateGroupMember(c *gin.Context) {
+	var input dto.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+
+	group, _, ok := h.loadPathGroup(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+	member, ok := h.loadMember(c, group)
+	if !ok {
+		return
+	}
+
+	if err := h.Groups.UpdateMemberRole(c.Request.Context(), member, input.Role); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update member", err))
+		return
+	}
+	h.invalidateGroupCaches(c, group)
+
+	c.JSON(http.StatusOK, dto.NewMemberResponse(member))
+}
+
+// RemoveGroupMember godoc
+// @Summary      Remove a member from a group
+// @Description  Stop sharing the group with a user. Owners can remove anyone but the group's creator; members can remove themselves.
+// @Tags         members
+// @Produce      json
+// @Param        id       path    string   true   "Group ID"
+// @Param        userId   path    string   true   "Member user ID"
+// @Success      200     {object}  string   "Member removed"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "Group or member not found"
+// @Router       /groups/{id}/members/{userId} [delete]
+func (h *MemberHandler) RemoveGroupMember(c *gin.Context) {
+	group, role, ok := h.loadPathGroup(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+	member, ok := h.loadMember(c, group)
+	if !ok {
+		return
+	}
+	if member.UserID != currentUserID(c) && !models.RoleAllows(role, models.RoleOwner) {
+		apierror.Abort(c, apierror.Forbidden("owner_role_required", "Only group owners can remove other members"))
+		return
+	}
+
+	if err := h.Groups.RemoveMember(c.Request.Context(), member); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to remove member", err))
+		return
+	}
+	// The removed user's cached lists must forget the group too
+	h.invalidateGroupCaches(c, group)
+	h.invalidateListCaches(c, member.UserID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// loadMember finds the membership named by the userId path parameter. The
+// group's creator has no membership row and can't be changed or removed.
+func (h *MemberHandler) loadMember(c *gin.Context, group *models.Group) (*models.GroupMember, bool) {
+	memberID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		apierror.Abort(c, apierror.BadRequest("invalid_user_id", "Invalid user ID"))
+		return nil, false
+	}
+	if memberID == group.OwnerID {
+		apierror.Abort(c, apierror.Forbidden("group_creator_immutable", "The group's creator can't be changed or removed"))
+		return nil, false
+	}
+
+	member, err := h.Groups.GetMember(c.Request.Context(), group.ID, memberID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			apierror.Abort(c, apierror.NotFound("member_not_found", "Member not found"))
+		} else {
+			apierror.Abort(c, apierror.Internal("Database error", err))
+		}
+		return nil, false
+	}
+	return member, true
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/models"
+)
+
+// Media types PATCH requests may use
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// acceptPatch is the Accept-Patch header advertising the patch formats
+var acceptPatch = MergePatchContentType + ", " + JSONPatchContentType
+
+// applyPatch applies the request body to the JSON document original, as a
+// JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) depending on the
+// Content-Type.
+func applyPatch(c *gin.Context, original []byte) ([]byte, *apierror.Error) {
+	c.Header("Accept-Patch", acceptPatch)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, apierror.BadRequest("malformed_body", "The request body couldn't be read")
+	}
+
+	switch c.ContentType() {
+	case MergePatchContentType:
+		return mergePatch(original, body)
+
+	case JSONPatchContentType:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, apierror.BadRequest("malformed_body", "A JSON patch must be an array of operations")
+		}
+		patched, err := patch.Apply(original)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return nil, apierror.Conflict("patch_test_failed", "A test operation of the patch failed")
+		} else if err != nil {
+			return nil, apierror.Validation("The patch can't be applied: " + err.Error())
+		}
+		return patched, nil
+
+	default:
+		return nil, apierror.UnsupportedMediaType("PATCH bodies must be " + MergePatchContentType + " or " + JSONPatchContentType)
+	}
+}
+
+// mergePatch applies a JSON Merge Patch to the JSON document original
+func mergePatch(original, patch []byte) ([]byte, *apierror.Error) {
+	if !json.Valid(patch) || !bytes.HasPrefix(bytes.TrimSpace(patch), []byte("{")) {
+		return nil, apierror.BadRequest("malformed_body", "A merge patch must be a JSON object")
+	}
+	patched, err := jsonpatch.MergePatch(original, patch)
+	if err != nil {
+		return nil, apierror.BadRequest("malformed_body", "The merge patch couldn't be applied")
+	}
+	return patched, nil
+}
+
+// decodePatched decodes a patched document into a request and validates it
+// like a PUT body. Fields the request doesn't have can't be patched.
+func decodePatched(data []byte, out interface{}) *apierror.Error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return invalidField(strings.Trim(field, `"`), "can't be changed")
+		}
+		return apierror.FromBinding(err)
+	}
+	if err := binding.Validator.ValidateStruct(out); err != nil {
+		return apierror.FromBinding(err)
+	}
+	return nil
+}
+
+// diffFields compares the JSON forms of two requests field by field
+func diffFields(before, after interface{}) models.ChangeSet {
+	from, to := jsonFields(before), jsonFields(after)
+	changes := models.ChangeSet{}
+	for field, value := range to {
+		if !reflect.DeepEqual(from[field], value) {
+			changes[field] = models.FieldChange{From: from[field], To: value}
+		}
+	}
+	for field, value := range from {
+		if _, ok := to[field]; !ok {
+			changes[field] = models.FieldChange{From: value, To: nil}
+		}
+	}
+	return changes
+}
+
+func jsonFields(v interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	data, err := json.Marshal(v)
+	if err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	return fields
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/dto"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/recurrence"
+	"github.com/pmas98/go-todo-service/repository"
+	"github.com/pmas98/go-todo-service/workflow"
+)
+
+// SkipOccurrence godoc
+// @Summary      Skip an occurrence of a recurring ToDo
+// @Description  Move a recurring ToDo on to the next occurrence of its series without completing it. Requires the editor or owner role in its group.
+// @Tags         todos
+// @Produce      json
+// @Param        id     path    string   true   "ToDo ID"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  dto.ToDoResponse   "ToDo due at its next occurrence"
+// @Header       200     {string}  ETag   "Version of the ToDo"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      409     {object}  apierror.Problem   "The ToDo doesn't recur, or this is the last occurrence"
+// @Failure      412     {object}  apierror.Problem   "ToDo changed since the If-Match ETag"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Router       /todos/{id}/skip [post]
+func (h *ToDoHandler) SkipOccurrence(c *gin.Context) {
+	todo, group, ok := h.loadEditableToDo(c)
+	if !ok {
+		return
+	}
+	if todo.Recurrence == "" {
+		apierror.Abort(c, apierror.Conflict("not_recurring", "The todo doesn't recur"))
+		return
+	}
+	due, ok, problem := nextDue(todo)
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
+	if !ok {
+		apierror.Abort(c, apierror.Conflict("last_occurrence", "This is the last occurrence of the series; complete it or stop recurring instead"))
+		return
+	}
+
+	changes := models.ChangeSet{"due_date": {From: todo.DueDate, To: &due}}
+	todo.DueDate = &due
+	if err := h.Todos.Update(c.Request.Context(), todo, changes, currentUserID(c)); err != nil {
+		apierror.Abort(c, writeConflict(c, err, "Failed to update todo"))
+		return
+	}
+	h.invalidateToDoCaches(c, todo)
+	h.invalidateGroupCaches(c, group)
+	respondVersioned(c, http.StatusOK, todo.Version, dto.NewToDoResponse(todo))
+}
+
+// StopRecurring godoc
+// @Summary      Stop a ToDo from recurring
+// @Description  End the series of a recurring ToDo with this occurrence, which stays as it is otherwise. Stopping a ToDo that doesn't recur changes nothing. Requires the editor or owner role in its group.
+// @Tags         todos
+// @Produce      json
+// @Param        id     path    string   true   "ToDo ID"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  dto.ToDoResponse   "ToDo that no longer recurs"
+// @Header       200     {string}  ETag   "Version of the ToDo"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      412     {object}  apierror.Problem   "ToDo changed since the If-Match ETag"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Router       /todos/{id}/recurrence [delete]
+func (h *ToDoHandler) StopRecurring(c *gin.Context) {
+	todo, group, ok := h.loadEditableToDo(c)
+	if !ok {
+		return
+	}
+	if todo.Recurrence != "" {
+		changes := models.ChangeSet{}
+		endRecurrence(todo, changes)
+		if err := h.Todos.Update(c.Request.Context(), todo, changes, currentUserID(c)); err != nil {
+			apierror.Abort(c, writeConflict(c, err, "Failed to update todo"))
+			return
+		}
+		h.invalidateToDoCaches(c, todo)
+		h.invalidateGroupCaches(c, group)
+	}
+	respondVersioned(c, http.StatusOK, todo.Version, dto.NewToDoResponse(todo))
+}
+
+// validateRecurrence checks the recurrence of a todo request and puts its rule
+// in canonical form. A recurring todo needs a due date to start from and
+// can't be a subtask. The timezone defaults to UTC and is dropped without a
+// recurrence.
+func validateRecurrence(input *dto.ToDoRequest) *apierror.Error {
+	if input.Recurrence == "" {
+		input.Timezone = ""
+		return nil
+	}
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+	if _, err := recurrence.LoadLocation(input.Timezone); err != nil {
+		return invalidField("timezone", "must be an IANA timezone like Europe/Berlin")
+	}
+	rule, err := recurrence.Normalize(input.Recurrence, input.Timezone)
+	if err != nil {
+		reason := strings.TrimPrefix(err.Error(), recurrence.ErrInvalid.Error()+": ")
+		return invalidField("recurrence", "must be an RFC 5545 RRULE: "+reason)
+	}
+	input.Recurrence = rule
+	if input.DueDate == nil {
+		return invalidField("due_date", "is required for a recurring todo")
+	}
+	if input.ParentID != nil {
+		return invalidField("recurrence", "a subtask can't recur")
+	}
+	return nil
+}
+
+// restartRecurrence anchors the series of todo at its due date again, after
+// its rule or timezone changed
+func restartRecurrence(todo *models.ToDo, changes models.ChangeSet) {
+	start := todo.DueDate
+	if todo.Recurrence == "" {
+		start = nil
+	}
+	changes["recurrence_start"] = models.FieldChange{From: todo.RecurrenceStart, To: start}
+	todo.RecurrenceStart = start
+}
+
+// endRecurrence takes the recurrence off todo
+func endRecurrence(todo *models.ToDo, changes models.ChangeSet) {
+	changes["recurrence"] = models.FieldChange{From: todo.Recurrence, To: ""}
+	changes["timezone"] = models.FieldChange{From: todo.Timezone, To: ""}
+	changes["recurrence_start"] = models.FieldChange{From: todo.RecurrenceStart, To: nil}
+	todo.Recurrence, todo.Timezone, todo.RecurrenceStart = "", "", nil
+}
+
+// completeOccurrence hands the recurrence of a todo being completed over to
+// the occurrence that follows it, which is returned unsaved with initial as
+// its status, or to none if the series ends with the todo. The changes to
+// the todo are added to changes.
+func completeOccurrence(todo *models.ToDo, initial string, changes models.ChangeSet) (*models.ToDo, *apierror.Error) {
+	due, ok, problem := nextDue(todo)
+	if problem != nil {
+		return nil, problem
+	}
+	if todo.SeriesID == nil {
+		id := todo.ID
+		changes["series_id"] = models.FieldChange{From: nil, To: id}
+		todo.SeriesID = &id
+	}
+	var next *models.ToDo
+	if ok {
+		next = &models.ToDo{
+			Title:           todo.Title,
+			Status:          initial,
+			GroupID:         todo.GroupID,
+			OwnerID:         todo.OwnerID,
+			DueDate:         &due,
+			Priority:        todo.Priority,
+			EstimateMinutes: todo.EstimateMinutes,
+			Recurrence:      todo.Recurrence,
+			Timezone:        todo.Timezone,
+			RecurrenceStart: todo.RecurrenceStart,
+			SeriesID:        todo.SeriesID,
+			Tags:            append([]models.Tag{}, todo.Tags...),
+			Reminders:       nextReminders(todo.Reminders),
+		}
+	}
+	endRecurrence(todo, changes)
+	return next, nil
+}
+
+// nextReminders gives the next occurrence reminders at the same offsets
+func nextReminders(reminders []models.Reminder) []models.Reminder {
+	next := make([]models.Reminder, len(reminders))
+	for i, reminder := range reminders {
+		next[i] = models.Reminder{OffsetMinutes: reminder.OffsetMinutes}
+	}
+	return next
+}
+
+// saveCompletion saves the changes to todo, and next, the occurrence that
+// follows it if it was completed, in one transaction
+func saveCompletion(ctx context.Context, todos repository.TodoRepository, todo *models.ToDo, changes models.ChangeSet, next *models.ToDo, userID int) error {
+	if next == nil {
+		return todos.Update(ctx, todo, changes, userID)
+	}
+	return todos.Transaction(ctx, func(todos repository.TodoRepository) error {
+		if err := todos.Update(ctx, todo, changes, userID); err != nil {
+			return err
+		}
+		return todos.Create(ctx, next, userID)
+	})
+}
+
+// completesOccurrence reports whether a status change completes an occurrence
+// of a recurring todo, by moving it into one of the workflow's complete statuses
+func completesOccurrence(w *workflow.Workflow, todo *models.ToDo, from string) bool {
+	return todo.Recurrence != "" && w.Completes(todo.Status) && !w.Completes(from)
+}
+
+// nextDue is when the occurrence after todo is due, or false if there is none
+func nextDue(todo *models.ToDo) (time.Time, bool, *apierror.Error) {
+	if todo.DueDate == nil {
+		return time.Time{}, false, nil
+	}
+	start := todo.RecurrenceStart
+	if start == nil {
+		start = todo.DueDate
+	}
+	rule, err := recurrence.New(todo.Recurrence, todo.Timezone, *start)
+	if err != nil {
+		return time.Time{}, false, apierror.Internal("Failed to expand the recurrence", err)
+	}
+	due, ok := rule.Next(*todo.DueDate)
+	return due, ok, nil
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/dto"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// GetSubtasks godoc
+// @Summary      List the subtasks of a ToDo
+// @Description  Get the direct subtasks of a ToDo in rank order. Subtasks are ToDos of their own and can have subtasks in turn, up to three levels in all.
+// @Tags         todos
+// @Produce      json
+// @Param        id     path    string   true   "ToDo ID"
+// @Success      200     {array}   dto.ToDoResponse   "Subtasks"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /todos/{id}/subtasks [get]
+func (h *ToDoHandler) GetSubtasks(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, todoNotFound())
+		return
+	}
+	todo, ok := h.loadToDo(c, id)
+	if !ok {
+		return
+	}
+	if _, ok := h.loadToDoGroup(c, todo, models.RoleViewer); !ok {
+		return
+	}
+
+	subtasks, err := h.Todos.Subtasks(c.Request.Context(), todo.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve subtasks", err))
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewToDoResponses(subtasks))
+}
+
+// CreateSubtask godoc
+// @Summary      Add a subtask to a ToDo
+// @Description  Create a ToDo as a subtask of another one, in the same group and last in rank order. The parent's progress counts its subtasks and how many of them are closed; it can't be closed itself while any are open, and deleting it deletes them. Requires the editor or owner role in the group.
+// @Tags         todos
+// @Accept       json
+// @Produce      json
+// @Param        id        path    string               true   "Parent ToDo ID"
+// @Param        subtask   body    dto.SubtaskRequest   true   "Subtask to be created"
+// @Param        Idempotency-Key   header  string  false  "Key that makes retries of this request return the first response instead of running again"
+// @Success      201     {object}  dto.ToDoResponse   "Created subtask"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      409     {object}  apierror.Problem   "The parent was deleted in the meantime"
+// @Failure      422     {object}  apierror.Problem   "Invalid fields or subtasks nested too deep"
+// @Router       /todos/{id}/subtasks [post]
+func (h *ToDoHandler) CreateSubtask(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, todoNotFound())
+		return
+	}
+	var input dto.SubtaskRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+	parent, ok := h.loadToDo(c, id)
+	if !ok {
+		return
+	}
+	if _, ok := h.loadToDoGroup(c, parent, models.RoleEditor); !ok {
+		return
+	}
+
+	request := dto.ToDoRequest{
+		Title:    input.Title,
+		Status:   input.Status,
+		GroupID:  parent.GroupID,
+		DueDate:  input.DueDate,
+		ParentID: &parent.ID,
+	}
+	todo, group, problem := h.createToDo(c.Request.Context(), h.Todos, currentUserID(c), &request)
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
+	h.invalidateToDoCaches(c, todo)
+	h.invalidateGroupCaches(c, group)
+	respondVersioned(c, http.StatusCreated, todo.Version, dto.NewToDoResponse(todo))
+}
+
+// checkParent checks the parent a todo is getting: another todo of the same
+// group, none of the todo's own subtasks, and high enough in its tree for the
+// todo and the subtasks it brings along to fit under it.
+func checkParent(ctx context.Context, todos repository.TodoRepository, todo *models.ToDo) *apierror.Error {
+	if todo.ParentID == nil {
+		return nil
+	}
+	depth := 0
+	for id := todo.ParentID; id != nil; depth++ {
+		ancestor, err := todos.Get(ctx, *id)
+		if err == repository.ErrNotFound || err == nil && depth == 0 && ancestor.GroupID != todo.GroupID {
+			return invalidField("parent_id", "must be a todo in the same group")
+		} else if err != nil {
+			return apierror.Internal("Failed to retrieve todo", err)
+		}
+		if ancestor.ID == todo.ID {
+			return invalidField("parent_id", "can't be the todo itself or one of its subtasks")
+		}
+		id = ancestor.ParentID
+	}
+
+	levels, problem := subtaskLevels(ctx, todos, todo)
+	if problem != nil {
+		return problem
+	}
+	if depth+1+levels > models.MaxToDoDepth {
+		return invalidField("parent_id", fmt.Sprintf("is too deep: subtasks nest at most %d levels", models.MaxToDoDepth))
+	}
+	return nil
+}
+
+// subtaskLevels counts the levels of subtasks below todo
+func subtaskLevels(ctx context.Context, todos repository.TodoRepository, todo *models.ToDo) (int, *apierror.Error) {
+	levels := 0
+	for parents := []models.ToDo{*todo}; ; levels++ {
+		var next []models.ToDo
+		for i := range parents {
+			if parents[i].SubtasksTotal == 0 {
+				continue
+			}
+			subtasks, err := todos.Subtasks(ctx, parents[i].ID)
+			if err != nil {
+				return 0, apierror.Internal("Failed to retrieve subtasks", err)
+			}
+			next = append(next, subtasks...)
+		}
+		if len(next) == 0 {
+			return levels, nil
+		}
+		parents = next
+	}
+}
+
+// checkSubtasksClosed keeps a todo from being closed while some of its
+// subtasks are still open
+func checkSubtasksClosed(todo *models.ToDo, from string) *apierror.Error {
+	open := todo.SubtasksTotal - todo.SubtasksClosed
+	if open == 0 || !models.IsClosed(todo.Status) || models.IsClosed(from) {
+		return nil
+	}
+	return apierror.Conflict("open_subtasks", fmt.Sprintf("The todo has %d open subtasks; close them first", open)).
+		With("open_subtasks", open)
+}
+
+// checkGroupChange keeps todos in the group of their parent and subtasks
+func checkGroupChange(todo *models.ToDo) *apierror.Error {
+	if todo.SubtasksTotal > 0 {
+		return hasSubtasks()
+	}
+	if todo.ParentID != nil {
+		return invalidField("group_id", "a subtask stays in the group of its parent")
+	}
+	return nil
+}
+
+func hasSubtasks() *apierror.Error {
+	return apierror.Conflict("has_subtasks", "A todo with subtasks can't change groups; move or delete its subtasks first")
+}
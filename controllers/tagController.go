@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/dto"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// GetTags godoc
+// @Summary      List tags
+// @Description  List the caller's tags by name.
+// @Tags         tags
+// @Produce      json
+// @Success      200     {array}   dto.TagResponse   "Tags"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /tags [get]
+func (h *TagHandler) GetTags(c *gin.Context) {
+	tags, err := h.Tags.List(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve tags", err))
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewTagResponses(tags))
+}
+
+// GetTag godoc
+// @Summary      Retrieve a tag by ID
+// @Description  Get one of the caller's tags.
+// @Tags         tags
+// @Produce      json
+// @Param        id     path    string   true   "Tag ID"
+// @Success      200     {object}  dto.TagResponse   "Tag"
+// @Failure      404     {object}  apierror.Problem   "Tag not found"
+// @Router       /tags/{id} [get]
+func (h *TagHandler) GetTag(c *gin.Context) {
+	tag, ok := h.loadPathTag(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewTagResponse(tag))
+}
+
+// CreateTag godoc
+// @Summary      Create a tag
+// @Description  Create a tag the caller can put on any ToDo they may edit, whatever its group. Tag names are unique per user.
+// @Tags         tags
+// @Accept       json
+// @Produce      json
+// @Param        tag   body   dto.TagRequest   true   "Tag to be created"
+// @Param        Idempotency-Key   header  string  false  "Key that makes retries of this request return the first response instead of running again"
+// @Success      201     {object}  dto.TagResponse   "Created tag"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      409     {object}  apierror.Problem   "Tag with this name already exists"
+// @Failure      422     {object}  apierror.Problem   "Invalid fields"
+// @Router       /tags [post]
+func (h *TagHandler) CreateTag(c *gin.Context) {
+	var input dto.TagRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+	tag := models.Tag{OwnerID: currentUserID(c), Name: string(input.Name), Color: models.DefaultTagColor}
+	if input.Color != "" {
+		tag.Color = strings.ToLower(input.Color)
+	}
+	if !h.checkTagName(c, &tag) {
+		return
+	}
+
+	if err := h.Tags.Create(c.Request.Context(), &tag); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to create tag", err))
+		return
+	}
+	c.JSON(http.StatusCreated, dto.NewTagResponse(&tag))
+}
+
+// UpdateTag godoc
+// @Summary      Update a tag by ID
+// @Description  Rename one of the caller's tags or change its color. The ToDos it is on show the change at once, and their ETags change with it.
+// @Tags         tags
+// @Accept       json
+// @Produce      json
+// @Param        id    path    string           true   "Tag ID"
+// @Param        tag   body    dto.TagRequest   true   "New name and color"
+// @Success      200     {object}  dto.TagResponse   "Updated tag"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      404     {object}  apierror.Problem   "Tag not found"
+// @Failure      409     {object}  apierror.Problem   "Tag with this name already exists"
+// @Failure      422     {object}  apierror.Problem   "Invalid fields"
+// @Router       /tags/{id} [put]
+func (h *TagHandler) UpdateTag(c *gin.Context) {
+	var input dto.TagRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+	tag, ok := h.loadPathTag(c)
+	if !ok {
+		return
+	}
+	updated := *tag
+	updated.Name = string(input.Name)
+	if input.Color != "" {
+		updated.Color = strings.ToLower(input.Color)
+	}
+	if updated == *tag {
+		c.JSON(http.StatusOK, dto.NewTagResponse(tag))
+		return
+	}
+	if updated.Name != tag.Name && !h.checkTagName(c, &updated) {
+		return
+	}
+
+	todos, err := h.Tags.Update(c.Request.Context(), &updated)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to update tag", err))
+		return
+	}
+	h.invalidateTaggedCaches(c, todos)
+	c.JSON(http.StatusOK, dto.NewTagResponse(&updated))
+}
+
+// DeleteTag godoc
+// @Summary      Delete a tag by ID
+// @Description  Delete one of the caller's tags, taking it off every ToDo it is on.
+// @Tags         tags
+// @Produce      json
+// @Param        id     path    string   true   "Tag ID"
+// @Success      204     "Tag deleted"
+// @Failure      404     {object}  apierror.Problem   "Tag not found"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /tags/{id} [delete]
+func (h *TagHandler) DeleteTag(c *gin.Context) {
+	tag, ok := h.loadPathTag(c)
+	if !ok {
+		return
+	}
+	todos, err := h.Tags.Delete(c.Request.Context(), tag)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to delete tag", err))
+		return
+	}
+	h.invalidateTaggedCaches(c, todos)
+	c.Status(http.StatusNoContent)
+}
+
+// loadPathTag loads the caller's tag named by the id path parameter. Other
+// users' tags are reported as not found.
+func (h *TagHandler) loadPathTag(c *gin.Context) (*models.Tag, bool) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, tagNotFound())
+		return nil, false
+	}
+	tag, err := h.Tags.Get(c.Request.Context(), id)
+	if err == repository.ErrNotFound || err == nil && tag.OwnerID != currentUserID(c) {
+		apierror.Abort(c, tagNotFound())
+		return nil, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve tag", err))
+		return nil, false
+	}
+	return tag, true
+}
+
+// checkTagName makes sure the owner has no other tag with the tag's name
+func (h *TagHandler) checkTagName(c *gin.Context, tag *models.Tag) bool {
+	if _, err := h.Tags.FindByName(c.Request.Context(), tag.OwnerID, tag.Name); err == nil {
+		apierror.Abort(c, apierror.Conflict("tag_name_taken", "Tag with this name already exists"))
+		return false
+	} else if err != repository.ErrNotFound {
+		apierror.Abort(c, apierror.Internal("Database error", err))
+		return false
+	}
+	return true
+}
+
+// invalidateTaggedCaches drops the cached todos a changed tag is on, and
+// their groups
+func (h *TagHandler) invalidateTaggedCaches(c *gin.Context, todos []models.ToDo) {
+	if len(todos) == 0 {
+		return
+	}
+	h.invalidateToDoCaches(c, toDoRefs(todos)...)
+	var groups []*models.Group
+	seen := map[uint]bool{}
+	for _, todo := range todos {
+		if seen[todo.GroupID] {
+			continue
+		}
+		seen[todo.GroupID] = true
+		if group, err := h.Groups.Get(c.Request.Context(), todo.GroupID, false); err == nil {
+			groups = append(groups, group)
+		}
+	}
+	h.invalidateGroupCaches(c, groups...)
+}
+
+// checkTags loads the tags todo is getting in place of previous. The caller
+// may keep tags others put on the todo, but only add tags of their own.
+func (d Dependencies) checkTags(ctx context.Context, userID int, todo *models.ToDo, previous []models.Tag) *apierror.Error {
+	ids := make([]uint, len(todo.Tags))
+	for i, tag := range todo.Tags {
+		ids[i] = tag.ID
+	}
+	tags, err := d.Tags.GetMany(ctx, ids)
+	if err != nil {
+		return apierror.Internal("Failed to retrieve tags", err)
+	}
+	if len(tags) != len(ids) {
+		return invalidField("tag_ids", "must be tags of yours")
+	}
+	for _, tag := range tags {
+		if tag.OwnerID != userID && !hasTag(previous, tag.ID) {
+			return invalidField("tag_ids", "must be tags of yours")
+		}
+	}
+	todo.Tags = tags
+	return nil
+}
+
+func hasTag(tags []models.Tag, id uint) bool {
+	for _, tag := range tags {
+		if tag.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func tagNotFound() *apierror.Error {
+	return apierror.NotFound("tag_not_found", "Tag not found")
+}
@@ -3,500 +3,820 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
-	"github.com/jinzhu/gorm"
-	"github.com/pmas98/go-todo-service/config"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/cache"
+	"github.com/pmas98/go-todo-service/dto"
 	"github.com/pmas98/go-todo-service/models"
-	"github.com/pmas98/go-todo-service/utils"
+	"github.com/pmas98/go-todo-service/repository"
 )
 
-var db *gorm.DB
-var rdb *redis.Client
-var ctx context.Context
-
-func init() {
-	config.Connect()
-	db = config.GetDB()
-	rdb = config.GetRedis()
-	ctx = config.GetContext()
-	models.AutoMigrate(db)
-
-	// Initialize Kafka producer
-	err := utils.InitKafkaProducer()
-	if err != nil {
-		panic(err) // Handle error appropriately in your application startup
-	}
-}
-
-// HealthCheck godoc
-// @Summary      Health Check
-// @Description  Get the health status of the service and its dependencies (database and Redis).
-// @Tags         health
+// GetToDos godoc
+// @Summary      Retrieve ToDos
+// @Description  Get a page of the ToDos in groups shared with the caller, filtered and sorted as requested. Pages are cached in Redis per query, except the first page of the smart sort, which depends on the current time.
+// @Tags         todos
 // @Produce      json
-// @Success      200  {object}  map[string]interface{}
-// @Failure      503  {object}  map[string]interface{}
-// @Router       /health [get]
-func HealthCheck(c *gin.Context) {
-	// Check database connection
-	dbErr := db.DB().Ping()
-
-	kafkaErr := utils.SendMessageToKafka("test-topic", "Ping request!", "ping")
-
-	// Check Redis connection
-	redisErr := rdb.Ping(ctx).Err()
-
-	// Prepare response
-	response := gin.H{
-		"status":    "up",
-		"timestamp": time.Now().Format(time.RFC3339),
-		"services": gin.H{
-			"database": "up",
-			"redis":    "up",
-			"kafka":    "up",
-		},
-	}
-
-	statusCode := http.StatusOK
-
-	// Check for errors and update response accordingly
-	if dbErr != nil {
-		response["services"].(gin.H)["database"] = "down"
-		response["status"] = "degraded"
-		statusCode = http.StatusServiceUnavailable
-	}
-
-	if kafkaErr != nil {
-		response["services"].(gin.H)["kafka"] = "down"
-		response["status"] = "degraded"
-		statusCode = http.StatusServiceUnavailable
-	}
-
-	if redisErr != nil {
-		response["services"].(gin.H)["redis"] = "down"
-		response["status"] = "degraded"
-		statusCode = http.StatusServiceUnavailable
+// @Param        limit            query  int     false  "Page size (default 50, max 200)"
+// @Param        cursor           query  string  false  "Cursor from the previous page's next_cursor"
+// @Param        sort             query  string  false  "created_at, due_date, title, rank, smart or id, prefixed with - for descending (default rank with group_id, created_at otherwise). smart puts overdue ToDos first, then orders by priority, due date and rank"
+// @Param        status           query  string  false  "Comma-separated statuses to include"
+// @Param        group_id         query  int     false  "Only ToDos in this group"
+// @Param        q                query  string  false  "Case-insensitive substring of the title"
+// @Param        created_after    query  string  false  "Only ToDos created at or after this RFC 3339 time"
+// @Param        created_before   query  string  false  "Only ToDos created before this RFC 3339 time"
+// @Param        due_after        query  string  false  "Only ToDos due at or after this RFC 3339 time"
+// @Param        due_before       query  string  false  "Only ToDos due before this RFC 3339 time"
+// @Param        tags             query  string  false  "Comma-separated names of the caller's tags the ToDos must have"
+// @Param        tag_mode         query  string  false  "all to require every tag in tags, any to require one of them (default all)"
+// @Success      200     {object}  dto.ToDoPage   "Page of ToDos"
+// @Failure      400     {object}  apierror.Problem   "Bad Request"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /todos [get]
+func (h *ToDoHandler) GetToDos(c *gin.Context) {
+	userID := currentUserID(c)
+	q, problem := parseToDoListQuery(c)
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return
 	}
 
-	// Send response
-	c.JSON(statusCode, response)
-}
-
-func CreateTopic(c *gin.Context) {
-	type TopicInput struct {
-		TopicName string `json:"topicName" binding:"required"`
+	// A smart-sorted first page depends on the time it is listed at, so it
+	// isn't cached; later pages carry that time in their cursor
+	if !q.cacheable() {
+		if page, ok := h.listToDos(c, userID, q); ok {
+			c.JSON(http.StatusOK, page)
+		}
+		return
 	}
-	var input TopicInput
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	cacheKey, err := h.listCacheKey(c, "todos", userID, q)
+	if err != nil {
+		apierror.Abort(c, cacheUnavailable(err))
 		return
 	}
 
-	utils.InitKafkaAdmin()
-	utils.CreateKafkaTopic(input.TopicName, 1, 1)
-
-	c.JSON(http.StatusCreated, gin.H{"sucess": "New topic created"})
-}
+	var page dto.ToDoPage
 
-// GetGroups godoc
-// @Summary      Retrieve all groups
-// @Description  Get the list of all groups, including their associated ToDos. This endpoint first tries to fetch data from the Redis cache; if not available, it queries the database and caches the result.
-// @Tags         groups
-// @Produce      json
-// @Success      200  {array}   models.Group
-// @Failure      500  {object}  map[string]interface{}
-// @Router       /groups [get]
-func GetGroups(c *gin.Context) {
-	var groups []models.Group
-
-	// Try to get groups from Redis cache
-	result, err := rdb.Get(ctx, "groups:all").Result()
-	if err == redis.Nil {
+	// Try to get the page from Redis cache
+	result, err := h.Cache.Get(c.Request.Context(), cacheKey)
+	if err == cache.ErrMiss {
 		// If not in cache, query the database
-		if err := db.Preload("ToDos").Find(&groups).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve groups"})
+		loaded, ok := h.listToDos(c, userID, q)
+		if !ok {
 			return
 		}
+		page = *loaded
 
 		// Cache the result
-		data, err := json.Marshal(groups)
+		data, err := json.Marshal(page)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal groups"})
+			apierror.Abort(c, apierror.Internal("Failed to marshal todos", err))
 			return
 		}
-		rdb.Set(ctx, "groups:all", data, 5*time.Minute)
+		// The page is good even if it can't be cached
+		if err := h.Cache.Set(c.Request.Context(), cacheKey, data, h.ListTTL); err != nil {
+			log.Printf("Error caching todos: %v", err)
+		}
 	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Redis error: " + err.Error()})
+		apierror.Abort(c, cacheUnavailable(err))
 		return
 	} else {
 		// If found in cache, unmarshal the data
-		if err := json.Unmarshal([]byte(result), &groups); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmarshal groups"})
+		if err := json.Unmarshal(result, &page); err != nil {
+			apierror.Abort(c, apierror.Internal("Failed to unmarshal todos", err))
 			return
 		}
 	}
 
-	c.JSON(http.StatusOK, groups)
+	c.JSON(http.StatusOK, page)
 }
 
-// GetGroup godoc
-// @Summary      Retrieve a group by ID
-// @Description  Get details of a specific group, including its associated ToDos. This endpoint first tries to fetch data from the Redis cache; if not available, it queries the database and caches the result.
-// @Tags         groups
-// @Produce      json
-// @Param        id    path      string                       true  "Group ID"
-// @Success      200   {object}  models.Group
-// @Failure      404   {object}  map[string]interface{}       "Group not found"
-// @Failure      500   {object}  map[string]interface{}       "Internal Server Error"
-// @Router       /groups/{id} [get]
-func GetGroup(c *gin.Context) {
-	id := c.Param("id")
-
-	var group models.Group
-
-	// Try to get the group from Redis cache
-	result, err := rdb.Get(ctx, "group:"+id).Result()
+// listToDos loads a page of todos from the database, aborting on failure
+func (h *ToDoHandler) listToDos(c *gin.Context, userID int, q *listQuery) (*dto.ToDoPage, bool) {
+	rq := q.repositoryQuery()
+	todos, err := h.Todos.List(c.Request.Context(), userID, rq)
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		apierror.Abort(c, invalidQuery("cursor", "is not a cursor issued for this sort"))
+		return nil, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve todos", err))
+		return nil, false
+	}
+	count, next := q.nextCursor(len(todos), func(i int) (string, uint) {
+		return repository.ToDoSortValue(&todos[i], rq), todos[i].ID
+	})
+	return &dto.ToDoPage{Items: dto.NewToDoResponses(todos[:count]), NextCursor: next}, true
+}
 
+// GetToDosById godoc
+// @Summary      Retrieve a ToDo by ID
+// @Description  Get details of a specific ToDo identified by its ID. This endpoint first tries to fetch data from the Redis cache; if not available, it queries the database and caches the result. The ETag is the version of the ToDo.
+// @Tags         todos
+// @Produce      json
+// @Param        id     path    string   true   "ToDo ID"
+// @Param        If-None-Match   header  string  false  "ETag from an earlier response; answered with 304 if still current"
+// @Success      200     {object}  dto.ToDoResponse   "ToDo details"
+// @Header       200     {string}  ETag   "Version of the ToDo"
+// @Success      304     "Not modified"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /todos/{id} [get]
+func (h *ToDoHandler) GetToDosById(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, todoNotFound())
+		return
+	}
+	var todo models.ToDo
+	result, err := h.Cache.Get(c.Request.Context(), todoCacheKey(id))
 	if err == nil {
 		// Found in cache, unmarshal and return
-		if err := json.Unmarshal([]byte(result), &group); err == nil {
-			c.JSON(http.StatusOK, group)
+		if err := json.Unmarshal(result, &todo); err == nil {
+			if _, ok := h.loadToDoGroup(c, &todo, models.RoleViewer); ok {
+				respondVersioned(c, http.StatusOK, todo.Version, dto.NewToDoResponse(&todo))
+			}
 			return
 		}
-		// If unmarshaling fails, we'll fall through to querying the database
-	} else if err != redis.Nil {
-		// An error occurred that wasn't just a cache miss
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Redis error: " + err.Error()})
+	} else if err != cache.ErrMiss {
+		apierror.Abort(c, cacheUnavailable(err))
 		return
 	}
 
 	// Not found in cache or error occurred, query the database
-	if err := db.Preload("ToDos").First(&group, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group"})
-		}
+	loaded, ok := h.loadToDo(c, id)
+	if !ok {
+		return
+	}
+	if _, ok := h.loadToDoGroup(c, loaded, models.RoleViewer); !ok {
 		return
 	}
+	todo = *loaded
 
-	// Cache the group for future requests
-	groupJSON, err := json.Marshal(group)
+	// Cache the todo for future requests
+	todoJSON, err := json.Marshal(todo)
 	if err == nil {
-		rdb.Set(ctx, "group:"+id, groupJSON, time.Hour) // Cache for 1 hour
+		if err := h.Cache.Set(c.Request.Context(), todoCacheKey(id), todoJSON, h.ItemTTL); err != nil {
+			log.Printf("Error caching todo %d: %v", id, err)
+		}
 	}
 
-	c.JSON(http.StatusOK, group)
+	respondVersioned(c, http.StatusOK, todo.Version, dto.NewToDoResponse(&todo))
 }
 
-// CreateGroup godoc
-// @Summary      Create a new group
-// @Description  Create a new group with the provided JSON data.
-// @Tags         groups
-// @Accept       json
+// GetToDosByDate godoc
+// @Summary      Retrieve ToDos by due date
+// @Description  Get a list of ToDos that have a due date falling on the specified day in the caller's timezone.
+// @Tags         todos
 // @Produce      json
-// @Param        group   body   models.Group   true   "Group object to be created"
-// @Success      201     {object}        models.Group   "Created group"
-// @Failure      400     {object}        map[string]interface{}   "Bad Request"
-// @Router       /groups [post]
-func CreateGroup(c *gin.Context) {
-	var group models.Group
-	if err := c.ShouldBindJSON(&group); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// @Param        date   path   string   true   "Due date (format: YYYY-MM-DD)"
+// @Param        tz     query  string   false  "IANA timezone of the caller, overrides the X-Timezone header (default UTC)"
+// @Success      200     {array}  dto.ToDoResponse   "List of ToDos"
+// @Failure      400     {object}  apierror.Problem   "Bad Request"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /todos/date/{date} [get]
+func (h *ToDoHandler) GetToDosByDate(c *gin.Context) {
+	loc, ok := callerLocation(c)
+	if !ok {
 		return
 	}
-
-	var existingGroup models.Group
-	if err := db.Where("name = ?", group.Name).First(&existingGroup).Error; err == nil {
-		// If group with the same name exists, return a 409 Conflict error
-		c.JSON(http.StatusConflict, gin.H{"error": "Group with this name already exists"})
-		return
-	} else if err != gorm.ErrRecordNotFound {
-		// For other errors, return a 500 Internal Server Error
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	day, err := time.ParseInLocation("2006-01-02", c.Param("date"), loc)
+	if err != nil {
+		apierror.Abort(c, apierror.InvalidParameters("The path parameters are invalid", apierror.FieldError{Field: "date", Message: "must use the YYYY-MM-DD format"}))
 		return
 	}
 
-	db.Create(&group)
-	rdb.Del(ctx, "groups:all")
-	c.JSON(http.StatusCreated, group)
+	// AddDate keeps the day boundaries right across DST changes
+	h.listDue(c, repository.DueRange{From: day, To: day.AddDate(0, 0, 1)})
 }
 
-// UpdateGroup godoc
-// @Summary      Update a group by ID
-// @Description  Update the name of a specific group identified by its ID.
-// @Tags         groups
-// @Accept       json
+// GetOverdueToDos godoc
+// @Summary      Retrieve overdue ToDos
+// @Description  Get the ToDos whose due date has passed and that are not done yet, oldest first.
+// @Tags         todos
 // @Produce      json
-// @Param        id     path    string   true   "Group ID"
-// @Param        name   body     string   true   "New name for the group"
-// @Success      200     {object}  models.Group   "Updated group"
-// @Failure      400     {object}  map[string]interface{}   "Bad Request"
-// @Failure      404     {object}  map[string]interface{}   "Group not found"
-// @Failure      500     {object}  map[string]interface{}   "Internal Server Error"
-// @Router       /groups/{id} [put]
-func UpdateGroup(c *gin.Context) {
-	id := c.Param("id")
+// @Success      200     {array}  dto.ToDoResponse   "List of ToDos"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /todos/overdue [get]
+func (h *ToDoHandler) GetOverdueToDos(c *gin.Context) {
+	h.listDue(c, repository.DueRange{To: time.Now(), OpenOnly: true})
+}
 
-	// Estrutura para receber apenas o nome
-	type UpdateInput struct {
-		Name string `json:"name" binding:"required"`
+// GetUpcomingToDos godoc
+// @Summary      Retrieve upcoming ToDos
+// @Description  Get the ToDos that are not done yet and are due between now and the end of the day N days from today in the caller's timezone.
+// @Tags         todos
+// @Produce      json
+// @Param        days   query  int      false  "Number of days ahead to look, 0 meaning the rest of today (default 7, max 365)"
+// @Param        tz     query  string   false  "IANA timezone of the caller, overrides the X-Timezone header (default UTC)"
+// @Success      200     {array}  dto.ToDoResponse   "List of ToDos"
+// @Failure      400     {object}  apierror.Problem   "Bad Request"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /todos/upcoming [get]
+func (h *ToDoHandler) GetUpcomingToDos(c *gin.Context) {
+	loc, ok := callerLocation(c)
+	if !ok {
+		return
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 0 || days > 365 {
+		apierror.Abort(c, invalidQuery("days", "must be a number between 0 and 365"))
+		return
 	}
 
-	var input UpdateInput
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	h.listDue(c, repository.DueRange{From: now, To: today.AddDate(0, 0, days+1), OpenOnly: true})
+}
+
+// CreateToDo godoc
+// @Summary      Create a new ToDo
+// @Description  Create a new ToDo with the provided JSON data. The status must belong to the workflow of the target group and defaults to its initial status. The optional due_date is an RFC 3339 timestamp with a UTC offset; the optional parent_id makes it a subtask of another ToDo in the same group. Each of the optional reminder_offsets sends a todo.reminder event that many minutes before the ToDo is due. Requires the editor or owner role in the target group.
+// @Tags         todos
+// @Accept       json
+// @Produce      json
+// @Param        todo   body   dto.ToDoRequest   true   "ToDo to be created"
+// @Param        Idempotency-Key   header  string  false  "Key that makes retries of this request return the first response instead of running again"
+// @Success      201     {object}  dto.ToDoResponse   "Created ToDo"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      422     {object}  apierror.Problem   "Invalid fields or unknown group"
+// @Router       /todos [post]
+func (h *ToDoHandler) CreateToDo(c *gin.Context) {
+	userID := currentUserID(c)
+	var input dto.ToDoRequest
 
-	// Vincula o JSON do corpo da requisição à estrutura input
+	// Bind the JSON request body to the request struct
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, apierror.FromBinding(err))
 		return
 	}
 
-	// Busca o grupo existente
-	var group models.Group
-	if err := db.Where("id = ?", id).First(&group).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+	// Create the ToDo in the database
+	todo, group, problem := h.createToDo(c.Request.Context(), h.Todos, userID, &input)
+	if problem != nil {
+		apierror.Abort(c, problem)
 		return
 	}
 
-	// Atualiza apenas o nome
-	if err := db.Model(&group).Update("name", input.Name).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
-		return
+	// Clear the cache
+	h.invalidateToDoCaches(c, todo)
+	h.invalidateGroupCaches(c, group)
+
+	// Return the created ToDo with status 201 Created
+	respondVersioned(c, http.StatusCreated, todo.Version, dto.NewToDoResponse(todo))
+}
+
+// createToDo checks a create request and saves the new todo with todos,
+// returning it with the group it went into.
+func (d Dependencies) createToDo(ctx context.Context, todos repository.TodoRepository, userID int, input *dto.ToDoRequest) (*models.ToDo, *models.Group, *apierror.Error) {
+	if problem := validateDueDate(input.DueDate); problem != nil {
+		return nil, nil, problem
+	}
+	if problem := validateRecurrence(input); problem != nil {
+		return nil, nil, problem
+	}
+	todo := models.ToDo{OwnerID: userID, Priority: models.DefaultPriority}
+	applyToDoRequest(&todo, input)
+	if todo.Recurrence != "" {
+		todo.RecurrenceStart = todo.DueDate
+	}
+
+	// Check if GroupID exists and the caller may add todos to it
+	group, problem := d.targetGroup(ctx, userID, todo.GroupID)
+	if problem != nil {
+		return nil, nil, problem
+	}
+	w, problem := d.workflowOf(group)
+	if problem != nil {
+		return nil, nil, problem
+	}
+	if todo.Status == "" {
+		todo.Status = w.Initial
+	}
+	if problem := checkStatus(w, "", todo.Status); problem != nil {
+		return nil, nil, problem
+	}
+	if problem := checkParent(ctx, todos, &todo); problem != nil {
+		return nil, nil, problem
+	}
+	if len(todo.Tags) > 0 {
+		if problem := d.checkTags(ctx, userID, &todo, nil); problem != nil {
+			return nil, nil, problem
+		}
 	}
 
-	// Invalida o cache
-	rdb.Del(ctx, "groups:all")
+	if err := todos.Create(ctx, &todo, userID); err != nil {
+		return nil, nil, saveError(err, false, "Failed to create todo")
+	}
+	return &todo, group, nil
+}
 
-	// Retorna o grupo atualizado
-	c.JSON(http.StatusOK, group)
+// UpdateToDo godoc
+// @Summary      Update a ToDo by ID
+// @Description  Update details of a specific ToDo identified by its ID. A status change must be a transition the group's workflow allows; a missing status keeps the current one. Changing the due date schedules the reminders again, and closing the ToDo cancels those still pending. Marking a recurring ToDo done creates its next occurrence, with the same group, tags, priority and reminders, which takes over the recurrence. Requires the editor or owner role in its group.
+// @Tags         todos
+// @Accept       json
+// @Produce      json
+// @Param        id     path    string   true   "ToDo ID"
+// @Param        todo   body     dto.ToDoRequest   true   "Updated ToDo"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  dto.ToDoResponse   "Updated ToDo"
+// @Header       200     {string}  ETag   "Version of the ToDo"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      409     {object}  apierror.Problem   "Transition not allowed by the workflow"
+// @Failure      412     {object}  apierror.Problem   "ToDo changed since the If-Match ETag"
+// @Failure      422     {object}  apierror.Problem   "Invalid fields or unknown group"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Router       /todos/{id} [put]
+func (h *ToDoHandler) UpdateToDo(c *gin.Context) {
+	todo, group, ok := h.loadEditableToDo(c)
+	if !ok {
+		return
+	}
+	var input dto.ToDoRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+	h.saveToDo(c, todo, group, &input)
 }
 
-// DeleteGroup godoc
-// @Summary      Delete a group by ID
-// @Description  Delete a specific group identified by its ID.
-// @Tags         groups
+// PatchToDo godoc
+// @Summary      Partially update a ToDo by ID
+// @Description  Change only some fields of a ToDo with a JSON Merge Patch (application/merge-patch+json) or a JSON Patch (application/json-patch+json) against {"title", "status", "group_id", "due_date", "parent_id", "tag_ids", "priority", "estimate_minutes", "recurrence", "timezone", "reminder_offsets"}. The result is validated like a PUT body, and the same workflow rules apply. Requires the editor or owner role in its group.
+// @Tags         todos
+// @Accept       application/merge-patch+json
+// @Accept       application/json-patch+json
 // @Produce      json
-// @Param        id     path    string   true   "Group ID"
-// @Success      200     {object}  string   "Group deleted"
-// @Failure      404     {object}  map[string]interface{}   "Group not found"
-// @Failure      500     {object}  map[string]interface{}   "Internal Server Error"
-// @Router       /groups/{id} [delete]
-func DeleteGroup(c *gin.Context) {
-	id := c.Param("id")
-	var group models.Group
-
-	// Finding the group
-	err := db.Preload("ToDos").Where("id = ?", id).First(&group).Error
+// @Param        id      path    string   true   "ToDo ID"
+// @Param        patch   body    object   true   "Merge patch object or JSON Patch operations"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  dto.ToDoResponse   "Updated ToDo"
+// @Header       200     {string}  ETag   "Version of the ToDo"
+// @Failure      400     {object}  apierror.Problem   "Malformed patch"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      409     {object}  apierror.Problem   "Failed test operation or transition not allowed by the workflow"
+// @Failure      412     {object}  apierror.Problem   "ToDo changed since the If-Match ETag"
+// @Failure      415     {object}  apierror.Problem   "Not a patch media type"
+// @Failure      422     {object}  apierror.Problem   "Invalid result or unknown group"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Router       /todos/{id} [patch]
+func (h *ToDoHandler) PatchToDo(c *gin.Context) {
+	todo, group, ok := h.loadEditableToDo(c)
+	if !ok {
+		return
+	}
+	original, err := json.Marshal(dto.ToDoRequestFrom(todo))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		apierror.Abort(c, apierror.Internal("Failed to encode todo", err))
 		return
 	}
-
-	// Delete all ToDos associated with the group
-	for _, todo := range group.ToDos {
-		db.Delete(&todo)
+	patched, problem := applyPatch(c, original)
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return
 	}
+	var input dto.ToDoRequest
+	if problem := decodePatched(patched, &input); problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
+	h.saveToDo(c, todo, group, &input)
+}
 
-	// Now delete the group itself
-	db.Delete(&group)
+// loadEditableToDo loads the todo named by the id path parameter and its
+// group, which the caller must be allowed to edit.
+func (h *ToDoHandler) loadEditableToDo(c *gin.Context) (*models.ToDo, *models.Group, bool) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, todoNotFound())
+		return nil, nil, false
+	}
+	todo, ok := h.loadToDo(c, id)
+	if !ok {
+		return nil, nil, false
+	}
+	group, ok := h.loadToDoGroup(c, todo, models.RoleEditor)
+	if !ok || !checkIfMatch(c, todo.Version, h.RequireIfMatch) {
+		return nil, nil, false
+	}
+	return todo, group, true
+}
 
-	// Optionally clear cache or other operations
-	rdb.Del(ctx, "groups:all")
-	rdb.Del(ctx, "todos:all")
+// saveToDo applies an update request to todo, checks the result and saves the
+// fields it changed. An update that changes nothing writes nothing.
+func (h *ToDoHandler) saveToDo(c *gin.Context, todo *models.ToDo, previousGroup *models.Group, input *dto.ToDoRequest) {
+	previous := *todo
+	group, changes, problem := h.updateToDo(c.Request.Context(), h.Todos, currentUserID(c), todo, previousGroup, input, c.GetHeader("If-Match") != "")
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
+	if len(changes) > 0 {
+		h.invalidateToDoCaches(c, todo, &previous)
+		if previousGroup.ID != group.ID {
+			h.invalidateGroupCaches(c, group, previousGroup)
+		} else {
+			h.invalidateGroupCaches(c, group)
+		}
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Group and associated ToDos deleted"})
+	respondVersioned(c, http.StatusOK, todo.Version, dto.NewToDoResponse(todo))
 }
 
-// GetToDos godoc
-// @Summary      Retrieve all ToDos
-// @Description  Get the list of all ToDos. This endpoint first tries to fetch data from the Redis cache; if not available, it queries the database and caches the result.
-// @Tags         todos
-// @Produce      json
-// @Success      200     {array}   models.ToDo   "List of ToDos"
-// @Failure      500     {object}  map[string]interface{}   "Internal Server Error"
-// @Router       /todos [get]
-func GetToDos(c *gin.Context) {
-	var todos []models.ToDo
-
-	// Try to get todos from Redis cache
-	result, err := rdb.Get(ctx, "todos:all").Result()
-	if err == redis.Nil {
-		// If not in cache, query the database
-		if err := db.Find(&todos).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve todos"})
-			return
+// updateToDo applies an update request to todo, in group, and saves the fields
+// it changed with todos. It returns the group the todo ends up in and the
+// changes, which are empty when there was nothing to save. conditional tells
+// whether the client asked for a version, for reporting lost races.
+func (d Dependencies) updateToDo(ctx context.Context, todos repository.TodoRepository, userID int, todo *models.ToDo, group *models.Group, input *dto.ToDoRequest, conditional bool) (*models.Group, models.ChangeSet, *apierror.Error) {
+	if problem := validateDueDate(input.DueDate); problem != nil {
+		return nil, nil, problem
+	}
+	if problem := validateRecurrence(input); problem != nil {
+		return nil, nil, problem
+	}
+	before, tags := dto.ToDoRequestFrom(todo), todo.Tags
+	applyToDoRequest(todo, input)
+	changes := diffFields(before, dto.ToDoRequestFrom(todo))
+	if len(changes) == 0 {
+		todo.Tags = tags
+		return group, changes, nil
+	}
+	if changes.Has("tag_ids") {
+		if problem := d.checkTags(ctx, userID, todo, tags); problem != nil {
+			return nil, nil, problem
 		}
+	}
 
-		// Cache the result
-		data, err := json.Marshal(todos)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal todos"})
-			return
+	if changes.Has("group_id") {
+		if todo.SubtasksTotal > 0 {
+			return nil, nil, hasSubtasks()
 		}
-		if err := rdb.Set(ctx, "todos:all", data, 5*time.Minute).Err(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cache todos"})
-			return
+		var problem *apierror.Error
+		if group, problem = d.targetGroup(ctx, userID, todo.GroupID); problem != nil {
+			return nil, nil, problem
 		}
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Redis error: " + err.Error()})
-		return
-	} else {
-		// If found in cache, unmarshal the data
-		if err := json.Unmarshal([]byte(result), &todos); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmarshal todos"})
-			return
+	}
+	if changes.Has("group_id") || changes.Has("parent_id") {
+		if problem := checkParent(ctx, todos, todo); problem != nil {
+			return nil, nil, problem
+		}
+	}
+	if changes.Has("recurrence") || changes.Has("timezone") {
+		restartRecurrence(todo, changes)
+	}
+	var next *models.ToDo
+	if changes.Has("status") || changes.Has("group_id") {
+		w, problem := d.workflowOf(group)
+		if problem != nil {
+			return nil, nil, problem
+		}
+		if problem := checkStatus(w, before.Status, todo.Status); problem != nil {
+			return nil, nil, problem
+		}
+		if problem := checkSubtasksClosed(todo, before.Status); problem != nil {
+			return nil, nil, problem
+		}
+		if completesOccurrence(w, todo, before.Status) {
+			if next, problem = completeOccurrence(todo, w.Initial, changes); problem != nil {
+				return nil, nil, problem
+			}
 		}
 	}
 
-	c.JSON(http.StatusOK, todos)
+	if err := saveCompletion(ctx, todos, todo, changes, next, userID); err != nil {
+		return nil, nil, saveError(err, conditional, "Failed to update todo")
+	}
+	return group, changes, nil
 }
 
-// GetToDosById godoc
-// @Summary      Retrieve a ToDo by ID
-// @Description  Get details of a specific ToDo identified by its ID. This endpoint first tries to fetch data from the Redis cache; if not available, it queries the database and caches the result.
+// MoveToDo godoc
+// @Summary      Move a ToDo within its group or to another one
+// @Description  Put a ToDo right after after_id, right before before_id, between them if both are given, or last in the group if neither is. Only the moved ToDo changes. A group_id moves it to that group, whose workflow must have its status; the neighbours must be in the group it ends up in. Requires the editor or owner role in both groups.
 // @Tags         todos
+// @Accept       json
 // @Produce      json
-// @Param        id     path    string   true   "ToDo ID"
-// @Success      200     {object}  models.ToDo   "ToDo details"
-// @Failure      404     {object}  map[string]interface{}   "ToDo not found"
-// @Failure      500     {object}  map[string]interface{}   "Internal Server Error"
-// @Router       /todos/{id} [get]
-func GetToDosById(c *gin.Context) {
-	id := c.Param("id")
-	var todo models.ToDo
-	result, err := rdb.Get(ctx, "todo:"+id).Result()
-	if err == nil {
-		// Found in cache, unmarshal and return
-		if err := json.Unmarshal([]byte(result), &todo); err == nil {
-			c.JSON(http.StatusOK, todo)
-			return
-		}
-	} else if err != redis.Nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Redis error: " + err.Error()})
+// @Param        id     path    string                 true   "ToDo ID"
+// @Param        move   body    dto.MoveToDoRequest    true   "Where to put the ToDo"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  dto.ToDoResponse   "Moved ToDo"
+// @Header       200     {string}  ETag   "Version of the ToDo"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      409     {object}  apierror.Problem   "The neighbours moved in the meantime"
+// @Failure      412     {object}  apierror.Problem   "ToDo changed since the If-Match ETag"
+// @Failure      422     {object}  apierror.Problem   "Unknown group or neighbours, or status not in the group's workflow"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Router       /todos/{id}/move [post]
+func (h *ToDoHandler) MoveToDo(c *gin.Context) {
+	todo, group, ok := h.loadEditableToDo(c)
+	if !ok {
+		return
+	}
+	var input dto.MoveToDoRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
 		return
 	}
 
-	// Not found in cache or error occurred, query the database
-	if err := db.First(&todo, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "ToDo not found"})
+	previousGroup := group
+	group, problem := h.moveToDo(c.Request.Context(), h.Todos, currentUserID(c), todo, group, &input, c.GetHeader("If-Match") != "")
+	if problem != nil {
+		apierror.Abort(c, problem)
 		return
 	}
+	h.invalidateToDoCaches(c, todo)
+	h.invalidateGroupCaches(c, group, previousGroup)
 
-	// Cache the todo for future requests
-	todoJSON, err := json.Marshal(todo)
-	if err == nil {
-		if err := rdb.Set(ctx, "todo:"+id, todoJSON, time.Hour).Err(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cache todo"})
-			return
+	respondVersioned(c, http.StatusOK, todo.Version, dto.NewToDoResponse(todo))
+}
+
+// moveToDo checks a move request for todo, in group, and moves it with todos,
+// returning the group it ends up in. conditional is as for updateToDo.
+func (d Dependencies) moveToDo(ctx context.Context, todos repository.TodoRepository, userID int, todo *models.ToDo, group *models.Group, input *dto.MoveToDoRequest, conditional bool) (*models.Group, *apierror.Error) {
+	if input.GroupID != 0 && input.GroupID != todo.GroupID {
+		if problem := checkGroupChange(todo); problem != nil {
+			return nil, problem
+		}
+		var problem *apierror.Error
+		if group, problem = d.targetGroup(ctx, userID, input.GroupID); problem != nil {
+			return nil, problem
 		}
+		w, problem := d.workflowOf(group)
+		if problem != nil {
+			return nil, problem
+		}
+		if problem := checkStatus(w, todo.Status, todo.Status); problem != nil {
+			return nil, problem
+		}
+	}
+
+	after, problem := moveNeighbour(ctx, todos, todo, group.ID, input.AfterID, "after_id")
+	if problem != nil {
+		return nil, problem
+	}
+	before, problem := moveNeighbour(ctx, todos, todo, group.ID, input.BeforeID, "before_id")
+	if problem != nil {
+		return nil, problem
+	}
+	if after != nil && before != nil && after.Rank >= before.Rank {
+		return nil, invalidField("before_id", "must come after after_id in the group")
 	}
 
-	c.JSON(http.StatusOK, todo)
+	placement := repository.Placement{GroupID: group.ID, After: input.AfterID, Before: input.BeforeID}
+	if _, err := todos.Move(ctx, todo, placement, userID); err != nil {
+		return nil, saveError(err, conditional, "Failed to move todo")
+	}
+	return group, nil
 }
 
-// GetToDosByDate godoc
-// @Summary      Retrieve ToDos by due date
-// @Description  Get a list of ToDos that have a due date matching the specified date.
-// @Tags         todos
-// @Produce      json
-// @Param        date   path   string   true   "Due date (format: YYYY-MM-DD)"
-// @Success      200     {array}  models.ToDo   "List of ToDos"
-// @Failure      500     {object}  map[string]interface{}   "Internal Server Error"
-// @Router       /todos/date/{date} [get]
-func GetToDosByDate(c *gin.Context) {
-	date := c.Param("date")
-	var todos []models.ToDo
-	db.Where("date(due_date) = ?", date).Find(&todos)
-	c.JSON(http.StatusOK, todos)
+// moveNeighbour loads the todo a move puts another one next to, if id is
+// set. It must be another todo in the group the move goes to.
+func moveNeighbour(ctx context.Context, todos repository.TodoRepository, todo *models.ToDo, groupID, id uint, field string) (*models.ToDo, *apierror.Error) {
+	if id == 0 {
+		return nil, nil
+	}
+	neighbour, err := todos.Get(ctx, id)
+	if err == repository.ErrNotFound || err == nil && (neighbour.GroupID != groupID || neighbour.ID == todo.ID) {
+		return nil, invalidField(field, "must be another todo in the group the todo moves to")
+	} else if err != nil {
+		return nil, apierror.Internal("Failed to retrieve todo", err)
+	}
+	return neighbour, nil
 }
 
-// CreateToDo godoc
-// @Summary      Create a new ToDo
-// @Description  Create a new ToDo with the provided JSON data.
+// TransitionToDo godoc
+// @Summary      Change the status of a ToDo
+// @Description  Move a ToDo to another status of its group's workflow, recording who did it and when. Moving a recurring ToDo to done creates its next occurrence, like an update does. Requires the editor or owner role in its group.
 // @Tags         todos
 // @Accept       json
 // @Produce      json
-// @Param        todo   body   models.ToDo   true   "ToDo object to be created"
-// @Success      201     {object}  models.ToDo   "Created ToDo"
-// @Failure      400     {object}  map[string]interface{}   "Bad Request"
-// @Router       /todos [post]
-func CreateToDo(c *gin.Context) {
-	var todo models.ToDo
-
-	// Bind the JSON request body to the ToDo struct
-	if err := c.ShouldBindJSON(&todo); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// @Param        id           path    string                  true   "ToDo ID"
+// @Param        transition   body    dto.TransitionRequest   true   "Status to move to"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Param        Idempotency-Key   header  string  false  "Key that makes retries of this request return the first response instead of running again"
+// @Success      201     {object}  dto.TransitionResponse   "Recorded transition with the updated ToDo"
+// @Failure      400     {object}  apierror.Problem   "Malformed body"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      409     {object}  apierror.Problem   "Transition not allowed by the workflow, or closing a ToDo with open subtasks"
+// @Failure      412     {object}  apierror.Problem   "ToDo changed since the If-Match ETag"
+// @Failure      422     {object}  apierror.Problem   "Status not in the workflow"
+// @Router       /todos/{id}/transitions [post]
+func (h *ToDoHandler) TransitionToDo(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, todoNotFound())
 		return
 	}
-
-	// Check if GroupID exists
-	var group models.Group
-	if err := db.First(&group, todo.GroupID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "GroupID does not exist"})
+	var input dto.TransitionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+	todo, ok := h.loadToDo(c, id)
+	if !ok {
+		return
+	}
+	group, ok := h.loadToDoGroup(c, todo, models.RoleEditor)
+	if !ok || !checkIfMatch(c, todo.Version, false) {
+		return
+	}
+	w, ok := h.groupWorkflow(c, group)
+	if !ok {
 		return
 	}
 
-	// Create the ToDo in the database
-	db.Create(&todo)
-
-	// Clear the cache
-	rdb.Del(ctx, "todos:all")
+	from := todo.Status
+	if input.To == from {
+		apierror.Abort(c, invalidTransition(w, from, input.To))
+		return
+	}
+	if problem := checkStatus(w, from, input.To); problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
+	todo.Status = input.To
+	if problem := checkSubtasksClosed(todo, from); problem != nil {
+		apierror.Abort(c, problem)
+		return
+	}
 
-	// Return the created ToDo with status 201 Created
-	c.JSON(http.StatusCreated, todo)
+	userID := currentUserID(c)
+	changes := models.ChangeSet{"status": {From: from, To: todo.Status}}
+	var next *models.ToDo
+	if completesOccurrence(w, todo, from) {
+		var problem *apierror.Error
+		if next, problem = completeOccurrence(todo, w.Initial, changes); problem != nil {
+			apierror.Abort(c, problem)
+			return
+		}
+	}
+	if err := saveCompletion(c.Request.Context(), h.Todos, todo, changes, next, userID); err != nil {
+		apierror.Abort(c, writeConflict(c, err, "Failed to update todo"))
+		return
+	}
+	h.invalidateToDoCaches(c, todo)
+	h.invalidateGroupCaches(c, group)
+
+	response := dto.NewToDoResponse(todo)
+	c.JSON(http.StatusCreated, dto.TransitionResponse{
+		ToDoID:     todo.ID,
+		FromStatus: from,
+		ToStatus:   todo.Status,
+		ActorID:    userID,
+		CreatedAt:  *todo.StatusChangedAt,
+		ToDo:       &response,
+	})
 }
 
-// UpdateToDo godoc
-// @Summary      Update a ToDo by ID
-// @Description  Update details of a specific ToDo identified by its ID.
+// GetToDoTransitions godoc
+// @Summary      List the status changes of a ToDo
+// @Description  Get the status history of a ToDo, oldest first, with who made each change and when.
 // @Tags         todos
-// @Accept       json
 // @Produce      json
 // @Param        id     path    string   true   "ToDo ID"
-// @Param        todo   body     models.ToDo   true   "Updated ToDo object"
-// @Success      200     {object}  models.ToDo   "Updated ToDo"
-// @Failure      400     {object}  map[string]interface{}   "Bad Request"
-// @Failure      404     {object}  map[string]interface{}   "ToDo not found"
-// @Router       /todos/{id} [put]
-func UpdateToDo(c *gin.Context) {
-	id := c.Param("id")
-	var todo models.ToDo
-
-	if err := db.Where("id = ?", id).First(&todo).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "ToDo not found"})
+// @Success      200     {array}   dto.TransitionResponse   "Status history"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /todos/{id}/transitions [get]
+func (h *ToDoHandler) GetToDoTransitions(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, todoNotFound())
+		return
+	}
+	todo, ok := h.loadToDo(c, id)
+	if !ok {
 		return
 	}
-	if err := c.ShouldBindJSON(&todo); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if _, ok := h.loadToDoGroup(c, todo, models.RoleViewer); !ok {
 		return
 	}
-	db.Save(&todo)
-	rdb.Del(ctx, "todos:all")
 
-	c.JSON(http.StatusOK, todo)
+	transitions, err := h.Todos.Transitions(c.Request.Context(), todo.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve transitions", err))
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewTransitionResponses(transitions))
 }
 
 // DeleteToDo godoc
 // @Summary      Delete a ToDo by ID
-// @Description  Delete a specific ToDo identified by its ID.
+// @Description  Move a specific ToDo identified by its ID to the trash, together with its subtasks. It can be restored with them until it is purged for good once the retention period is over. Requires the editor or owner role in its group.
 // @Tags         todos
 // @Produce      json
 // @Param        id     path    string   true   "ToDo ID"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
 // @Success      200     {object}  string   "ToDo deleted"
-// @Failure      404     {object}  map[string]interface{}   "ToDo not found"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "ToDo not found"
+// @Failure      412     {object}  apierror.Problem   "ToDo changed since the If-Match ETag"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
 // @Router       /todos/{id} [delete]
-func DeleteToDo(c *gin.Context) {
-	id := c.Param("id")
-	var todo models.ToDo
-	if err := db.Where("id = ?", id).First(&todo).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "ToDo not found"})
+func (h *ToDoHandler) DeleteToDo(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, todoNotFound())
+		return
+	}
+	todo, ok := h.loadToDo(c, id)
+	if !ok {
+		return
+	}
+	group, ok := h.loadToDoGroup(c, todo, models.RoleEditor)
+	if !ok || !checkIfMatch(c, todo.Version, h.RequireIfMatch) {
 		return
 	}
-	db.Delete(&todo)
-	rdb.Del(ctx, "todos:all")
+	subtasks, err := h.Todos.Delete(c.Request.Context(), todo, currentUserID(c))
+	if err != nil {
+		apierror.Abort(c, writeConflict(c, err, "Failed to delete todo"))
+		return
+	}
+	h.invalidateToDoCaches(c, append(toDoRefs(subtasks), todo)...)
+	h.invalidateGroupCaches(c, group)
 	c.JSON(http.StatusOK, gin.H{"message": "ToDo deleted"})
 }
+
+// loadToDo fetches a todo by ID, writing the error response itself when it
+// can't. Callers still have to check the caller's role in its group.
+func (h *ToDoHandler) loadToDo(c *gin.Context, id uint) (*models.ToDo, bool) {
+	todo, err := h.Todos.Get(c.Request.Context(), id)
+	if err == repository.ErrNotFound {
+		apierror.Abort(c, todoNotFound())
+		return nil, false
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve todo", err))
+		return nil, false
+	}
+	return todo, true
+}
+
+// listDue responds with the caller's todos due within r
+func (h *ToDoHandler) listDue(c *gin.Context, r repository.DueRange) {
+	todos, err := h.Todos.ListDue(c.Request.Context(), currentUserID(c), r)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve todos", err))
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewToDoResponses(todos))
+}
+
+// applyToDoRequest copies the client-settable fields of a request onto todo.
+// A missing status leaves the current one.
+func applyToDoRequest(todo *models.ToDo, input *dto.ToDoRequest) {
+	todo.Title = string(input.Title)
+	if input.Status != "" {
+		todo.Status = input.Status
+	}
+	todo.GroupID = input.GroupID
+	todo.DueDate = input.DueDate
+	todo.ParentID = input.ParentID
+	if input.Priority != "" {
+		todo.Priority = input.Priority
+	}
+	todo.EstimateMinutes = input.EstimateMinutes
+	todo.Recurrence, todo.Timezone = input.Recurrence, input.Timezone
+	if input.TagIDs != nil {
+		// Only the IDs for now; checkTags loads the tags
+		todo.Tags = make([]models.Tag, 0, len(input.TagIDs))
+		for _, id := range input.TagIDs {
+			if !hasTag(todo.Tags, id) {
+				todo.Tags = append(todo.Tags, models.Tag{ID: id})
+			}
+		}
+	}
+	if input.ReminderOffsets != nil {
+		// The repositories schedule them
+		todo.Reminders = make([]models.Reminder, 0, len(input.ReminderOffsets))
+		for _, offset := range input.ReminderOffsets {
+			if !hasReminder(todo.Reminders, offset) {
+				todo.Reminders = append(todo.Reminders, models.Reminder{OffsetMinutes: offset})
+			}
+		}
+		sort.Slice(todo.Reminders, func(i, j int) bool {
+			return todo.Reminders[i].OffsetMinutes > todo.Reminders[j].OffsetMinutes
+		})
+	}
+}
+
+func hasReminder(reminders []models.Reminder, offset int) bool {
+	for _, reminder := range reminders {
+		if reminder.OffsetMinutes == offset {
+			return true
+		}
+	}
+	return false
+}
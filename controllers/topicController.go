@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/IBM/sarama"
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/utils"
+)
+
+func CreateTopic(c *gin.Context) {
+	type TopicInput struct {
+		TopicName string `json:"topicName" binding:"required"`
+	}
+	var input TopicInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+
+	if err := utils.InitKafkaAdmin(); err != nil {
+		apierror.Abort(c, apierror.DependencyUnavailable("kafka_unavailable", "Kafka is unavailable, try again later", err))
+		return
+	}
+	if err := utils.CreateKafkaTopic(input.TopicName, 1, 1); errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		apierror.Abort(c, apierror.Conflict("topic_exists", "A topic with this name already exists"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.DependencyUnavailable("kafka_unavailable", "Failed to create topic", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": "New topic created"})
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/dto"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// GetTrash godoc
+// @Summary      List the trash
+// @Description  List the deleted groups the caller owns and the ToDos deleted from groups they can see, last deleted first. Deleted items can be restored until they are purged for good once the retention period is over. Subtasks deleted with their parent aren't listed; they come back with it.
+// @Tags         trash
+// @Produce      json
+// @Success      200     {object}  dto.TrashResponse   "Trash"
+// @Failure      500     {object}  apierror.Problem   "Internal Server Error"
+// @Router       /trash [get]
+func (h *TrashHandler) GetTrash(c *gin.Context) {
+	userID := currentUserID(c)
+	groups, err := h.Groups.Trashed(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve the trash", err))
+		return
+	}
+	todos, err := h.Todos.Trashed(c.Request.Context(), userID)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve the trash", err))
+		return
+	}
+	c.JSON(http.StatusOK, dto.TrashResponse{Groups: dto.NewGroupResponses(groups), ToDos: dto.NewToDoResponses(todos)})
+}
+
+// RestoreToDo godoc
+// @Summary      Restore a deleted ToDo
+// @Description  Take a ToDo out of the trash together with the subtasks deleted with it. They are ranked last in their group and their reminders are scheduled again. Requires the editor or owner role in its group.
+// @Tags         todos
+// @Produce      json
+// @Param        id     path    string   true   "ToDo ID"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  dto.ToDoResponse   "Restored ToDo"
+// @Header       200     {string}  ETag   "Version of the ToDo"
+// @Failure      403     {object}  apierror.Problem   "Forbidden"
+// @Failure      404     {object}  apierror.Problem   "ToDo not in the trash"
+// @Failure      409     {object}  apierror.Problem   "The parent of the ToDo is deleted; restore it first"
+// @Failure      412     {object}  apierror.Problem   "ToDo changed since the If-Match ETag"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Router       /todos/{id}/restore [post]
+func (h *ToDoHandler) RestoreToDo(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, todoNotFound())
+		return
+	}
+	todo, err := h.Todos.GetTrashed(c.Request.Context(), id)
+	if err == repository.ErrNotFound {
+		apierror.Abort(c, todoNotFound())
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve todo", err))
+		return
+	}
+	// The todos of a deleted group come back with it
+	group, ok := h.loadToDoGroup(c, todo, models.RoleEditor)
+	if !ok || !checkIfMatch(c, todo.Version, h.RequireIfMatch) {
+		return
+	}
+	if todo.ParentID != nil {
+		if _, err := h.Todos.Get(c.Request.Context(), *todo.ParentID); err == repository.ErrNotFound {
+			apierror.Abort(c, apierror.Conflict("parent_deleted", "The parent of the todo is deleted; restore it first"))
+			return
+		} else if err != nil {
+			apierror.Abort(c, apierror.Internal("Failed to retrieve todo", err))
+			return
+		}
+	}
+
+	subtasks, err := h.Todos.Restore(c.Request.Context(), todo, currentUserID(c))
+	if err != nil {
+		apierror.Abort(c, writeConflict(c, err, "Failed to restore todo"))
+		return
+	}
+	h.invalidateToDoCaches(c, append(toDoRefs(subtasks), todo)...)
+	h.invalidateGroupCaches(c, group)
+	respondVersioned(c, http.StatusOK, todo.Version, dto.NewToDoResponse(todo))
+}
+
+// RestoreGroup godoc
+// @Summary      Restore a deleted group
+// @Description  Take a group out of the trash together with the ToDos deleted with it, and share it with its members again. ToDos deleted before the group stay in the trash. Requires the owner role.
+// @Tags         groups
+// @Produce      json
+// @Param        id     path    string   true   "Group ID"
+// @Param        If-Match   header  string  false  "ETag the client last saw; the request fails with 412 if it changed since"
+// @Success      200     {object}  dto.GroupResponse   "Restored group with its restored ToDos"
+// @Header       200     {string}  ETag   "Version of the group"
+// @Failure      404     {object}  apierror.Problem   "Group not in the trash"
+// @Failure      409     {object}  apierror.Problem   "The owner has another group with this name"
+// @Failure      412     {object}  apierror.Problem   "Group changed since the If-Match ETag"
+// @Failure      428     {object}  apierror.Problem   "If-Match is required"
+// @Router       /groups/{id}/restore [post]
+func (h *GroupHandler) RestoreGroup(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		apierror.Abort(c, groupNotFound())
+		return
+	}
+	// Only the owner sees a deleted group
+	group, err := h.Groups.GetTrashed(c.Request.Context(), id)
+	if err == repository.ErrNotFound || err == nil && group.OwnerID != currentUserID(c) {
+		apierror.Abort(c, groupNotFound())
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to retrieve group", err))
+		return
+	}
+	if !checkIfMatch(c, group.Version, h.RequireIfMatch) {
+		return
+	}
+	if _, err := h.Groups.FindByName(c.Request.Context(), group.OwnerID, group.Name); err == nil {
+		apierror.Abort(c, apierror.Conflict("group_name_taken", "Group with this name already exists; rename it before restoring this one"))
+		return
+	} else if err != repository.ErrNotFound {
+		apierror.Abort(c, apierror.Internal("Database error", err))
+		return
+	}
+
+	if err := h.Groups.Restore(c.Request.Context(), group, currentUserID(c)); err != nil {
+		apierror.Abort(c, writeConflict(c, err, "Failed to restore group"))
+		return
+	}
+	h.invalidateToDoCaches(c, toDoRefs(group.ToDos)...)
+	h.invalidateGroupCaches(c, group)
+	respondVersioned(c, http.StatusOK, group.Version, dto.NewGroupResponse(group))
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/dto"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/workflow"
+)
+
+// WorkflowHandler serves the workflow endpoints
+type WorkflowHandler struct {
+	Dependencies
+}
+
+func NewWorkflowHandler(deps Dependencies) *WorkflowHandler {
+	return &WorkflowHandler{Dependencies: deps}
+}
+
+// GetWorkflows godoc
+// @Summary      List workflows
+// @Description  List the status workflows groups can pick, with the transitions each allows and the statuses that complete an occurrence of a recurring ToDo.
+// @Tags         workflows
+// @Produce      json
+// @Success      200  {array}  dto.WorkflowResponse
+// @Router       /workflows [get]
+func (h *WorkflowHandler) GetWorkflows(c *gin.Context) {
+	names := h.Workflows.Names()
+	workflows := make([]dto.WorkflowResponse, 0, len(names))
+	for _, name := range names {
+		w, _ := h.Workflows.Get(name)
+		workflows = append(workflows, dto.WorkflowResponse{
+			Name:        w.Name,
+			Initial:     w.Initial,
+			Statuses:    w.Statuses(),
+			Transitions: w.Transitions,
+			Complete:    w.Complete,
+			Default:     name == h.Workflows.DefaultName(),
+		})
+	}
+	c.JSON(http.StatusOK, workflows)
+}
+
+// pickWorkflow resolves the workflow named in a group request; an empty name
+// means the default one.
+func (d Dependencies) pickWorkflow(name string) (string, *apierror.Error) {
+	if name == "" {
+		return d.Workflows.DefaultName(), nil
+	}
+	if _, ok := d.Workflows.Get(name); !ok {
+		names := d.Workflows.Names()
+		return "", invalidField("workflow", "must be one of "+strings.Join(names, ", ")).With("allowed_workflows", names)
+	}
+	return name, nil
+}
+
+// groupWorkflow returns the workflow a group follows, writing the error
+// response itself if it is no longer configured.
+func (d Dependencies) groupWorkflow(c *gin.Context, group *models.Group) (*workflow.Workflow, bool) {
+	w, problem := d.workflowOf(group)
+	if problem != nil {
+		apierror.Abort(c, problem)
+		return nil, false
+	}
+	return w, true
+}
+
+func (d Dependencies) workflowOf(group *models.Group) (*workflow.Workflow, *apierror.Error) {
+	w, ok := d.Workflows.Get(group.Workflow)
+	if !ok {
+		return nil, apierror.Internal(fmt.Sprintf("The group's workflow %q is not configured", group.Workflow), nil)
+	}
+	return w, nil
+}
+
+// checkStatus checks a todo may go from one status to another in w. An empty
+// from, or one that isn't part of w because the todo comes from a group with
+// another workflow, only requires to to belong to w.
+func checkStatus(w *workflow.Workflow, from, to string) *apierror.Error {
+	if !w.Has(to) {
+		statuses := w.Statuses()
+		return invalidField("status", fmt.Sprintf("must be one of %s in the %s workflow", strings.Join(statuses, ", "), w.Name)).
+			With("allowed_statuses", statuses)
+	}
+	if from == to || !w.Has(from) || w.Allows(from, to) {
+		return nil
+	}
+	return invalidTransition(w, from, to)
+}
+
+func invalidTransition(w *workflow.Workflow, from, to string) *apierror.Error {
+	next := w.Next(from)
+	detail := fmt.Sprintf("A todo can't move from %s to %s; allowed next statuses: %s", from, to, strings.Join(next, ", "))
+	if len(next) == 0 {
+		detail = fmt.Sprintf("A todo can't move from %s to %s; %s is final", from, to, from)
+	}
+	return apierror.Conflict("invalid_transition", detail).With("allowed_transitions", next)
+}
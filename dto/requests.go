@@ -0,0 +1,200 @@
+// Package dto defines the request and response bodies of the API, so the
+// database models can change without changing what clients see.
+package dto
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmas98/go-todo-service/models"
+)
+
+// TrimmedString is a string stripped of surrounding whitespace when decoded,
+// so "required" rejects blank values and lengths count only the real text.
+type TrimmedString string
+
+// UnmarshalText lets encoding/json decode JSON strings into s, and still
+// report other JSON types with the field they were found in.
+func (s *TrimmedString) UnmarshalText(text []byte) error {
+	*s = TrimmedString(strings.TrimSpace(string(text)))
+	return nil
+}
+
+// CreateGroupRequest is the body of POST /groups. A missing workflow means
+// the configured default.
+type CreateGroupRequest struct {
+	Name     TrimmedString `json:"name" binding:"required,max=100" swaggertype:"string" example:"Groceries"`
+	Workflow string        `json:"workflow" example:"kanban"`
+}
+
+// UpdateGroupRequest is the body of PUT /groups/{id}. A missing workflow
+// keeps the current one.
+type UpdateGroupRequest struct {
+	Name     TrimmedString `json:"name" binding:"required,max=100" swaggertype:"string" example:"Groceries"`
+	Workflow string        `json:"workflow" example:"kanban"`
+}
+
+// ToDoRequest is the body of POST /todos and PUT /todos/{id}. The status must
+// belong to the workflow of the group; a missing one means the workflow's
+// initial status on create and the current status on update. The group must
+// exist and be editable by the caller. A parent_id makes the todo a subtask
+// of another todo in the same group. tag_ids replaces the todo's tags, and a
+// missing one keeps them; tags the todo doesn't have yet must be the caller's.
+// The priority works like the status, defaulting to P2 on create. A
+// recurrence is an RFC 5545 RRULE, expanded in the timezone (UTC if missing)
+// from the due date, which a recurring todo must have. reminder_offsets
+// replaces the todo's reminders, each that many minutes before it is due, and
+// a missing one keeps them.
+type ToDoRequest struct {
+	Title           TrimmedString `json:"title" binding:"required,max=200" swaggertype:"string" example:"Buy milk"`
+	Status          string        `json:"status" example:"pending"`
+	GroupID         uint          `json:"group_id" binding:"required" example:"1"`
+	DueDate         *time.Time    `json:"due_date,omitempty" example:"2024-05-01T17:00:00Z"`
+	ParentID        *uint         `json:"parent_id,omitempty" example:"3"`
+	TagIDs          []uint        `json:"tag_ids,omitempty" binding:"max=20" example:"1,4"`
+	Priority        string        `json:"priority,omitempty" binding:"omitempty,oneof=P0 P1 P2 P3" example:"P1"`
+	EstimateMinutes *int          `json:"estimate_minutes,omitempty" binding:"omitempty,min=1,max=525600" example:"90"`
+	Recurrence      string        `json:"recurrence,omitempty" binding:"max=500" example:"FREQ=WEEKLY;BYDAY=SA"`
+	Timezone        string        `json:"timezone,omitempty" binding:"max=64" example:"Europe/Berlin"`
+	ReminderOffsets []int         `json:"reminder_offsets,omitempty" binding:"max=10,dive,min=0,max=525600" example:"1440,60"`
+}
+
+// SubtaskRequest is the body of POST /todos/{id}/subtasks. The subtask goes
+// into the group of its parent.
+type SubtaskRequest struct {
+	Title   TrimmedString `json:"title" binding:"required,max=200" swaggertype:"string" example:"Check the fridge"`
+	Status  string        `json:"status" example:"pending"`
+	DueDate *time.Time    `json:"due_date,omitempty" example:"2024-05-01T17:00:00Z"`
+}
+
+// TagRequest is the body of POST /tags and PUT /tags/{id}. The color is a hex
+// color like #1e90ff; a missing one means the default color on create and the
+// current color on update.
+type TagRequest struct {
+	Name  TrimmedString `json:"name" binding:"required,max=50" swaggertype:"string" example:"urgent"`
+	Color string        `json:"color" binding:"omitempty,hexcolor" example:"#e53935"`
+}
+
+// AddMemberRequest is the body of POST /groups/{id}/members
+type AddMemberRequest struct {
+	UserID int    `json:"user_id" binding:"required,min=1" example:"42"`
+	Role   string `json:"role" binding:"required,oneof=owner editor viewer" example:"editor"`
+}
+
+// UpdateMemberRequest is the body of PUT /groups/{id}/members/{userId}
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor viewer" example:"viewer"`
+}
+
+// TransitionRequest is the body of POST /todos/{id}/transitions
+type TransitionRequest struct {
+	To string `json:"to" binding:"required" example:"in_progress"`
+}
+
+// MoveToDoRequest is the body of POST /todos/{id}/move. The todo goes right
+// after the todo after_id, right before the todo before_id, or last in the
+// group if neither is given; both must be in the group the todo moves to. A
+// missing group_id keeps the current group.
+type MoveToDoRequest struct {
+	GroupID  uint `json:"group_id,omitempty" example:"2"`
+	AfterID  uint `json:"after_id,omitempty" example:"7"`
+	BeforeID uint `json:"before_id,omitempty" example:"8"`
+}
+
+// Batch modes: an atomic batch is applied entirely or not at all, while each
+// operation of an independent batch succeeds or fails on its own
+const (
+	BatchAtomic      = "atomic"
+	BatchIndependent = "independent"
+)
+
+// Batch operations
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchMove   = "move"
+	BatchDelete = "delete"
+)
+
+// BatchRequest is the body of POST /todos:batch. The mode defaults to atomic.
+type BatchRequest struct {
+	Mode       string           `json:"mode" binding:"omitempty,oneof=atomic independent" example:"atomic"`
+	Operations []BatchOperation `json:"operations" binding:"required,min=1,max=100,dive"`
+}
+
+// BatchOperation is one operation of a batch. Create takes a todo; update
+// takes a JSON merge patch like PATCH /todos/{id}; move takes the fields of
+// POST /todos/{id}/move. All but create name the todo by ID and may require
+// it to still be at a version, like If-Match does.
+type BatchOperation struct {
+	Op      string          `json:"op" binding:"required,oneof=create update move delete" example:"update"`
+	ID      uint            `json:"id" binding:"required_unless=Op create" example:"7"`
+	Version int             `json:"version,omitempty" example:"3"`
+	ToDo    *ToDoRequest    `json:"todo,omitempty" binding:"required_if=Op create"`
+	Patch   json.RawMessage `json:"patch,omitempty" binding:"required_if=Op update" swaggertype:"object"`
+	MoveToDoRequest
+}
+
+// ToDoRequestFrom is the request that would leave todo as it is. PATCH
+// requests are applied to it.
+func ToDoRequestFrom(todo *models.ToDo) ToDoRequest {
+	return ToDoRequest{
+		Title:    TrimmedString(todo.Title),
+		Status:   todo.Status,
+		GroupID:  todo.GroupID,
+		DueDate:  utc(todo.DueDate),
+		ParentID: todo.ParentID,
+		TagIDs:   tagIDs(todo.Tags),
+
+		Priority:        todo.Priority,
+		EstimateMinutes: todo.EstimateMinutes,
+		Recurrence:      todo.Recurrence,
+		Timezone:        todo.Timezone,
+		ReminderOffsets: reminderOffsets(todo.Reminders),
+	}
+}
+
+// tagIDs lists the IDs of tags in order, so the same tags always compare equal
+func tagIDs(tags []models.Tag) []uint {
+	if len(tags) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(tags))
+	for i, tag := range tags {
+		ids[i] = tag.ID
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// reminderOffsets lists the offsets of reminders, which are kept in the order
+// they fire
+func reminderOffsets(reminders []models.Reminder) []int {
+	if len(reminders) == 0 {
+		return nil
+	}
+	offsets := make([]int, len(reminders))
+	for i, reminder := range reminders {
+		offsets[i] = reminder.OffsetMinutes
+	}
+	return offsets
+}
+
+// UpdateGroupRequestFrom is the request that would leave group as it is
+func UpdateGroupRequestFrom(group *models.Group) UpdateGroupRequest {
+	return UpdateGroupRequest{
+		Name:     TrimmedString(group.Name),
+		Workflow: group.Workflow,
+	}
+}
+
+// utc compares due dates by instant rather than by the offset they were given in
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,266 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/models"
+)
+
+// GroupResponse is a group as returned by the API. ToDos is only set by the
+// endpoints that load them.
+type GroupResponse struct {
+	ID        uint           `json:"id"`
+	Name      string         `json:"name"`
+	OwnerID   int            `json:"owner_id"`
+	Workflow  string         `json:"workflow"`
+	ToDos     []ToDoResponse `json:"todos"`
+	CreatedAt time.Time      `json:"created_at"`
+	// Version is what the group's ETag is made from
+	Version int `json:"version"`
+	// DeletedAt is only set on groups in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ToDoResponse is a ToDo as returned by the API
+type ToDoResponse struct {
+	ID        uint       `json:"id"`
+	Title     string     `json:"title"`
+	Status    string     `json:"status"`
+	GroupID   uint       `json:"group_id"`
+	OwnerID   int        `json:"owner_id"`
+	DueDate   *time.Time `json:"due_date,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	StatusChangedBy int        `json:"status_changed_by,omitempty"`
+	// Version is what the todo's ETag is made from
+	Version int `json:"version"`
+	// Rank orders the todo within its group when compared bytewise
+	Rank     string `json:"rank" example:"V"`
+	ParentID *uint  `json:"parent_id,omitempty"`
+
+	Priority        string `json:"priority" example:"P1"`
+	EstimateMinutes *int   `json:"estimate_minutes,omitempty" example:"90"`
+	// The recurrence fields are only set on the open occurrence of a series
+	Recurrence      string     `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=SA"`
+	Timezone        string     `json:"timezone,omitempty" example:"Europe/Berlin"`
+	RecurrenceStart *time.Time `json:"recurrence_start,omitempty"`
+	SeriesID        *uint      `json:"series_id,omitempty"`
+	// Progress is only set on todos with subtasks
+	Progress  *Progress          `json:"progress,omitempty"`
+	Tags      []TagResponse      `json:"tags"`
+	Reminders []ReminderResponse `json:"reminders"`
+	// DeletedAt is only set on todos in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ReminderResponse is a reminder of a todo. RemindAt is unset when it won't
+// fire, and SentAt once it did.
+type ReminderResponse struct {
+	OffsetMinutes int        `json:"offset_minutes" example:"60"`
+	RemindAt      *time.Time `json:"remind_at,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// TagResponse is a tag as returned by the API
+type TagResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	OwnerID   int       `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Progress counts the subtasks of a todo and those of them that are closed
+type Progress struct {
+	Completed int `json:"completed" example:"2"`
+	Total     int `json:"total" example:"5"`
+}
+
+// TransitionResponse is one change of a todo's status. ToDo is the todo after
+// the change and is only set in the response to the transition itself.
+type TransitionResponse struct {
+	ToDoID     uint          `json:"todo_id"`
+	FromStatus string        `json:"from_status"`
+	ToStatus   string        `json:"to_status"`
+	ActorID    int           `json:"actor_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	ToDo       *ToDoResponse `json:"todo,omitempty"`
+}
+
+// WorkflowResponse describes a workflow groups can pick
+type WorkflowResponse struct {
+	Name        string              `json:"name"`
+	Initial     string              `json:"initial"`
+	Statuses    []string            `json:"statuses"`
+	Transitions map[string][]string `json:"transitions"`
+	Complete    []string            `json:"complete"`
+	Default     bool                `json:"default"`
+}
+
+// MemberResponse is a user a group is shared with
+type MemberResponse struct {
+	GroupID   uint      `json:"group_id"`
+	UserID    int       `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BatchResponse reports the outcome of each operation of a batch, in request
+// order. Committed is false when an atomic batch was rolled back.
+type BatchResponse struct {
+	Mode      string        `json:"mode"`
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// BatchResult is the outcome of one batch operation: the status it would have
+// got as a request of its own, and either the todo it left or the problem.
+type BatchResult struct {
+	Op     string            `json:"op"`
+	ID     uint              `json:"id,omitempty"`
+	Status int               `json:"status"`
+	ToDo   *ToDoResponse     `json:"todo,omitempty"`
+	Error  *apierror.Problem `json:"error,omitempty"`
+}
+
+// GroupPage is one page of a group listing
+type GroupPage struct {
+	Items      []GroupResponse `json:"items"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// ToDoPage is one page of a ToDo listing
+type ToDoPage struct {
+	Items      []ToDoResponse `json:"items"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// TrashResponse lists what the caller can restore: their deleted groups, and
+// the todos deleted on their own from groups they can see. Subtasks deleted
+// with their parent come back with it and aren't listed.
+type TrashResponse struct {
+	Groups []GroupResponse `json:"groups"`
+	ToDos  []ToDoResponse  `json:"todos"`
+}
+
+func NewGroupResponse(group *models.Group) GroupResponse {
+	response := GroupResponse{
+		ID:        group.ID,
+		Name:      group.Name,
+		OwnerID:   group.OwnerID,
+		Workflow:  group.Workflow,
+		CreatedAt: group.CreatedAt,
+		Version:   group.Version,
+		DeletedAt: group.DeletedAt,
+	}
+	if group.ToDos != nil {
+		response.ToDos = NewToDoResponses(group.ToDos)
+	}
+	return response
+}
+
+func NewGroupResponses(groups []models.Group) []GroupResponse {
+	responses := make([]GroupResponse, len(groups))
+	for i := range groups {
+		responses[i] = NewGroupResponse(&groups[i])
+	}
+	return responses
+}
+
+func NewToDoResponse(todo *models.ToDo) ToDoResponse {
+	response := ToDoResponse{
+		ID:        todo.ID,
+		Title:     todo.Title,
+		Status:    todo.Status,
+		GroupID:   todo.GroupID,
+		OwnerID:   todo.OwnerID,
+		DueDate:   todo.DueDate,
+		CreatedAt: todo.CreatedAt,
+
+		StatusChangedAt: todo.StatusChangedAt,
+		StatusChangedBy: todo.StatusChangedBy,
+		Version:         todo.Version,
+		Rank:            todo.Rank,
+		ParentID:        todo.ParentID,
+		Priority:        todo.Priority,
+		EstimateMinutes: todo.EstimateMinutes,
+		Recurrence:      todo.Recurrence,
+		Timezone:        todo.Timezone,
+		RecurrenceStart: todo.RecurrenceStart,
+		SeriesID:        todo.SeriesID,
+		Tags:            NewTagResponses(todo.Tags),
+		Reminders:       NewReminderResponses(todo.Reminders),
+		DeletedAt:       todo.DeletedAt,
+	}
+	if todo.SubtasksTotal > 0 {
+		response.Progress = &Progress{Completed: todo.SubtasksClosed, Total: todo.SubtasksTotal}
+	}
+	return response
+}
+
+func NewToDoResponses(todos []models.ToDo) []ToDoResponse {
+	responses := make([]ToDoResponse, len(todos))
+	for i := range todos {
+		responses[i] = NewToDoResponse(&todos[i])
+	}
+	return responses
+}
+
+func NewReminderResponses(reminders []models.Reminder) []ReminderResponse {
+	responses := make([]ReminderResponse, len(reminders))
+	for i, reminder := range reminders {
+		responses[i] = ReminderResponse{OffsetMinutes: reminder.OffsetMinutes, RemindAt: reminder.RemindAt, SentAt: reminder.SentAt}
+	}
+	return responses
+}
+
+func NewTagResponse(tag *models.Tag) TagResponse {
+	return TagResponse{
+		ID:        tag.ID,
+		Name:      tag.Name,
+		Color:     tag.Color,
+		OwnerID:   tag.OwnerID,
+		CreatedAt: tag.CreatedAt,
+	}
+}
+
+func NewTagResponses(tags []models.Tag) []TagResponse {
+	responses := make([]TagResponse, len(tags))
+	for i := range tags {
+		responses[i] = NewTagResponse(&tags[i])
+	}
+	return responses
+}
+
+func NewMemberResponse(member *models.GroupMember) MemberResponse {
+	return MemberResponse{
+		GroupID:   member.GroupID,
+		UserID:    member.UserID,
+		Role:      member.Role,
+		CreatedAt: member.CreatedAt,
+	}
+}
+
+func NewMemberResponses(members []models.GroupMember) []MemberResponse {
+	responses := make([]MemberResponse, len(members))
+	for i := range members {
+		responses[i] = NewMemberResponse(&members[i])
+	}
+	return responses
+}
+
+func NewTransitionResponses(transitions []models.ToDoTransition) []TransitionResponse {
+	responses := make([]TransitionResponse, len(transitions))
+	for i, t := range transitions {
+		responses[i] = TransitionResponse{
+			ToDoID:     t.ToDoID,
+			FromStatus: t.FromStatus,
+			ToStatus:   t.ToStatus,
+			ActorID:    t.ActorID,
+			CreatedAt:  t.CreatedAt,
+		}
+	}
+	return responses
+}
@@ -0,0 +1,188 @@
+// Package events records domain events in the transactional outbox and relays
+// them to Kafka.
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/pmas98/go-todo-service/models"
+)
+
+// SchemaVersion is bumped whenever the envelope or a payload changes incompatibly
+const SchemaVersion = 1
+
+// Topics names the topics events are published to, one per entity, and the
+// one reminders go to
+type Topics struct {
+	ToDo     string
+	Group    string
+	Reminder string
+}
+
+// DefaultTopics are the topic names used unless configured otherwise
+var DefaultTopics = Topics{ToDo: "todo-events", Group: "group-events", Reminder: "todo-reminders"}
+
+// Event types
+const (
+	ToDoCreated = "todo.created"
+	ToDoUpdated = "todo.updated"
+	ToDoDeleted = "todo.deleted"
+	// ToDoRestored is recorded when a todo comes back out of the trash
+	ToDoRestored = "todo.restored"
+	// ToDoStatusChanged follows the todo.updated event of an update that changed the status
+	ToDoStatusChanged = "todo.status_changed"
+	// ToDoReminder is recorded when a reminder of a todo comes due
+	ToDoReminder = "todo.reminder"
+	GroupCreated = "group.created"
+	GroupUpdated = "group.updated"
+	GroupDeleted = "group.deleted"
+	// GroupRestored follows the todo.restored events of the todos restored with the group
+	GroupRestored = "group.restored"
+)
+
+// Envelope is the message published for every event
+type Envelope struct {
+	ID          string      `json:"id"`
+	Type        string      `json:"type"`
+	Version     int         `json:"version"`
+	AggregateID uint        `json:"aggregate_id"`
+	ActorID     int         `json:"actor_id"`
+	OccurredAt  time.Time   `json:"occurred_at"`
+	Data        interface{} `json:"data"`
+	// Changes lists what an update changed; Data is the state after it
+	Changes models.ChangeSet `json:"changes,omitempty"`
+}
+
+// RecordToDo writes a todo event to the outbox. tx must be the transaction
+// making the change, so the event exists if and only if the change does.
+func (t Topics) RecordToDo(tx *gorm.DB, eventType string, actorID int, todo *models.ToDo) error {
+	event, err := t.NewToDoEvent(eventType, actorID, todo)
+	if err != nil {
+		return err
+	}
+	return tx.Create(event).Error
+}
+
+// RecordToDoUpdate writes a todo.updated event listing the changed fields
+func (t Topics) RecordToDoUpdate(tx *gorm.DB, actorID int, todo *models.ToDo, changes models.ChangeSet) error {
+	event, err := t.NewToDoUpdateEvent(actorID, todo, changes)
+	if err != nil {
+		return err
+	}
+	return tx.Create(event).Error
+}
+
+// RecordTransition writes a todo.status_changed event with the transition as data
+func (t Topics) RecordTransition(tx *gorm.DB, actorID int, transition *models.ToDoTransition) error {
+	event, err := t.NewTransitionEvent(actorID, transition)
+	if err != nil {
+		return err
+	}
+	return tx.Create(event).Error
+}
+
+// ReminderData is the data of a todo.reminder event
+type ReminderData struct {
+	ToDo          *models.ToDo `json:"todo"`
+	OffsetMinutes int          `json:"offset_minutes"`
+	RemindAt      time.Time    `json:"remind_at"`
+}
+
+// RecordReminder writes the todo.reminder event of a reminder that came due.
+// The service sends reminders, so no user is the actor.
+func (t Topics) RecordReminder(tx *gorm.DB, todo *models.ToDo, reminder *models.Reminder) error {
+	event, err := t.NewReminderEvent(todo, reminder)
+	if err != nil {
+		return err
+	}
+	return tx.Create(event).Error
+}
+
+// RecordGroup writes a group event to the outbox within tx
+func (t Topics) RecordGroup(tx *gorm.DB, eventType string, actorID int, group *models.Group) error {
+	event, err := t.NewGroupEvent(eventType, actorID, group)
+	if err != nil {
+		return err
+	}
+	return tx.Create(event).Error
+}
+
+// RecordGroupUpdate writes a group.updated event listing the changed fields
+func (t Topics) RecordGroupUpdate(tx *gorm.DB, actorID int, group *models.Group, changes models.ChangeSet) error {
+	event, err := t.NewGroupUpdateEvent(actorID, group, changes)
+	if err != nil {
+		return err
+	}
+	return tx.Create(event).Error
+}
+
+// NewToDoEvent builds the outbox row for a todo event
+func (t Topics) NewToDoEvent(eventType string, actorID int, todo *models.ToDo) (*models.OutboxEvent, error) {
+	return newEvent(t.ToDo, eventType, todo.ID, actorID, todo, nil)
+}
+
+// NewToDoUpdateEvent builds the outbox row for a todo.updated event
+func (t Topics) NewToDoUpdateEvent(actorID int, todo *models.ToDo, changes models.ChangeSet) (*models.OutboxEvent, error) {
+	return newEvent(t.ToDo, ToDoUpdated, todo.ID, actorID, todo, changes)
+}
+
+// NewTransitionEvent builds the outbox row for a todo.status_changed event
+func (t Topics) NewTransitionEvent(actorID int, transition *models.ToDoTransition) (*models.OutboxEvent, error) {
+	return newEvent(t.ToDo, ToDoStatusChanged, transition.ToDoID, actorID, transition, nil)
+}
+
+// NewReminderEvent builds the outbox row for a todo.reminder event
+func (t Topics) NewReminderEvent(todo *models.ToDo, reminder *models.Reminder) (*models.OutboxEvent, error) {
+	data := ReminderData{ToDo: todo, OffsetMinutes: reminder.OffsetMinutes, RemindAt: reminder.RemindAt.UTC()}
+	return newEvent(t.Reminder, ToDoReminder, todo.ID, 0, data, nil)
+}
+
+// NewGroupEvent builds the outbox row for a group event
+func (t Topics) NewGroupEvent(eventType string, actorID int, group *models.Group) (*models.OutboxEvent, error) {
+	// The todos are reported through their own events
+	snapshot := *group
+	snapshot.ToDos = nil
+	return newEvent(t.Group, eventType, group.ID, actorID, &snapshot, nil)
+}
+
+// NewGroupUpdateEvent builds the outbox row for a group.updated event
+func (t Topics) NewGroupUpdateEvent(actorID int, group *models.Group, changes models.ChangeSet) (*models.OutboxEvent, error) {
+	snapshot := *group
+	snapshot.ToDos = nil
+	return newEvent(t.Group, GroupUpdated, group.ID, actorID, &snapshot, changes)
+}
+
+func newEvent(topic, eventType string, aggregateID uint, actorID int, data interface{}, changes models.ChangeSet) (*models.OutboxEvent, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := Envelope{
+		ID:          id,
+		Type:        eventType,
+		Version:     SchemaVersion,
+		AggregateID: aggregateID,
+		ActorID:     actorID,
+		OccurredAt:  time.Now().UTC(),
+		Data:        data,
+		Changes:     changes,
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OutboxEvent{
+		EventID:   id,
+		Topic:     topic,
+		Key:       strconv.FormatUint(uint64(aggregateID), 10),
+		EventType: eventType,
+		Version:   SchemaVersion,
+		Payload:   string(payload),
+	}, nil
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/utils"
+)
+
+// relayLockKey is the Postgres advisory lock held by the relay that is
+// publishing; the value spells "outbox"
+const relayLockKey = 0x6f7574626f78
+
+// Relay publishes outbox rows to Kafka in insertion order, retrying each one
+// until the broker acknowledges it. Changes to an entity lock its row, so the
+// rows for one key are inserted in the order the changes happened.
+//
+// Every replica runs a relay, but only the one holding the advisory lock
+// publishes at a time; the others skip their turn. A single publisher is what
+// keeps the order: relays sharing the rows between them could send a later
+// event for a key before an earlier one. The publishing relay also deletes
+// rows published longer than the retention period ago.
+type Relay struct {
+	db        *gorm.DB
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+	publish   publishFunc
+}
+
+// publishFunc sends a message to a Kafka topic, returning once it is acknowledged
+type publishFunc func(topic string, message []byte, key string, headers map[string]string) error
+
+func NewRelay(db *gorm.DB, interval time.Duration, batchSize int, retention time.Duration) *Relay {
+	return &Relay{db: db, interval: interval, batchSize: batchSize, retention: retention, publish: utils.SendMessageJSONToKafkaWithHeaders}
+}
+
+// Run polls the outbox until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	log.Println("Outbox relay started")
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox relay stopped")
+			return
+		case <-ticker.C:
+			if err := r.publishBatch(ctx); err != nil {
+				log.Printf("Outbox relay: %v", err)
+			}
+		}
+	}
+}
+
+// publishBatch sends the oldest unpublished rows if no other relay is
+// publishing, then prunes a batch of old published ones. The advisory lock is
+// held on a connection of its own rather than in a transaction, so no
+// transaction stays open while Kafka is slow, and it goes away with the
+// connection if the process dies. It stops at the first failure so later
+// events never overtake an earlier one.
+func (r *Relay) publishBatch(ctx context.Context) error {
+	conn, err := r.db.DB().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", relayLockKey).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", relayLockKey); err != nil {
+			log.Printf("Outbox relay: releasing the lock: %v", err)
+		}
+	}()
+
+	if err := r.sendPending(); err != nil {
+		return err
+	}
+	return r.prune()
+}
+
+// sendPending sends the oldest unpublished rows in order. A failure to send
+// is recorded on its row and ends the batch.
+func (r *Relay) sendPending() error {
+	var pending []models.OutboxEvent
+	if err := r.db.Where("published_at IS NULL").Order("id").Limit(r.batchSize).Find(&pending).Error; err != nil {
+		return err
+	}
+
+	for _, event := range pending {
+		headers := map[string]string{
+			"event_id":   event.EventID,
+			"event_type": event.EventType,
+		}
+		if err := r.publish(event.Topic, []byte(event.Payload), event.Key, headers); err != nil {
+			return r.db.Model(&event).Updates(map[string]interface{}{
+				"attempts":   gorm.Expr("attempts + 1"),
+				"last_error": err.Error(),
+			}).Error
+		}
+
+		if err := r.db.Model(&event).Update("published_at", time.Now()).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune deletes a batch of the rows published before the retention period.
+// Nothing reads them once they are published; they are only kept a while to
+// look into what was sent.
+func (r *Relay) prune() error {
+	cutoff := time.Now().Add(-r.retention)
+	return r.db.Exec("DELETE FROM outbox_events WHERE id IN (SELECT id FROM outbox_events WHERE published_at < ? ORDER BY id LIMIT ?)", cutoff, r.batchSize).Error
+}
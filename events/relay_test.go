@@ -0,0 +1,201 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pmas98/go-todo-service/config"
+	"github.com/pmas98/go-todo-service/models"
+)
+
+// fakeProducer records what the relay publishes, failing for the keys in fail
+type fakeProducer struct {
+	mu   sync.Mutex
+	sent []string
+	fail map[string]bool
+}
+
+func (p *fakeProducer) publish(topic string, message []byte, key string, headers map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[key] {
+		return errors.New("broker unavailable")
+	}
+	p.sent = append(p.sent, headers["event_id"])
+	return nil
+}
+
+func (p *fakeProducer) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.sent...)
+}
+
+// testRelay is a relay over a wiped Postgres database publishing to producer.
+// It is skipped unless TEST_DATABASE_URL names the database.
+func testRelay(t *testing.T, producer *fakeProducer) *Relay {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := config.OpenDatabase(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, statement := range []string{"DROP SCHEMA public CASCADE", "CREATE SCHEMA public"} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRelay(db, time.Hour, 10, 24*time.Hour)
+	r.publish = producer.publish
+	return r
+}
+
+// insert adds unpublished rows to the outbox, one per key, in order
+func insert(t *testing.T, db *gorm.DB, keys ...string) []models.OutboxEvent {
+	t.Helper()
+	rows := make([]models.OutboxEvent, len(keys))
+	for i, key := range keys {
+		rows[i] = models.OutboxEvent{EventID: "event-" + key, Topic: "todo-events", Key: key, EventType: ToDoUpdated, Version: 1, Payload: "{}"}
+		if err := db.Create(&rows[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rows
+}
+
+func reload(t *testing.T, db *gorm.DB) map[string]models.OutboxEvent {
+	t.Helper()
+	var rows []models.OutboxEvent
+	if err := db.Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	byKey := make(map[string]models.OutboxEvent, len(rows))
+	for _, row := range rows {
+		byKey[row.Key] = row
+	}
+	return byKey
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	producer := &fakeProducer{fail: map[string]bool{"2": true}}
+	r := testRelay(t, producer)
+	insert(t, r.db, "1", "2", "3")
+
+	// The failure stops the batch, so 3 doesn't overtake 2
+	if err := r.publishBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := producer.published(); !reflect.DeepEqual(got, []string{"event-1"}) {
+		t.Errorf("published %v, want event-1 only", got)
+	}
+	rows := reload(t, r.db)
+	if rows["1"].PublishedAt == nil {
+		t.Error("event-1 not marked published")
+	}
+	if failed := rows["2"]; failed.PublishedAt != nil || failed.Attempts != 1 || failed.LastError != "broker unavailable" {
+		t.Errorf("failed event %+v", failed)
+	}
+	if later := rows["3"]; later.PublishedAt != nil || later.Attempts != 0 {
+		t.Errorf("event after the failure %+v", later)
+	}
+
+	// Once the broker is back the batch picks up where it stopped
+	producer.fail = nil
+	if err := r.publishBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := producer.published(); !reflect.DeepEqual(got, []string{"event-1", "event-2", "event-3"}) {
+		t.Errorf("published %v, want event-1 to event-3 in order", got)
+	}
+	for key, row := range reload(t, r.db) {
+		if row.PublishedAt == nil {
+			t.Errorf("event %s not marked published", key)
+		}
+	}
+}
+
+func TestRelayLock(t *testing.T) {
+	producer := &fakeProducer{}
+	r := testRelay(t, producer)
+	insert(t, r.db, "1")
+
+	// Another replica holds the lock on a connection of its own
+	ctx := context.Background()
+	conn, err := r.db.DB().Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", relayLockKey).Scan(&locked); err != nil || !locked {
+		t.Fatalf("taking the lock: %v %v", locked, err)
+	}
+
+	if err := r.publishBatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := producer.published(); len(got) != 0 {
+		t.Errorf("published %v while another relay held the lock", got)
+	}
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", relayLockKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.publishBatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := producer.published(); !reflect.DeepEqual(got, []string{"event-1"}) {
+		t.Errorf("published %v once the lock was free, want event-1", got)
+	}
+}
+
+func TestRelayPrune(t *testing.T) {
+	r := testRelay(t, &fakeProducer{})
+	rows := insert(t, r.db, "old", "recent", "unpublished")
+	for i, publishedAt := range map[int]time.Time{0: time.Now().Add(-25 * time.Hour), 1: time.Now().Add(-time.Hour)} {
+		if err := r.db.Model(&rows[i]).Update("published_at", publishedAt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Old rows are pruned even while the broker is down
+	r.publish = func(topic string, message []byte, key string, headers map[string]string) error {
+		return errors.New("broker unavailable")
+	}
+
+	if err := r.publishBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	left := reload(t, r.db)
+	if _, ok := left["old"]; ok || len(left) != 2 {
+		t.Errorf("left %v, want the recent and unpublished events", left)
+	}
+}
+
+func TestRelayStops(t *testing.T) {
+	r := NewRelay(nil, time.Hour, 10, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("relay still running after its context was cancelled")
+	}
+}
@@ -1,14 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
-	_ "github.com/pmas98/go-todo-service/docs"
-	"github.com/pmas98/go-todo-service/routes"
-	"github.com/pmas98/go-todo-service/utils"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
+	"github.com/pmas98/go-todo-service/app"
+	"github.com/pmas98/go-todo-service/config"
 )
 
 // Package main Product API documentation
@@ -26,26 +26,34 @@ import (
 // @name            Authorization
 // @description     Enter token in format Bearer <token>
 
-var consumerReady = make(chan struct{})
-
 func main() {
-	go func() {
-		for {
-			err := utils.InitTokenVerificationConsumer("todo-service-consumer-group")
-			if err != nil {
-				log.Printf("Failed to initialize token verification consumer: %v. Retrying in 5 seconds...", err)
-				time.Sleep(5 * time.Second)
-				continue
-			}
-			close(consumerReady)
-			return
-		}
-	}()
-	<-consumerReady
-	r := routes.SetupRouter()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// SIGINT or SIGTERM starts a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Serve Swagger UI
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	application, err := app.New(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to start: %v", err)
+	}
+	startErr := application.Start(ctx)
+	if startErr != nil {
+		log.Printf("Failed to start: %v", startErr)
+	} else {
+		<-ctx.Done()
+		log.Println("Shutting down...")
+	}
 
-	r.Run(":8081")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := application.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+	if startErr != nil {
+		os.Exit(1)
+	}
 }
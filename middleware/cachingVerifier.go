@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pmas98/go-todo-service/cache"
+	"github.com/pmas98/go-todo-service/models"
+)
+
+const (
+	tokenCacheKeyPrefix   = "auth:token:"
+	revokedTokenKeyPrefix = "auth:revoked:"
+)
+
+// CachingTokenVerifier remembers verification results in a cache so repeated
+// requests with the same token skip the underlying verifier. Valid results live
+// until the token expires (capped at ttl); invalid ones for negativeTTL.
+//
+// Revoked tokens are denylisted until they expire, or for revocationTTL when
+// their expiry is unknown, since a local verifier would otherwise go on
+// accepting them once their cached result is purged.
+type CachingTokenVerifier struct {
+	next          TokenVerifier
+	cache         cache.Cache
+	ttl           time.Duration
+	negativeTTL   time.Duration
+	revocationTTL time.Duration
+}
+
+func NewCachingTokenVerifier(next TokenVerifier, c cache.Cache, ttl, negativeTTL, revocationTTL time.Duration) *CachingTokenVerifier {
+	return &CachingTokenVerifier{
+		next:          next,
+		cache:         c,
+		ttl:           ttl,
+		negativeTTL:   negativeTTL,
+		revocationTTL: revocationTTL,
+	}
+}
+
+func (v *CachingTokenVerifier) Verify(ctx context.Context, token string) (*models.TokenVerificationResponse, error) {
+	tokenHash := HashToken(token)
+	if v.revoked(ctx, tokenHash) {
+		return &models.TokenVerificationResponse{Valid: false}, nil
+	}
+	key := tokenCacheKey(tokenHash)
+
+	// A cache failure only costs us a round-trip, so fall through to the real verifier
+	cached, err := v.cache.Get(ctx, key)
+	if err == nil {
+		var response models.TokenVerificationResponse
+		if err := json.Unmarshal(cached, &response); err == nil {
+			return &response, nil
+		}
+	} else if err != cache.ErrMiss {
+		log.Printf("Error reading token verification cache: %v", err)
+	}
+
+	response, err := v.next.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl := v.ttlFor(token, response); ttl > 0 {
+		data, err := json.Marshal(response)
+		if err == nil {
+			if err := v.cache.Set(ctx, key, data, ttl); err != nil {
+				log.Printf("Error writing token verification cache: %v", err)
+			}
+		}
+	}
+	// A revocation handled while the token was being verified has already
+	// purged the cache, so look again now that the result is cached: either
+	// the denylist entry shows up here or the purge comes after the write.
+	if response.Valid && v.revoked(ctx, tokenHash) {
+		if err := v.cache.Del(ctx, key); err != nil {
+			log.Printf("Error purging revoked token from cache: %v", err)
+		}
+		return &models.TokenVerificationResponse{Valid: false}, nil
+	}
+	return response, nil
+}
+
+// revoked reports whether a token is denylisted. The denylist is only as
+// available as the cache, so a read failure lets the token through.
+func (v *CachingTokenVerifier) revoked(ctx context.Context, tokenHash string) bool {
+	_, err := v.cache.Get(ctx, revokedTokenKey(tokenHash))
+	if err != nil && err != cache.ErrMiss {
+		log.Printf("Error reading token denylist: %v", err)
+	}
+	return err == nil
+}
+
+// Revoke denylists a token, identified by its hash, until expiresAt (a Unix
+// time, zero if unknown) and drops its cached result
+func (v *CachingTokenVerifier) Revoke(ctx context.Context, tokenHash string, expiresAt int64) error {
+	key := tokenCacheKey(tokenHash)
+	if expiresAt == 0 {
+		// A cached valid result knows when the token expires
+		if cached, err := v.cache.Get(ctx, key); err == nil {
+			var response models.TokenVerificationResponse
+			if json.Unmarshal(cached, &response) == nil {
+				expiresAt = response.ExpiresAt
+			}
+		}
+	}
+	ttl := v.revocationTTL
+	if expiresAt != 0 {
+		ttl = time.Until(time.Unix(expiresAt, 0))
+	}
+	if ttl > 0 {
+		if err := v.cache.Set(ctx, revokedTokenKey(tokenHash), []byte("1"), ttl); err != nil {
+			return err
+		}
+	}
+	return v.cache.Del(ctx, key)
+}
+
+// HandleRevocation denylists the token named by a revocation event
+func (v *CachingTokenVerifier) HandleRevocation(event models.TokenRevokedEvent) {
+	tokenHash, expiresAt := event.TokenHash, event.ExpiresAt
+	if event.Token != "" {
+		if tokenHash == "" {
+			tokenHash = HashToken(event.Token)
+		}
+		if expiresAt == 0 {
+			expiresAt = tokenExpiry(event.Token)
+		}
+	}
+	if tokenHash == "" {
+		log.Println("Ignoring token revocation event without a token")
+		return
+	}
+	if err := v.Revoke(context.Background(), tokenHash, expiresAt); err != nil {
+		log.Printf("Error revoking token: %v", err)
+	}
+}
+
+// ttlFor never lets a valid result outlive the token it was issued for
+func (v *CachingTokenVerifier) ttlFor(token string, response *models.TokenVerificationResponse) time.Duration {
+	if !response.Valid {
+		return v.negativeTTL
+	}
+
+	expiresAt := response.ExpiresAt
+	if expiresAt == 0 {
+		expiresAt = tokenExpiry(token)
+	}
+
+	ttl := v.ttl
+	if expiresAt != 0 {
+		if untilExpiry := time.Until(time.Unix(expiresAt, 0)); untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+	return ttl
+}
+
+// HashToken is the cache identity of a token, so raw tokens never land in Redis
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenCacheKey(tokenHash string) string {
+	return tokenCacheKeyPrefix + tokenHash
+}
+
+func revokedTokenKey(tokenHash string) string {
+	return revokedTokenKeyPrefix + tokenHash
+}
+
+// tokenExpiry reads the exp claim without checking the signature; it is only
+// used to bound the cache lifetime of a token the verifier already accepted.
+func tokenExpiry(token string) int64 {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		return 0
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		return int64(exp)
+	}
+	return 0
+}
@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pmas98/go-todo-service/cache"
+	"github.com/pmas98/go-todo-service/models"
+)
+
+const (
+	ttl           = 5 * time.Minute
+	negativeTTL   = 30 * time.Second
+	revocationTTL = 24 * time.Hour
+)
+
+// recordingCache remembers the TTL each key was last set with
+type recordingCache struct {
+	*cache.Memory
+	mu   sync.Mutex
+	ttls map[string]time.Duration
+}
+
+func newRecordingCache() *recordingCache {
+	return &recordingCache{Memory: cache.NewMemory(), ttls: make(map[string]time.Duration)}
+}
+
+func (c *recordingCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	c.ttls[key] = ttl
+	c.mu.Unlock()
+	return c.Memory.Set(ctx, key, value, ttl)
+}
+
+func (c *recordingCache) ttl(key string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttls[key]
+}
+
+func (c *recordingCache) has(key string) bool {
+	_, err := c.Get(context.Background(), key)
+	return err == nil
+}
+
+// stubVerifier answers with a fixed response and counts its calls. If
+// entered is set, it reports each call there and waits for release.
+type stubVerifier struct {
+	mu       sync.Mutex
+	response models.TokenVerificationResponse
+	calls    int
+	entered  chan struct{}
+	release  chan struct{}
+}
+
+func (s *stubVerifier) Verify(ctx context.Context, token string) (*models.TokenVerificationResponse, error) {
+	s.mu.Lock()
+	s.calls++
+	response := s.response
+	s.mu.Unlock()
+	if s.entered != nil {
+		s.entered <- struct{}{}
+		<-s.release
+	}
+	return &response, nil
+}
+
+func (s *stubVerifier) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// unsignedToken is a token expiring at exp, or without exp if it is zero
+func unsignedToken(t *testing.T, exp int64) string {
+	t.Helper()
+	claims := jwt.MapClaims{"user_id": 7}
+	if exp != 0 {
+		claims["exp"] = exp
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func verify(t *testing.T, v *CachingTokenVerifier, token string) *models.TokenVerificationResponse {
+	t.Helper()
+	response, err := v.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestCachingTokenVerifierTTL(t *testing.T) {
+	soon := time.Now().Add(time.Minute).Unix()
+	later := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name     string
+		token    string
+		response models.TokenVerificationResponse
+		// ttl is what the result is cached for, zero if it isn't
+		min, max time.Duration
+	}{
+		{"valid without expiry", unsignedToken(t, 0), models.TokenVerificationResponse{Valid: true, UserID: 7}, ttl, ttl},
+		{"valid past the cache TTL", unsignedToken(t, later), models.TokenVerificationResponse{Valid: true, UserID: 7, ExpiresAt: later}, ttl, ttl},
+		{"expiring before the cache TTL", unsignedToken(t, 0), models.TokenVerificationResponse{Valid: true, UserID: 7, ExpiresAt: soon}, 55 * time.Second, time.Minute},
+		{"exp claim before the cache TTL", unsignedToken(t, soon), models.TokenVerificationResponse{Valid: true, UserID: 7}, 55 * time.Second, time.Minute},
+		{"already expired", unsignedToken(t, past), models.TokenVerificationResponse{Valid: true, UserID: 7}, 0, 0},
+		{"invalid", unsignedToken(t, later), models.TokenVerificationResponse{Valid: false}, negativeTTL, negativeTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRecordingCache()
+			next := &stubVerifier{response: tt.response}
+			v := NewCachingTokenVerifier(next, c, ttl, negativeTTL, revocationTTL)
+
+			first, second := verify(t, v, tt.token), verify(t, v, tt.token)
+			if *first != tt.response || *second != tt.response {
+				t.Errorf("got %+v then %+v, want %+v", first, second, tt.response)
+			}
+			key := tokenCacheKey(HashToken(tt.token))
+			if got := c.ttl(key); got < tt.min || got > tt.max {
+				t.Errorf("cached for %s, want %s to %s", got, tt.min, tt.max)
+			}
+			wantCalls := 1
+			if tt.max == 0 {
+				wantCalls = 2
+			}
+			if next.callCount() != wantCalls {
+				t.Errorf("verified %d times, want %d", next.callCount(), wantCalls)
+			}
+		})
+	}
+
+	// Without a negative TTL invalid results aren't cached
+	next := &stubVerifier{response: models.TokenVerificationResponse{Valid: false}}
+	v := NewCachingTokenVerifier(next, newRecordingCache(), ttl, 0, revocationTTL)
+	verify(t, v, "token")
+	verify(t, v, "token")
+	if next.callCount() != 2 {
+		t.Errorf("verified %d times, want every time", next.callCount())
+	}
+}
+
+func TestCachingTokenVerifierRevocation(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	token := unsignedToken(t, exp)
+	noExpiry := unsignedToken(t, 0)
+
+	tests := []struct {
+		name  string
+		token string
+		event models.TokenRevokedEvent
+		// cached is whether the token was verified before it was revoked
+		cached bool
+		// denylisted is about how long the token stays denylisted
+		denylisted time.Duration
+	}{
+		{"raw token", token, models.TokenRevokedEvent{Token: token}, true, time.Hour},
+		{"hash with the expiry", token, models.TokenRevokedEvent{TokenHash: HashToken(token), ExpiresAt: exp}, false, time.Hour},
+		{"hash of a cached token", token, models.TokenRevokedEvent{TokenHash: HashToken(token)}, true, time.Hour},
+		{"hash of a token never seen", token, models.TokenRevokedEvent{TokenHash: HashToken(token)}, false, revocationTTL},
+		{"raw token without exp", noExpiry, models.TokenRevokedEvent{Token: noExpiry}, true, revocationTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRecordingCache()
+			// A local verifier goes on accepting the token by itself
+			next := &stubVerifier{response: models.TokenVerificationResponse{Valid: true, UserID: 7, ExpiresAt: tt.event.ExpiresAt}}
+			if tt.token == token {
+				next.response.ExpiresAt = exp
+			}
+			v := NewCachingTokenVerifier(next, c, ttl, negativeTTL, revocationTTL)
+			if tt.cached && !verify(t, v, tt.token).Valid {
+				t.Fatal("token rejected before it was revoked")
+			}
+
+			v.HandleRevocation(tt.event)
+			for i := 0; i < 2; i++ {
+				if response := verify(t, v, tt.token); response.Valid {
+					t.Errorf("revoked token accepted: %+v", response)
+				}
+			}
+			calls := 0
+			if tt.cached {
+				calls = 1
+			}
+			if next.callCount() != calls {
+				t.Errorf("verified %d times, want %d", next.callCount(), calls)
+			}
+			if c.has(tokenCacheKey(HashToken(tt.token))) {
+				t.Error("revoked token still cached")
+			}
+			if got := c.ttl(revokedTokenKey(HashToken(tt.token))); got < tt.denylisted-time.Minute || got > tt.denylisted {
+				t.Errorf("denylisted for %s, want about %s", got, tt.denylisted)
+			}
+
+			// Other tokens are unaffected
+			if !verify(t, v, unsignedToken(t, exp+1)).Valid {
+				t.Error("another token rejected")
+			}
+		})
+	}
+
+	// Nothing to denylist without a token or once it has expired
+	c := newRecordingCache()
+	v := NewCachingTokenVerifier(&stubVerifier{response: models.TokenVerificationResponse{Valid: true, UserID: 7}}, c, ttl, negativeTTL, revocationTTL)
+	v.HandleRevocation(models.TokenRevokedEvent{})
+	expired := unsignedToken(t, time.Now().Add(-time.Minute).Unix())
+	v.HandleRevocation(models.TokenRevokedEvent{Token: expired})
+	if len(c.ttls) != 0 {
+		t.Errorf("denylisted %v", c.ttls)
+	}
+}
+
+func TestRevocationDuringVerify(t *testing.T) {
+	c := newRecordingCache()
+	exp := time.Now().Add(time.Hour).Unix()
+	next := &stubVerifier{
+		response: models.TokenVerificationResponse{Valid: true, UserID: 7, ExpiresAt: exp},
+		entered:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	v := NewCachingTokenVerifier(next, c, ttl, negativeTTL, revocationTTL)
+	token := unsignedToken(t, exp)
+
+	done := make(chan *models.TokenVerificationResponse)
+	go func() {
+		response, err := v.Verify(context.Background(), token)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- response
+	}()
+	// The revocation is handled while the token is being verified
+	<-next.entered
+	v.HandleRevocation(models.TokenRevokedEvent{TokenHash: HashToken(token)})
+	close(next.release)
+
+	if response := <-done; response.Valid {
+		t.Errorf("token revoked during verification accepted: %+v", response)
+	}
+	if c.has(tokenCacheKey(HashToken(token))) {
+		t.Error("token revoked during verification cached as valid")
+	}
+	if response := verify(t, v, token); response.Valid {
+		t.Errorf("revoked token accepted afterwards: %+v", response)
+	}
+	if next.callCount() != 1 {
+		t.Errorf("verified %d times, want once", next.callCount())
+	}
+}
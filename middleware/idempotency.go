@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
+	"github.com/pmas98/go-todo-service/cache"
+)
+
+const (
+	// IdempotencyKeyHeader names a POST so that retries of it run only once
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response replayed for a retry
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	idempotencyKeyPrefix = "idempotency:"
+	maxIdempotencyKeyLen = 255
+	// idempotencyLockTTL bounds how long a key stays claimed by a request that
+	// never finishes, like one whose instance crashed
+	idempotencyLockTTL = time.Minute
+)
+
+// replayedHeaders are the response headers a replay repeats
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotencyRecord is what is stored under a key: the fingerprint of the
+// request that claimed it and, once it finished, its response.
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	// Status is zero while the request is still running
+	Status int               `json:"status,omitempty"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   []byte            `json:"body,omitempty"`
+}
+
+// Idempotency makes POST requests with an Idempotency-Key header safe to
+// retry. The first request with a key runs and its response is kept for
+// retention; retries of the same request get that response again, while
+// reusing the key for a different request fails with 422. Keys are per user.
+// Server errors aren't kept, so the request can be retried for real. It must
+// run after Authenticate.
+func Idempotency(store cache.Cache, retention time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			apierror.Abort(c, apierror.BadRequest("invalid_idempotency_key", "Idempotency-Key must be at most "+strconv.Itoa(maxIdempotencyKeyLen)+" characters"))
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierror.Abort(c, apierror.BadRequest("malformed_body", "The request body couldn't be read"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		storeKey := idempotencyKeyPrefix + strconv.Itoa(c.GetInt("userID")) + ":" + key
+		fingerprint := requestFingerprint(c.Request, body)
+		pending, _ := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+		claimed, err := store.SetNX(ctx, storeKey, pending, idempotencyLockTTL)
+		if err != nil {
+			apierror.Abort(c, idempotencyUnavailable(err))
+			return
+		}
+		if !claimed {
+			replay(c, store, storeKey, fingerprint)
+			return
+		}
+
+		recorder := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			if err := store.Del(ctx, storeKey); err != nil {
+				log.Printf("Error releasing idempotency key: %v", err)
+			}
+			return
+		}
+		record := idempotencyRecord{Fingerprint: fingerprint, Status: status, Header: map[string]string{}, Body: recorder.body.Bytes()}
+		for _, name := range replayedHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				record.Header[name] = value
+			}
+		}
+		data, err := json.Marshal(record)
+		if err == nil {
+			err = store.Set(ctx, storeKey, data, retention)
+		}
+		if err != nil {
+			log.Printf("Error storing idempotent response: %v", err)
+		}
+	}
+}
+
+// replay answers a request whose key is already taken
+func replay(c *gin.Context, store cache.Cache, storeKey, fingerprint string) {
+	data, err := store.Get(c.Request.Context(), storeKey)
+	if err == cache.ErrMiss {
+		// The first request released the key in the meantime
+		apierror.Abort(c, keyInUse())
+		return
+	} else if err != nil {
+		apierror.Abort(c, idempotencyUnavailable(err))
+		return
+	}
+	var record idempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		apierror.Abort(c, apierror.Internal("Failed to read the stored response", err))
+		return
+	}
+
+	if record.Fingerprint != fingerprint {
+		apierror.Abort(c, apierror.Unprocessable("idempotency_key_reused", "This Idempotency-Key was already used for a different request"))
+		return
+	}
+	if record.Status == 0 {
+		apierror.Abort(c, keyInUse())
+		return
+	}
+	for name, value := range record.Header {
+		c.Header(name, value)
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(record.Status, record.Header["Content-Type"], record.Body)
+	c.Abort()
+}
+
+// requestFingerprint identifies a request by its method, URI and body
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func keyInUse() *apierror.Error {
+	return apierror.Conflict("idempotency_key_in_use", "A request with this Idempotency-Key is still being processed; retry later")
+}
+
+func idempotencyUnavailable(err error) *apierror.Error {
+	return apierror.DependencyUnavailable("cache_unavailable", "The cache is unavailable, try again later", err)
+}
+
+// recordingWriter keeps a copy of the response body
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
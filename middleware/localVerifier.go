@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pmas98/go-todo-service/config"
+	"github.com/pmas98/go-todo-service/models"
+)
+
+// LocalTokenVerifier validates JWTs in-process, either HS256 against a shared
+// secret or RS256 against the keys of a JWKS file. Tokens must have an exp,
+// be within it and their nbf and, when configured, carry the expected iss and
+// aud.
+type LocalTokenVerifier struct {
+	secret   []byte
+	keys     map[string]*rsa.PublicKey
+	issuer   string
+	audience string
+}
+
+func NewLocalTokenVerifier(settings config.AuthSettings) (*LocalTokenVerifier, error) {
+	if settings.JWTSecret == "" && settings.JWKSFile == "" {
+		return nil, errors.New("local token verification needs a JWT secret or a JWKS file")
+	}
+
+	v := &LocalTokenVerifier{secret: []byte(settings.JWTSecret), issuer: settings.Issuer, audience: settings.Audience}
+	if settings.JWKSFile != "" {
+		keys, err := loadJWKS(settings.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+	}
+	return v, nil
+}
+
+func (v *LocalTokenVerifier) Verify(ctx context.Context, token string) (*models.TokenVerificationResponse, error) {
+	parser := &jwt.Parser{ValidMethods: v.validMethods()}
+
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(token, claims, v.keyFor); err != nil {
+		log.Printf("Rejected token: %v", err)
+		return &models.TokenVerificationResponse{Valid: false}, nil
+	}
+	// Parsing only checks exp if the token has one; a token without it would
+	// be good forever
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		log.Println("Rejected token: no exp claim")
+		return &models.TokenVerificationResponse{Valid: false}, nil
+	}
+	if err := v.checkIssuerAndAudience(claims); err != nil {
+		log.Printf("Rejected token: %v", err)
+		return &models.TokenVerificationResponse{Valid: false}, nil
+	}
+
+	userID, err := userIDFromClaims(claims)
+	if err != nil {
+		log.Printf("Rejected token: %v", err)
+		return &models.TokenVerificationResponse{Valid: false}, nil
+	}
+
+	response := &models.TokenVerificationResponse{
+		Valid:  true,
+		UserID: userID,
+	}
+	response.Name, _ = claims["name"].(string)
+	response.Email, _ = claims["email"].(string)
+	if exp, ok := claims["exp"].(float64); ok {
+		response.ExpiresAt = int64(exp)
+	}
+	return response, nil
+}
+
+func (v *LocalTokenVerifier) validMethods() []string {
+	var methods []string
+	if len(v.secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if len(v.keys) > 0 {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	return methods
+}
+
+// keyFor picks the verification key for the token's algorithm, so an RS256
+// public key can never be used as an HMAC secret.
+func (v *LocalTokenVerifier) keyFor(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.secret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(v.keys) == 1 {
+			for _, key := range v.keys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("no signing key with kid %q", kid)
+	default:
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+}
+
+func (v *LocalTokenVerifier) checkIssuerAndAudience(claims jwt.MapClaims) error {
+	if v.issuer != "" && !claims.VerifyIssuer(v.issuer, true) {
+		return fmt.Errorf("token issuer %v is not %q", claims["iss"], v.issuer)
+	}
+	if v.audience != "" && !hasAudience(claims, v.audience) {
+		return fmt.Errorf("token audience %v does not include %q", claims["aud"], v.audience)
+	}
+	return nil
+}
+
+// hasAudience reports whether the aud claim, a string or a list of them,
+// names audience
+func hasAudience(claims jwt.MapClaims, audience string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// userIDFromClaims reads the user ID from the user_id claim, falling back to a numeric sub
+func userIDFromClaims(claims jwt.MapClaims) (int, error) {
+	switch id := claims["user_id"].(type) {
+	case float64:
+		return int(id), nil
+	case string:
+		return strconv.Atoi(id)
+	}
+	if sub, ok := claims["sub"].(string); ok {
+		return strconv.Atoi(sub)
+	}
+	return 0, errors.New("token has no user_id or numeric sub claim")
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// loadJWKS reads the RSA signing keys of a JWKS document, keyed by kid
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS file: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding modulus of key %q: %w", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding exponent of key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS file contains no RSA signing keys")
+	}
+	return keys, nil
+}
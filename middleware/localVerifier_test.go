@@ -0,0 +1,257 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pmas98/go-todo-service/config"
+	"github.com/pmas98/go-todo-service/middleware"
+)
+
+const secret = "test-secret"
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// writeJWKS writes a JWKS document with keys under their kids and returns its path
+func writeJWKS(t *testing.T, keys map[string]interface{}) string {
+	t.Helper()
+	set := struct {
+		Keys []interface{} `json:"keys"`
+	}{}
+	for kid, key := range keys {
+		if key, ok := key.(*rsa.PrivateKey); ok {
+			set.Keys = append(set.Keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+			continue
+		}
+		set.Keys = append(set.Keys, key)
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sign signs claims with method and key, setting kid in the header if given
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestLocalTokenVerifier(t *testing.T) {
+	first, second, unlisted := generateKey(t), generateKey(t), generateKey(t)
+	jwks := writeJWKS(t, map[string]interface{}{
+		"first":  first,
+		"second": second,
+		// Keys that can't verify signatures are skipped
+		"encryption": map[string]string{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		"elliptic":   map[string]string{"kty": "EC", "kid": "elliptic", "crv": "P-256"},
+	})
+	verifier, err := middleware.NewLocalTokenVerifier(config.AuthSettings{
+		JWTSecret: secret,
+		JWKSFile:  jwks,
+		Issuer:    "https://auth.example.com",
+		Audience:  "todo-service",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	exp := now.Add(time.Hour).Unix()
+	// valid are claims every token is accepted with
+	valid := func(extra jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"user_id": 7,
+			"iss":     "https://auth.example.com",
+			"aud":     "todo-service",
+			"exp":     exp,
+		}
+		for name, value := range extra {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+	publicPEM, err := x509.MarshalPKIXPublicKey(&first.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicPEM})
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid(nil)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		userID int
+	}{
+		{"HS256", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(nil)), 7},
+		{"HS256 with another secret", sign(t, jwt.SigningMethodHS256, []byte("other"), "", valid(nil)), 0},
+		{"RS256 with the first kid", sign(t, jwt.SigningMethodRS256, first, "first", valid(nil)), 7},
+		{"RS256 with the second kid", sign(t, jwt.SigningMethodRS256, second, "second", valid(nil)), 7},
+		{"RS256 under another key's kid", sign(t, jwt.SigningMethodRS256, first, "second", valid(nil)), 0},
+		{"RS256 with an unknown kid", sign(t, jwt.SigningMethodRS256, unlisted, "unlisted", valid(nil)), 0},
+		{"RS256 without a kid among several keys", sign(t, jwt.SigningMethodRS256, first, "", valid(nil)), 0},
+		{"RS256 with a key that can't sign", sign(t, jwt.SigningMethodRS256, first, "encryption", valid(nil)), 0},
+		{"HS384", sign(t, jwt.SigningMethodHS384, []byte(secret), "", valid(nil)), 0},
+		{"RS512", sign(t, jwt.SigningMethodRS512, first, "first", valid(nil)), 0},
+		{"none", unsigned, 0},
+		{"HS256 with the public key as secret", sign(t, jwt.SigningMethodHS256, publicPEM, "first", valid(nil)), 0},
+		{"expired", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})), 0},
+		{"no expiry", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"exp": nil})), 0},
+		{"not valid yet", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()})), 0},
+		{"valid since before", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"nbf": now.Add(-time.Minute).Unix()})), 7},
+		{"another issuer", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"iss": "https://evil.example.com"})), 0},
+		{"no issuer", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"iss": nil})), 0},
+		{"another audience", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"aud": "billing"})), 0},
+		{"audience in a list", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"aud": []string{"billing", "todo-service"}})), 7},
+		{"audience missing from a list", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"aud": []string{"billing"}})), 0},
+		{"no audience", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"aud": nil})), 0},
+		{"user_id as a string", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"user_id": "8"})), 8},
+		{"numeric sub", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"user_id": nil, "sub": "9"})), 9},
+		{"non-numeric sub", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"user_id": nil, "sub": "alice"})), 0},
+		{"no user", sign(t, jwt.SigningMethodHS256, []byte(secret), "", valid(jwt.MapClaims{"user_id": nil})), 0},
+		{"garbage", "not.a.token", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := verifier.Verify(context.Background(), tt.token)
+			if err != nil {
+				t.Fatalf("invalid tokens are not errors, got %v", err)
+			}
+			if response.Valid != (tt.userID != 0) || response.UserID != tt.userID {
+				t.Errorf("got valid %t for user %d, want user %d", response.Valid, response.UserID, tt.userID)
+			}
+		})
+	}
+}
+
+func TestLocalTokenVerifierClaims(t *testing.T) {
+	verifier, err := middleware.NewLocalTokenVerifier(config.AuthSettings{JWTSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	token := sign(t, jwt.SigningMethodHS256, []byte(secret), "", jwt.MapClaims{
+		"user_id": 7,
+		"name":    "Alice",
+		"email":   "alice@example.com",
+		"exp":     exp,
+		// Checked only when configured
+		"iss": "https://auth.example.com",
+		"aud": "billing",
+	})
+	response, err := verifier.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Valid || response.UserID != 7 || response.Name != "Alice" || response.Email != "alice@example.com" || response.ExpiresAt != exp {
+		t.Errorf("got %+v", response)
+	}
+
+	// Without a JWKS file RS256 isn't accepted at all
+	response, err = verifier.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, generateKey(t), "", jwt.MapClaims{"user_id": 7, "exp": exp}))
+	if err != nil || response.Valid {
+		t.Errorf("RS256 without a JWKS file: %+v, %v", response, err)
+	}
+}
+
+func TestLocalTokenVerifierSingleKey(t *testing.T) {
+	key := generateKey(t)
+	verifier, err := middleware.NewLocalTokenVerifier(config.AuthSettings{JWKSFile: writeJWKS(t, map[string]interface{}{"only": key})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"user_id": 7, "exp": time.Now().Add(time.Hour).Unix()}
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"kid of the only key", sign(t, jwt.SigningMethodRS256, key, "only", claims), true},
+		{"no kid", sign(t, jwt.SigningMethodRS256, key, "", claims), true},
+		{"another kid", sign(t, jwt.SigningMethodRS256, key, "other", claims), false},
+		// Without a secret HS256 isn't accepted, not even with an empty key
+		{"HS256", sign(t, jwt.SigningMethodHS256, []byte(""), "", claims), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := verifier.Verify(context.Background(), tt.token)
+			if err != nil || response.Valid != tt.valid {
+				t.Errorf("got %+v, %v, want valid %t", response, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestLoadJWKS(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		name     string
+		settings config.AuthSettings
+	}{
+		{"no secret and no JWKS file", config.AuthSettings{}},
+		{"missing file", config.AuthSettings{JWKSFile: filepath.Join(t.TempDir(), "missing.json")}},
+		{"not JSON", config.AuthSettings{JWKSFile: write("{")}},
+		{"no signing keys", config.AuthSettings{JWKSFile: write(`{"keys":[{"kty":"EC","kid":"a"},{"kty":"RSA","kid":"b","use":"enc","n":"AQAB","e":"AQAB"}]}`)}},
+		{"bad modulus", config.AuthSettings{JWKSFile: write(`{"keys":[{"kty":"RSA","kid":"a","n":"!","e":"AQAB"}]}`)}},
+		{"bad exponent", config.AuthSettings{JWKSFile: write(`{"keys":[{"kty":"RSA","kid":"a","n":"AQAB","e":"!"}]}`)}},
+		// A secret doesn't make up for a broken JWKS file
+		{"secret with a broken JWKS file", config.AuthSettings{JWTSecret: secret, JWKSFile: write("{")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := middleware.NewLocalTokenVerifier(tt.settings); err == nil {
+				t.Error("built a verifier")
+			}
+		})
+	}
+}
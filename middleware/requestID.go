@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/pmas98/go-todo-service/apierror"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID gives every request an ID, reusing the caller's X-Request-ID when
+// it sends a reasonable one, and echoes it in the response. Error responses
+// include it so a failure can be matched with the logs.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			generated, err := uuid.GenerateUUID()
+			if err == nil {
+				id = generated
+			}
+		}
+		c.Set(apierror.RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pmas98/go-todo-service/config"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/utils"
+)
+
+// ErrVerificationTimeout is returned when the auth service does not answer in time
+var ErrVerificationTimeout = errors.New("timeout waiting for token verification response")
+
+// TokenVerifier checks a bearer token and reports who it belongs to. An invalid
+// token is not an error: it comes back as a response with Valid set to false.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*models.TokenVerificationResponse, error)
+}
+
+// NewTokenVerifier builds the verifier selected by the auth settings. In kafka
+// mode requests are published to requestTopic on behalf of the instance whose
+// consumer waits for the replies.
+func NewTokenVerifier(settings config.AuthSettings, requestTopic, instanceID string) (TokenVerifier, error) {
+	switch settings.Mode {
+	case config.AuthModeKafka, "":
+		return NewKafkaTokenVerifier(requestTopic, instanceID, settings.Timeout), nil
+	case config.AuthModeLocal:
+		return NewLocalTokenVerifier(settings)
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", settings.Mode)
+	}
+}
+
+// KafkaTokenVerifier asks the auth service over Kafka and waits for its reply
+type KafkaTokenVerifier struct {
+	topic      string
+	instanceID string
+	timeout    time.Duration
+}
+
+func NewKafkaTokenVerifier(topic, instanceID string, timeout time.Duration) *KafkaTokenVerifier {
+	return &KafkaTokenVerifier{topic: topic, instanceID: instanceID, timeout: timeout}
+}
+
+func (v *KafkaTokenVerifier) Verify(ctx context.Context, token string) (*models.TokenVerificationResponse, error) {
+	// Every request gets its own correlation ID so concurrent verifications
+	// can't see each other's results, and its instance can tell its replies
+	requestID, err := utils.NewCorrelationID(v.instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("generating token verification request ID: %w", err)
+	}
+
+	request := models.TokenVerificationRequest{
+		RequestID: requestID,
+		Token:     token,
+	}
+
+	// Marshal the request to JSON
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling token verification request: %w", err)
+	}
+
+	// Register the waiter before publishing so a fast response can't slip past us
+	resultCh, err := utils.RegisterTokenVerification(requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.UnregisterTokenVerification(requestID)
+
+	// Send token to Kafka for verification
+	headers := map[string]string{utils.CorrelationIDHeader: requestID}
+	if err := utils.SendMessageJSONToKafkaWithHeaders(v.topic, requestJSON, "verify", headers); err != nil {
+		return nil, fmt.Errorf("sending token for verification: %w", err)
+	}
+
+	// Wait for response from Kafka with a timeout
+	timer := time.NewTimer(v.timeout)
+	defer timer.Stop()
+
+	select {
+	case response := <-resultCh:
+		return response, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("request %s: %w", requestID, ErrVerificationTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -1,49 +1,323 @@
 package models
 
 import (
+	"sort"
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/pmas98/go-todo-service/rank"
 )
 
 type TokenVerificationResponse struct {
-	Valid  bool   `json:"valid"`
-	UserID int    `json:"user_id,omitempty"`
-	Name   string `json:"name,omitempty"`
-	Email  string `json:"email,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Valid     bool   `json:"valid"`
+	UserID    int    `json:"user_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// TokenRevokedEvent is published when a token must stop being accepted. Either
+// the raw token or its SHA-256 hex hash identifies it. ExpiresAt, the Unix
+// time the token expires, bounds how long it stays denylisted.
+type TokenRevokedEvent struct {
+	Token     string `json:"token,omitempty"`
+	TokenHash string `json:"token_hash,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
 }
 
 type TokenVerificationRequest struct {
-	Token string `json:"token"`
+	RequestID string `json:"request_id"`
+	Token     string `json:"token"`
 }
 
 type Group struct {
-	ID        uint      `json:"id" gorm:"primary_key"`
-	Name      string    `json:"name"`
+	ID      uint   `json:"id" gorm:"primary_key"`
+	Name    string `json:"name"`
+	OwnerID int    `json:"owner_id" gorm:"index"`
+	// Workflow names the workflow its todos follow. Groups from before
+	// workflows existed follow basic, whose statuses they already use.
+	Workflow  string    `json:"workflow" gorm:"not null;default:'basic'"`
 	ToDos     []ToDo    `json:"todos" gorm:"foreignkey:GroupID;constraint:OnDelete:CASCADE;"`
 	CreatedAt time.Time `json:"created_at"`
+	// Version goes up with every change to the group or to its todos, which
+	// are part of how it is shown
+	Version int `json:"version" gorm:"not null;default:1"`
+	// DeletedAt is set while the group is in the trash, which GORM leaves
+	// out of every query that isn't Unscoped
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 type ToDo struct {
+	ID        uint       `json:"id" gorm:"primary_key"`
+	Title     string     `json:"title"`
+	Status    string     `json:"status"`
+	GroupID   uint       `json:"group_id" gorm:"index:idx_todo_group_rank"`
+	OwnerID   int        `json:"owner_id" gorm:"index"`
+	DueDate   *time.Time `json:"due_date,omitempty" gorm:"index"`
+	CreatedAt time.Time  `json:"created_at"`
+	// Who last changed the status and when; unset until the first transition
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	StatusChangedBy int        `json:"status_changed_by,omitempty"`
+	// Version goes up with every change and backs the todo's ETag
+	Version int `json:"version" gorm:"not null;default:1"`
+	// Rank orders the todo within its group; see package rank
+	Rank string `json:"rank" gorm:"type:text COLLATE \"C\";not null;default:'';index:idx_todo_group_rank"`
+	// ParentID makes the todo a subtask of another todo of its group
+	ParentID *uint `json:"parent_id,omitempty" gorm:"index"`
+	// How many subtasks the todo has and how many of them are closed, kept
+	// up to date by the repositories
+	SubtasksTotal  int `json:"subtasks_total" gorm:"not null;default:0"`
+	SubtasksClosed int `json:"subtasks_closed" gorm:"not null;default:0"`
+	// Priority is one of Priorities
+	Priority string `json:"priority" gorm:"type:varchar(2);not null;default:'P2'"`
+	// EstimateMinutes is how much work the todo is expected to take
+	EstimateMinutes *int `json:"estimate_minutes,omitempty"`
+	// Recurrence is the RRULE the todo repeats by, expanded in Timezone from
+	// RecurrenceStart, the due date of the first occurrence; see package
+	// recurrence. Completing the todo hands them over to the next occurrence.
+	Recurrence      string     `json:"recurrence,omitempty" gorm:"type:varchar(500);not null;default:''"`
+	Timezone        string     `json:"timezone,omitempty" gorm:"type:varchar(64);not null;default:''"`
+	RecurrenceStart *time.Time `json:"recurrence_start,omitempty"`
+	// SeriesID is the first todo of the series of occurrences the todo is part of
+	SeriesID *uint `json:"series_id,omitempty" gorm:"index"`
+	// Tags are saved by the repositories themselves, never by GORM
+	Tags []Tag `json:"tags" gorm:"many2many:todo_tags;jointable_foreignkey:todo_id;association_jointable_foreignkey:tag_id;save_associations:false"`
+	// Reminders are scheduled and saved by the repositories too
+	Reminders []Reminder `json:"reminders" gorm:"foreignkey:ToDoID;save_associations:false"`
+	// DeletedAt is set while the todo is in the trash, like for groups. The
+	// todos deleted together share it, so they are restored together.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// Tag labels todos across groups. Every user has their own tags, with names
+// unique per user, and can put them on any todo they may edit.
+type Tag struct {
 	ID        uint      `json:"id" gorm:"primary_key"`
-	Title     string    `json:"title"`
-	Status    string    `json:"status"`
-	GroupID   uint      `json:"group_id"`
+	OwnerID   int       `json:"owner_id" gorm:"unique_index:idx_tag_owner_name"`
+	Name      string    `json:"name" gorm:"unique_index:idx_tag_owner_name"`
+	Color     string    `json:"color" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DefaultTagColor is the color of tags created without one
+const DefaultTagColor = "#808080"
+
+// ToDoTag puts a tag on a todo
+type ToDoTag struct {
+	ToDoID uint `gorm:"column:todo_id;primary_key"`
+	TagID  uint `gorm:"primary_key;index"`
+}
+
+func (ToDoTag) TableName() string {
+	return "todo_tags"
+}
+
+// Reminder notifies about a todo OffsetMinutes before it is due. RemindAt is
+// when it fires, unset if it won't: the todo has no due date or is closed, or
+// the time had already passed when the due date was set. SentAt is set once
+// it fired, which it does only once for a due date.
+type Reminder struct {
+	ID            uint       `json:"-" gorm:"primary_key"`
+	ToDoID        uint       `json:"-" gorm:"column:todo_id;not null;unique_index:idx_reminder_todo_offset"`
+	OffsetMinutes int        `json:"offset_minutes" gorm:"not null;unique_index:idx_reminder_todo_offset"`
+	RemindAt      *time.Time `json:"remind_at,omitempty" gorm:"index"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+func (Reminder) TableName() string {
+	return "todo_reminders"
+}
+
+// Priorities from most to least urgent. Todos get DefaultPriority unless
+// created with another one.
+var Priorities = []string{"P0", "P1", "P2", "P3"}
+
+const DefaultPriority = "P2"
+
+// MaxToDoDepth is how deep subtasks nest: a todo, its subtasks and theirs
+const MaxToDoDepth = 3
+
+// FieldChange is the value of a field before and after an update
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// ChangeSet describes an update by the JSON names of the fields it changed
+type ChangeSet map[string]FieldChange
+
+// Has reports whether the update changed field
+func (c ChangeSet) Has(field string) bool {
+	_, ok := c[field]
+	return ok
+}
+
+// Fields lists the changed fields in alphabetical order
+func (c ChangeSet) Fields() []string {
+	fields := make([]string, 0, len(c))
+	for field := range c {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// ToDoTransition records a change of a todo's status
+type ToDoTransition struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	ToDoID     uint      `json:"todo_id" gorm:"column:todo_id;index"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ActorID    int       `json:"actor_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Well-known statuses. The statuses a ToDo can actually be in depend on the
+// workflow of its group.
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusDone       = "done"
+	StatusCancelled  = "cancelled"
+)
+
+// ClosedStatuses mark a ToDo as finished; finished ToDos are never overdue or upcoming
+var ClosedStatuses = []string{StatusDone, StatusCancelled}
+
+// IsClosed reports whether status is one of ClosedStatuses
+func IsClosed(status string) bool {
+	for _, closed := range ClosedStatuses {
+		if status == closed {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles a user can hold in a shared group, from most to least privileged
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var roleRank = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// GroupMember shares a group with a user other than its creator
+type GroupMember struct {
+	ID        uint      `json:"-" gorm:"primary_key"`
+	GroupID   uint      `json:"group_id" gorm:"unique_index:idx_group_member"`
+	UserID    int       `json:"user_id" gorm:"unique_index:idx_group_member;index"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// IsValidRole reports whether role is one of the known group roles
+func IsValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAllows reports whether role grants at least the required role's permissions
+func RoleAllows(role, required string) bool {
+	return roleRank[role] >= roleRank[required] && roleRank[role] > 0
+}
+
 // BeforeCreate hook sets CreatedAt timestamp before creating record
 func (g *Group) BeforeCreate(scope *gorm.Scope) error {
 	g.CreatedAt = time.Now()
+	g.Version = 1
 	return nil
 }
 
 // BeforeCreate hook sets CreatedAt timestamp before creating record
 func (t *ToDo) BeforeCreate(scope *gorm.Scope) error {
 	t.CreatedAt = time.Now()
+	t.Version = 1
 	return nil
 }
 
-func AutoMigrate(db *gorm.DB) {
-	db.AutoMigrate(&Group{}, &ToDo{})
+// BeforeCreate hook sets CreatedAt timestamp before creating record
+func (t *Tag) BeforeCreate(scope *gorm.Scope) error {
+	t.CreatedAt = time.Now()
+	return nil
+}
+
+// OutboxEvent is a domain event waiting to be published to Kafka. Rows are
+// written in the same transaction as the change they describe.
+type OutboxEvent struct {
+	ID          uint   `gorm:"primary_key"`
+	EventID     string `gorm:"unique_index"`
+	Topic       string `gorm:"not null"`
+	Key         string `gorm:"not null"`
+	EventType   string `gorm:"not null"`
+	Version     int    `gorm:"not null"`
+	Payload     string `gorm:"type:text;not null"`
+	Attempts    int    `gorm:"not null;default:0"`
+	LastError   string `gorm:"type:text"`
+	CreatedAt   time.Time
+	PublishedAt *time.Time `gorm:"index"`
+}
+
+// BeforeCreate hook sets CreatedAt timestamp before creating record
+func (m *GroupMember) BeforeCreate(scope *gorm.Scope) error {
+	m.CreatedAt = time.Now()
+	return nil
+}
+
+func AutoMigrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&Group{}, &ToDo{}, &GroupMember{}, &ToDoTransition{}, &OutboxEvent{}, &Tag{}, &ToDoTag{}, &Reminder{}).Error; err != nil {
+		return err
+	}
+	// Subtasks go with their parent, even one deleted by a query that missed them
+	if err := db.Model(&ToDo{}).AddForeignKey("parent_id", "to_dos(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	// Tags come off todos when either is deleted
+	if err := db.Model(&ToDoTag{}).AddForeignKey("todo_id", "to_dos(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&ToDoTag{}).AddForeignKey("tag_id", "tags(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&Reminder{}).AddForeignKey("todo_id", "to_dos(id)", "CASCADE", "CASCADE").Error; err != nil {
+		return err
+	}
+	return rankUnranked(db)
+}
+
+// rankUnranked ranks the todos from before ranks existed after the ranked
+// ones of their group, in ID order
+func rankUnranked(db *gorm.DB) error {
+	var todos []ToDo
+	if err := db.Select("id, group_id").Where("rank = ''").Order("group_id, id").Find(&todos).Error; err != nil {
+		return err
+	}
+	last := map[uint]string{}
+	for _, todo := range todos {
+		prev, ok := last[todo.GroupID]
+		if !ok {
+			var ranks []string
+			if err := db.Model(&ToDo{}).Where("group_id = ?", todo.GroupID).Pluck("MAX(rank)", &ranks).Error; err != nil {
+				return err
+			}
+			if len(ranks) > 0 {
+				prev = ranks[0]
+			}
+		}
+		next, err := rank.After(prev)
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&todo).UpdateColumn("rank", next).Error; err != nil {
+			return err
+		}
+		last[todo.GroupID] = next
+	}
+	return nil
 }
@@ -0,0 +1,94 @@
+// Package rank orders items with strings that sort lexicographically, so an
+// item can be moved between two others by changing its own rank only.
+//
+// Ranks are strings of base 62 digits read as fractions: "V" is about a half
+// and "0V" about 1/124. Missing digits count as 0, so a rank never ends in
+// one; that keeps ranks that sort differently from being equal in value.
+// They must be compared bytewise, like Postgres does under COLLATE "C".
+package rank
+
+import (
+	"errors"
+	"strings"
+)
+
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const base = len(digits)
+
+// ErrOrder is returned when the ranks to fit one between are out of order or equal
+var ErrOrder = errors.New("ranks out of order")
+
+// ErrInvalid is returned for a string that isn't a rank
+var ErrInvalid = errors.New("invalid rank")
+
+// Between returns a rank that sorts after prev and before next. An empty prev
+// means the start of the list and an empty next its end.
+//
+// Items tend to be added at the ends of a list, so the rank for an end stays
+// close to its neighbour instead of halving the gap: appends and prepends
+// then cost a digit every 61 and 30 items rather than every few.
+func Between(prev, next string) (string, error) {
+	if !valid(prev) || !valid(next) {
+		return "", ErrInvalid
+	}
+	if next != "" && prev >= next {
+		return "", ErrOrder
+	}
+	appending := next == ""
+	prepending := prev == "" && next != ""
+
+	var rank strings.Builder
+	// bounded tells whether next still limits the digits, which it stops
+	// doing once the rank has a smaller digit than next at some position
+	bounded := next != ""
+	for i := 0; ; i++ {
+		low, high := digit(prev, i), base
+		if bounded {
+			high = digit(next, i)
+		}
+		if low == high {
+			rank.WriteByte(digits[low])
+			continue
+		}
+
+		var d int
+		switch {
+		case appending:
+			d = low + 1
+		case prepending && bounded:
+			d = high - 1
+		default:
+			d = (low + high) / 2
+		}
+		if d > low && d < high {
+			rank.WriteByte(digits[d])
+			return rank.String(), nil
+		}
+		// No room at this position: copy prev's digit and look further
+		rank.WriteByte(digits[low])
+		bounded = false
+	}
+}
+
+// After returns a rank that sorts after prev, for adding to the end of a list
+func After(prev string) (string, error) {
+	return Between(prev, "")
+}
+
+// digit is the value of the digit of rank at position i, 0 past its end
+func digit(rank string, i int) int {
+	if i >= len(rank) {
+		return 0
+	}
+	return strings.IndexByte(digits, rank[i])
+}
+
+func valid(rank string) bool {
+	for i := 0; i < len(rank); i++ {
+		if strings.IndexByte(digits, rank[i]) < 0 {
+			return false
+		}
+	}
+	return !strings.HasSuffix(rank, "0")
+}
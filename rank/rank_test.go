@@ -0,0 +1,133 @@
+package rank
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		prev, next, want string
+	}{
+		{"", "", "1"},
+		{"", "V", "U"},
+		{"V", "", "W"},
+		{"1", "3", "2"},
+		{"y", "z", "yV"},
+		// Adjacent digits leave no room, so the rank goes a digit deeper
+		{"1", "2", "1V"},
+		{"V", "V1", "V0V"},
+		{"0z", "1", "0zV"},
+		// The lowest and highest digits
+		{"", "1", "0V"},
+		{"", "01", "00V"},
+		{"z", "", "z1"},
+		{"zz", "", "zz1"},
+		{"y", "", "z"},
+		{"", "z", "y"},
+	}
+	for _, tt := range tests {
+		got, err := Between(tt.prev, tt.next)
+		if err != nil {
+			t.Errorf("Between(%q, %q): %v", tt.prev, tt.next, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Between(%q, %q) = %q, want %q", tt.prev, tt.next, got, tt.want)
+		}
+		if got <= tt.prev || tt.next != "" && got >= tt.next {
+			t.Errorf("Between(%q, %q) = %q is out of order", tt.prev, tt.next, got)
+		}
+	}
+}
+
+func TestBetweenErrors(t *testing.T) {
+	tests := []struct {
+		prev, next string
+		want       error
+	}{
+		{"2", "1", ErrOrder},
+		{"1", "1", ErrOrder},
+		{"1V", "1", ErrOrder},
+		{"a-", "", ErrInvalid},
+		{"", "ä", ErrInvalid},
+		// Trailing zeros would make ranks equal in value sort apart
+		{"10", "", ErrInvalid},
+		{"", "0", ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := Between(tt.prev, tt.next); !errors.Is(err, tt.want) {
+			t.Errorf("Between(%q, %q): %v, want %v", tt.prev, tt.next, err, tt.want)
+		}
+	}
+}
+
+// TestRepeatedInserts inserts at random positions and always at the same one,
+// checking every rank lands between its neighbours
+func TestRepeatedInserts(t *testing.T) {
+	positions := map[string]func(r *rand.Rand, n int) int{
+		"random":            func(r *rand.Rand, n int) int { return r.Intn(n + 1) },
+		"start":             func(r *rand.Rand, n int) int { return 0 },
+		"end":               func(r *rand.Rand, n int) int { return n },
+		"after the first":   func(r *rand.Rand, n int) int { return min(1, n) },
+		"before the last":   func(r *rand.Rand, n int) int { return max(n-1, 0) },
+		"in the middle":     func(r *rand.Rand, n int) int { return n / 2 },
+		"second to the end": func(r *rand.Rand, n int) int { return max(n-2, 0) },
+	}
+	for name, position := range positions {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			var ranks []string
+			for i := 0; i < 500; i++ {
+				at := position(r, len(ranks))
+				var prev, next string
+				if at > 0 {
+					prev = ranks[at-1]
+				}
+				if at < len(ranks) {
+					next = ranks[at]
+				}
+				rank, err := Between(prev, next)
+				if err != nil {
+					t.Fatalf("insert %d between %q and %q: %v", i, prev, next, err)
+				}
+				if !valid(rank) || rank <= prev || next != "" && rank >= next {
+					t.Fatalf("insert %d between %q and %q got %q", i, prev, next, rank)
+				}
+				ranks = append(ranks[:at], append([]string{rank}, ranks[at:]...)...)
+			}
+			if !sort.StringsAreSorted(ranks) {
+				t.Error("ranks out of order")
+			}
+		})
+	}
+}
+
+// TestGrowth pins how fast ranks grow at the ends of a list. There is no
+// rebalancing, so they grow linearly: a digit every 61 appends and every 30
+// prepends.
+func TestGrowth(t *testing.T) {
+	last := ""
+	for i := 0; i < 1000; i++ {
+		var err error
+		if last, err = After(last); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(last) != 17 {
+		t.Errorf("1,000 appends give a %d digit rank %q, want 17", len(last), last)
+	}
+
+	first := ""
+	for i := 0; i < 1000; i++ {
+		var err error
+		if first, err = Between("", first); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(first) != 34 {
+		t.Errorf("1,000 prepends give a %d digit rank %q, want 34", len(first), first)
+	}
+}
@@ -0,0 +1,132 @@
+// Package recurrence expands the RFC 5545 recurrence rules todos repeat by.
+//
+// A rule is anchored at the due date of the first todo of its series and
+// expanded in the series' timezone, so occurrences keep their wall-clock time
+// when daylight saving time starts or ends. Expanding always starts from that
+// anchor, which makes the next occurrence after a given time the same however
+// many occurrences were completed or skipped on the way, and lets COUNT and
+// UNTIL end the series where they should.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	// Timezones must resolve the same wherever the service runs
+	_ "time/tzdata"
+
+	"github.com/teambition/rrule-go"
+)
+
+// ErrInvalid is returned for rules and timezones that can't be used
+var ErrInvalid = errors.New("invalid recurrence")
+
+// Rule is a recurrence rule anchored at its first occurrence. It is expanded
+// over wall-clock readings, kept as UTC times, which only become instants in
+// its location once picked, so no DST change can shift them.
+type Rule struct {
+	rrule *rrule.RRule
+	loc   *time.Location
+}
+
+// Normalize checks an RRULE value, with or without its "RRULE:" prefix, and
+// returns it in canonical form. A local UNTIL is read in timezone.
+func Normalize(value, timezone string) (string, error) {
+	loc, err := LoadLocation(timezone)
+	if err != nil {
+		return "", err
+	}
+	option, err := parse(value, loc)
+	if err != nil {
+		return "", err
+	}
+	return option.RRuleString(), nil
+}
+
+// New anchors a rule value at start, expanding it in timezone
+func New(value, timezone string, start time.Time) (*Rule, error) {
+	loc, err := LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	option, err := parse(value, loc)
+	if err != nil {
+		return nil, err
+	}
+	option.Dtstart = wallClock(start, loc)
+	if !option.Until.IsZero() {
+		option.Until = wallClock(option.Until, loc)
+	}
+	r, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return &Rule{rrule: r, loc: loc}, nil
+}
+
+// Next returns the first occurrence strictly after t, in UTC, or false once
+// the series has ended
+func (r *Rule) Next(t time.Time) (time.Time, bool) {
+	next := r.rrule.After(wallClock(t, r.loc), false)
+	if next.IsZero() {
+		return time.Time{}, false
+	}
+	return instant(next, r.loc).UTC(), true
+}
+
+// wallClock is the reading of a clock in loc at t, as a UTC time
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// instant is when clocks in loc read wall. As RFC 5545 says, a reading that
+// happens twice when DST ends is its first time, and one skipped when DST
+// starts uses the UTC offset from before the gap, landing just after it.
+func instant(wall time.Time, loc *time.Location) time.Time {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+	if wallClock(t, loc).Equal(wall) {
+		return t
+	}
+	_, before := t.Add(-24 * time.Hour).Zone()
+	return wall.Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+// LoadLocation resolves an IANA timezone name. Unlike time.LoadLocation it
+// doesn't take an empty name for UTC or "Local" for the server's timezone.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalid, name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalid, name)
+	}
+	return loc, nil
+}
+
+func parse(value string, loc *time.Location) (*rrule.ROption, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	// The due date of the first todo is the start, so the rule can't set one
+	if strings.ContainsAny(value, "\r\n") || strings.Contains(value, "DTSTART") {
+		return nil, fmt.Errorf("%w: the rule can't set DTSTART; the series starts at the due date", ErrInvalid)
+	}
+	option, err := rrule.StrToROptionInLocation(value, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	// Todos don't repeat faster than hourly, which also bounds the work of
+	// expanding a rule from its anchor
+	if option.Freq == rrule.MINUTELY || option.Freq == rrule.SECONDLY {
+		return nil, fmt.Errorf("%w: FREQ must be HOURLY or longer", ErrInvalid)
+	}
+	if option.Interval < 0 || option.Count < 0 {
+		return nil, fmt.Errorf("%w: INTERVAL and COUNT can't be negative", ErrInvalid)
+	}
+	// Checks the BY* values are in range
+	if _, err := rrule.NewRRule(*option); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return option, nil
+}
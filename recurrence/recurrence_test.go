@@ -0,0 +1,177 @@
+package recurrence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func at(t *testing.T, timezone, value string) time.Time {
+	t.Helper()
+	loc, err := LoadLocation(timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestNextAcrossDST(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		timezone string
+		start    string
+		// want are the UTC times of the occurrences after start
+		want []string
+		// ends says the series has no more occurrences
+		ends bool
+	}{
+		{
+			name:     "daily across spring forward keeps the local time",
+			rule:     "FREQ=DAILY",
+			timezone: "Europe/Berlin",
+			start:    "2025-03-29 09:00",
+			want:     []string{"2025-03-30T07:00:00Z", "2025-03-31T07:00:00Z"},
+		},
+		{
+			name:     "weekly across fall back keeps the local time",
+			rule:     "FREQ=WEEKLY;BYDAY=MO",
+			timezone: "America/New_York",
+			start:    "2025-10-27 18:00",
+			want:     []string{"2025-11-03T23:00:00Z", "2025-11-10T23:00:00Z"},
+		},
+		{
+			name:     "a local time skipped by spring forward moves past the gap",
+			rule:     "FREQ=DAILY",
+			timezone: "America/New_York",
+			start:    "2025-03-08 02:30",
+			want:     []string{"2025-03-09T07:30:00Z", "2025-03-10T06:30:00Z"},
+		},
+		{
+			name:     "a local time repeated by fall back happens once",
+			rule:     "FREQ=DAILY",
+			timezone: "America/New_York",
+			start:    "2025-11-01 01:30",
+			want:     []string{"2025-11-02T05:30:00Z", "2025-11-03T06:30:00Z"},
+		},
+		{
+			name:     "southern hemisphere",
+			rule:     "FREQ=WEEKLY",
+			timezone: "Australia/Sydney",
+			start:    "2025-03-30 08:00",
+			want:     []string{"2025-04-05T22:00:00Z", "2025-04-12T22:00:00Z"},
+		},
+		{
+			name:     "monthly on the 31st skips shorter months",
+			rule:     "FREQ=MONTHLY;BYMONTHDAY=31",
+			timezone: "UTC",
+			start:    "2025-01-31 12:00",
+			want:     []string{"2025-03-31T12:00:00Z", "2025-05-31T12:00:00Z"},
+		},
+		{
+			name:     "count ends the series",
+			rule:     "FREQ=DAILY;COUNT=2",
+			timezone: "UTC",
+			start:    "2025-06-01 10:00",
+			want:     []string{"2025-06-02T10:00:00Z"},
+			ends:     true,
+		},
+		{
+			name:     "a local until is read in the timezone",
+			rule:     "FREQ=DAILY;UNTIL=20250602T100000",
+			timezone: "Asia/Tokyo",
+			start:    "2025-06-01 10:00",
+			want:     []string{"2025-06-02T01:00:00Z"},
+			ends:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := at(t, tt.timezone, tt.start)
+			rule, err := New(tt.rule, tt.timezone, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			next, ok := start, true
+			for len(got) < len(tt.want) {
+				if next, ok = rule.Next(next); !ok {
+					break
+				}
+				got = append(got, next.Format(time.RFC3339))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("occurrences %v, want %v", got, tt.want)
+			}
+			if _, more := rule.Next(next); more == tt.ends {
+				t.Errorf("series goes on after %s: %v, want %v", got[len(got)-1], more, !tt.ends)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("occurrence %d is %s, want %s", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNextIsDeterministic(t *testing.T) {
+	start := at(t, "Europe/London", "2025-03-01 07:15")
+	rule, err := New("FREQ=WEEKLY;INTERVAL=2;BYDAY=SA,SU", "Europe/London", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stepped := start
+	for i := 0; i < 10; i++ {
+		stepped, _ = rule.Next(stepped)
+	}
+
+	// A rule made again from the same anchor agrees, even when asked from a
+	// time between occurrences, as for a todo done late
+	again, err := New("RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=SA,SU", "Europe/London", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, ok := again.Next(stepped.Add(-time.Minute))
+	if !ok || !next.Equal(stepped) {
+		t.Errorf("next from just before the 10th occurrence is %s, want %s", next, stepped)
+	}
+	if want := "2025-05-10T06:15:00Z"; stepped.Format(time.RFC3339) != want {
+		t.Errorf("10th occurrence is %s, want %s, 07:15 BST", stepped.Format(time.RFC3339), want)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		rule     string
+		timezone string
+		want     string
+		invalid  bool
+	}{
+		{rule: "rrule:freq=weekly;byday=mo,we", timezone: "UTC", want: "FREQ=WEEKLY;BYDAY=MO,WE"},
+		{rule: "FREQ=DAILY;UNTIL=20250602T100000", timezone: "Asia/Tokyo", want: "FREQ=DAILY;UNTIL=20250602T010000Z"},
+		{rule: "FREQ=MINUTELY", timezone: "UTC", invalid: true},
+		{rule: "FREQ=DAILY;BYHOUR=25", timezone: "UTC", invalid: true},
+		{rule: "FREQ=WEEKLY;BYDAY=XX", timezone: "UTC", invalid: true},
+		{rule: "BYDAY=MO", timezone: "UTC", invalid: true},
+		{rule: "DTSTART:20250101T000000Z\nRRULE:FREQ=DAILY", timezone: "UTC", invalid: true},
+		{rule: "FREQ=DAILY", timezone: "Mars/Olympus_Mons", invalid: true},
+		{rule: "FREQ=DAILY", timezone: "Local", invalid: true},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.rule, tt.timezone)
+		if tt.invalid {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("%q in %s: error %v, want ErrInvalid", tt.rule, tt.timezone, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q in %s: got %q, %v, want %q", tt.rule, tt.timezone, got, err, tt.want)
+		}
+	}
+}
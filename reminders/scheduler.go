@@ -0,0 +1,57 @@
+// Package reminders fires the reminders of todos as they come due.
+//
+// Reminders are rows in Postgres. Firing one records its todo.reminder event
+// in the outbox and marks it sent in the same transaction, and the outbox
+// relay publishes the event to Kafka. Every replica runs a scheduler; due
+// rows are claimed with FOR UPDATE SKIP LOCKED, so each reminder fires once.
+package reminders
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// Scheduler polls for due reminders and fires them
+type Scheduler struct {
+	reminders repository.ReminderRepository
+	interval  time.Duration
+	batchSize int
+}
+
+func NewScheduler(reminders repository.ReminderRepository, interval time.Duration, batchSize int) *Scheduler {
+	return &Scheduler{reminders: reminders, interval: interval, batchSize: batchSize}
+}
+
+// Run fires due reminders until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Println("Reminder scheduler started")
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Reminder scheduler stopped")
+			return
+		case <-ticker.C:
+			if err := s.fireDue(ctx); err != nil {
+				log.Printf("Reminder scheduler: %v", err)
+			}
+		}
+	}
+}
+
+// fireDue fires every reminder due by now, a batch per transaction
+func (s *Scheduler) fireDue(ctx context.Context) error {
+	now := time.Now()
+	for ctx.Err() == nil {
+		fired, err := s.reminders.FireDue(ctx, now, s.batchSize)
+		if err != nil || fired < s.batchSize {
+			return err
+		}
+	}
+	return nil
+}
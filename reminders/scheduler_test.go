@@ -0,0 +1,114 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// result is what a call to FireDue returns
+type result struct {
+	fired int
+	err   error
+}
+
+// fakeReminders answers FireDue with results in turn, then with nothing due.
+// Every call is reported on calls.
+type fakeReminders struct {
+	mu      sync.Mutex
+	results []result
+	limits  []int
+	calls   chan time.Time
+}
+
+func (f *fakeReminders) FireDue(ctx context.Context, now time.Time, limit int) (int, error) {
+	f.mu.Lock()
+	f.limits = append(f.limits, limit)
+	r := result{}
+	if len(f.results) > 0 {
+		r, f.results = f.results[0], f.results[1:]
+	}
+	f.mu.Unlock()
+	f.calls <- now
+	return r.fired, r.err
+}
+
+// start runs a scheduler over f until the returned function cancels it. That
+// fails the test unless the scheduler returns soon after, and otherwise gives
+// what it logged.
+func start(t *testing.T, f *fakeReminders, batchSize int) func() string {
+	t.Helper()
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewScheduler(f, time.Millisecond, batchSize).Run(ctx)
+		close(done)
+	}()
+	return func() string {
+		cancel()
+		for {
+			select {
+			case <-done:
+				return logs.String()
+			case <-f.calls:
+			case <-time.After(time.Second):
+				t.Fatal("scheduler still running after its context was cancelled")
+			}
+		}
+	}
+}
+
+func TestSchedulerFiresEveryBatch(t *testing.T) {
+	f := &fakeReminders{results: []result{{fired: 2}, {fired: 2}, {fired: 1}}, calls: make(chan time.Time)}
+	stop := start(t, f, 2)
+
+	// Full batches are followed by another one in the same tick, all due by
+	// the time the tick started
+	first := <-f.calls
+	for i := 0; i < 2; i++ {
+		if now := <-f.calls; !now.Equal(first) {
+			t.Errorf("batch %d fired reminders due by %v, want %v", i+2, now, first)
+		}
+	}
+	// The next tick starts over
+	if now := <-f.calls; !now.After(first) {
+		t.Errorf("next tick fired reminders due by %v, want after %v", now, first)
+	}
+	logs := stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, limit := range f.limits {
+		if limit != 2 {
+			t.Errorf("fired up to %d reminders, want the batch size", limit)
+		}
+	}
+	if !strings.Contains(logs, "Reminder scheduler stopped") {
+		t.Errorf("logged %q", logs)
+	}
+}
+
+func TestSchedulerKeepsGoingAfterErrors(t *testing.T) {
+	f := &fakeReminders{results: []result{{err: errors.New("connection refused")}, {fired: 1}}, calls: make(chan time.Time)}
+	stop := start(t, f, 2)
+
+	// The error ends the tick, and the next one tries again
+	first := <-f.calls
+	if now := <-f.calls; !now.After(first) {
+		t.Errorf("retried in the same tick")
+	}
+	<-f.calls
+	if logs := stop(); !strings.Contains(logs, "Reminder scheduler: connection refused") {
+		t.Errorf("error not logged: %q", logs)
+	}
+}
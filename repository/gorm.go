@@ -0,0 +1,1122 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pmas98/go-todo-service/events"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/rank"
+)
+
+// Gorm stores groups and todos in Postgres
+type Gorm struct {
+	db     *gorm.DB
+	topics events.Topics
+}
+
+// NewGorm stores data in db and records events for the given topics
+func NewGorm(db *gorm.DB, topics events.Topics) *Gorm {
+	return &Gorm{db: db, topics: topics}
+}
+
+func (g *Gorm) Groups() GroupRepository {
+	return &gormGroups{db: g.db, topics: g.topics}
+}
+
+func (g *Gorm) Todos() TodoRepository {
+	return &gormTodos{db: g.db, topics: g.topics}
+}
+
+func (g *Gorm) Tags() TagRepository {
+	return &gormTags{db: g.db}
+}
+
+func (g *Gorm) Reminders() ReminderRepository {
+	return &gormReminders{db: g.db, topics: g.topics}
+}
+
+func (g *Gorm) Trash() TrashRepository {
+	return &gormTrash{db: g.db}
+}
+
+// ORDER BY expressions of the sort fields; due_date uses the same stand-in as noDueDate
+var sortExpressions = map[string]string{
+	"id":         "id",
+	"created_at": "created_at",
+	"due_date":   "COALESCE(due_date, '9999-12-31 00:00:00+00')",
+	"title":      "title",
+	"name":       "name",
+	"rank":       "rank",
+}
+
+// accessibleGroupIDs selects the IDs of the groups a user owns or is a member
+// of, leaving out those in the trash
+const accessibleGroupIDs = "SELECT id FROM groups WHERE deleted_at IS NULL AND (owner_id = ? OR id IN (SELECT group_id FROM group_members WHERE user_id = ?))"
+
+// lockVersion locks a row of table for the rest of the transaction, failing
+// with ErrVersionConflict unless it is still at version. Rows that are gone
+// are reported as not found.
+func lockVersion(tx *gorm.DB, table string, id uint, version int) error {
+	var row struct{ Version int }
+	err := tx.Table(table).Set("gorm:query_option", "FOR UPDATE").Select("version").Where("id = ?", id).Take(&row).Error
+	if err != nil {
+		return translateError(err)
+	}
+	if row.Version != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// lockParent locks the parent a subtask is being added to, failing with
+// ErrVersionConflict if it is gone or in the trash. Todos are locked before
+// the groups their changes touch, so transactions that lock both always do so
+// in that order.
+func lockParent(tx *gorm.DB, id uint) error {
+	var row struct{ ID uint }
+	err := tx.Table("to_dos").Set("gorm:query_option", "FOR UPDATE").Select("id").Where("id = ? AND deleted_at IS NULL", id).Take(&row).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// lockGroupToDos locks the todos query finds in a group, in id order, before
+// the group itself is locked
+func lockGroupToDos(query *gorm.DB, groupID uint) error {
+	var ids []uint
+	return query.Model(&models.ToDo{}).Set("gorm:query_option", "FOR UPDATE").Where("group_id = ?", groupID).Order("id").Pluck("id", &ids).Error
+}
+
+// recountSubtasks updates the subtask counts of parents after a change to
+// their subtasks, moving their versions on
+func recountSubtasks(tx *gorm.DB, ids ...uint) error {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		var counts struct{ Total, Closed int }
+		err := tx.Model(&models.ToDo{}).
+			Select("COUNT(*) AS total, COUNT(CASE WHEN status IN (?) THEN 1 END) AS closed", models.ClosedStatuses).
+			Where("parent_id = ?", id).Scan(&counts).Error
+		if err != nil {
+			return err
+		}
+		columns := map[string]interface{}{"subtasks_total": counts.Total, "subtasks_closed": counts.Closed, "version": gorm.Expr("version + 1")}
+		if err := tx.Model(&models.ToDo{}).Where("id = ?", id).UpdateColumns(columns).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subtasksOf loads the subtasks of a todo at every level, one level at a
+// time. Those in the trash are only found with an Unscoped tx.
+func subtasksOf(tx *gorm.DB, id uint) ([]models.ToDo, error) {
+	var subtasks []models.ToDo
+	for parents := []uint{id}; len(parents) > 0; {
+		var level []models.ToDo
+		if err := tx.Where("parent_id IN (?)", parents).Preload("Tags", byName).Preload("Reminders", byOffset).Order("id").Find(&level).Error; err != nil {
+			return nil, err
+		}
+		parents = nil
+		for _, todo := range level {
+			parents = append(parents, todo.ID)
+		}
+		subtasks = append(subtasks, level...)
+	}
+	return subtasks, nil
+}
+
+// touchGroups moves the version of groups on after a change to their todos.
+// They are updated in ID order so concurrent transactions lock them in the
+// same order.
+func touchGroups(tx *gorm.DB, ids ...uint) error {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		if err := tx.Model(&models.Group{}).Where("id = ?", id).UpdateColumn("version", gorm.Expr("version + 1")).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// byRank orders the todos preloaded into groups
+func byRank(db *gorm.DB) *gorm.DB {
+	return db.Order("rank, id")
+}
+
+// byName orders the tags preloaded into todos
+func byName(db *gorm.DB) *gorm.DB {
+	return db.Order("name, id")
+}
+
+// byOffset orders the reminders preloaded into todos the way they fire
+func byOffset(db *gorm.DB) *gorm.DB {
+	return db.Order("offset_minutes DESC")
+}
+
+// saveReminders schedules the reminders of todo and saves them in place of
+// the stored ones. Unless offsets is set, todo keeps the offsets it has.
+func saveReminders(tx *gorm.DB, todo *models.ToDo, offsets, reschedule bool) error {
+	var stored []models.Reminder
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("todo_id = ?", todo.ID).Find(&stored).Error; err != nil {
+		return err
+	}
+	if !offsets {
+		todo.Reminders = stored
+	}
+	planned := planReminders(todo, stored, reschedule, time.Now())
+	kept := map[int]bool{}
+	for _, reminder := range planned {
+		kept[reminder.OffsetMinutes] = true
+	}
+	for i := range stored {
+		if kept[stored[i].OffsetMinutes] {
+			continue
+		}
+		if err := tx.Delete(&stored[i]).Error; err != nil {
+			return err
+		}
+	}
+	for i := range planned {
+		if err := tx.Save(&planned[i]).Error; err != nil {
+			return err
+		}
+	}
+	todo.Reminders = planned
+	return nil
+}
+
+// saveTags puts the tags of todo on it
+func saveTags(tx *gorm.DB, todo *models.ToDo) error {
+	for _, tag := range todo.Tags {
+		if err := tx.Create(&models.ToDoTag{ToDoID: todo.ID, TagID: tag.ID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// touchTagged locks the todos a tag is on and moves their versions on, and
+// those of their groups, returning the todos as they were
+func touchTagged(tx *gorm.DB, tagID uint) ([]models.ToDo, error) {
+	var todos []models.ToDo
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id IN (SELECT todo_id FROM todo_tags WHERE tag_id = ?)", tagID).Order("id").Find(&todos).Error
+	if err != nil || len(todos) == 0 {
+		return todos, err
+	}
+	ids := make([]uint, len(todos))
+	groupIDs := make([]uint, len(todos))
+	for i, todo := range todos {
+		ids[i], groupIDs[i] = todo.ID, todo.GroupID
+	}
+	if err := tx.Model(&models.ToDo{}).Where("id IN (?)", ids).UpdateColumn("version", gorm.Expr("version + 1")).Error; err != nil {
+		return nil, err
+	}
+	return todos, touchGroups(tx, groupIDs...)
+}
+
+// taggedToDoIDs selects the IDs of the todos with the user's tags named in q
+func taggedToDoIDs(db *gorm.DB, userID int, q ListQuery) *gorm.SqlExpr {
+	query := db.Table("todo_tags").Select("todo_tags.todo_id").
+		Joins("JOIN tags ON tags.id = todo_tags.tag_id").
+		Where("tags.owner_id = ? AND tags.name IN (?)", userID, q.Tags)
+	if q.TagMode == TagsAll {
+		query = query.Group("todo_tags.todo_id").Having("COUNT(*) = ?", len(q.Tags))
+	}
+	return query.SubQuery()
+}
+
+// placementBounds returns the ranks a todo placed at p goes between, leaving
+// the todo itself out. The groups involved must be locked, so nothing else is
+// ranked in them at the same time.
+func placementBounds(tx *gorm.DB, todoID uint, p Placement) (prev, next string, err error) {
+	others := tx.Model(&models.ToDo{}).Where("group_id = ? AND id <> ?", p.GroupID, todoID)
+	if p.After != 0 {
+		if prev, err = neighbourRank(others, p.After); err != nil {
+			return "", "", err
+		}
+	}
+	if p.Before != 0 {
+		if next, err = neighbourRank(others, p.Before); err != nil {
+			return "", "", err
+		}
+	}
+	switch {
+	case p.After != 0 && p.Before == 0:
+		next, err = firstRank(others.Where("rank > ?", prev), "rank")
+	case p.After == 0 && p.Before != 0:
+		prev, err = firstRank(others.Where("rank < ?", next), "rank DESC")
+	case p.After == 0 && p.Before == 0:
+		prev, err = firstRank(others, "rank DESC")
+	}
+	return prev, next, err
+}
+
+// neighbourRank is the rank of a neighbour in a placement, which must be
+// among the todos others selects
+func neighbourRank(others *gorm.DB, id uint) (string, error) {
+	var ranks []string
+	if err := others.Where("id = ?", id).Pluck("rank", &ranks).Error; err != nil {
+		return "", err
+	}
+	if len(ranks) == 0 {
+		return "", ErrVersionConflict
+	}
+	return ranks[0], nil
+}
+
+// firstRank returns the first rank of the todos query selects in order, or "" if there are none
+func firstRank(query *gorm.DB, order string) (string, error) {
+	var ranks []string
+	if err := query.Order(order).Limit(1).Pluck("rank", &ranks).Error; err != nil || len(ranks) == 0 {
+		return "", err
+	}
+	return ranks[0], nil
+}
+
+// rankLast ranks todo after the other todos of its group
+func rankLast(tx *gorm.DB, todo *models.ToDo) error {
+	last, _, err := placementBounds(tx, todo.ID, Placement{GroupID: todo.GroupID})
+	if err != nil {
+		return err
+	}
+	todo.Rank, err = rank.After(last)
+	return err
+}
+
+func translateError(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// applyListQuery adds the filters, keyset condition, ordering and limit to a
+// query. One extra row is fetched so callers can tell if there is a next page.
+func applyListQuery(query *gorm.DB, q ListQuery, searchColumn string) (*gorm.DB, error) {
+	if len(q.Status) > 0 {
+		query = query.Where("status IN (?)", q.Status)
+	}
+	if q.GroupID != 0 {
+		query = query.Where("group_id = ?", q.GroupID)
+	}
+	if q.Search != "" {
+		query = query.Where(searchColumn+" ILIKE ?", "%"+escapeLike(q.Search)+"%")
+	}
+	if q.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *q.CreatedAfter)
+	}
+	if q.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *q.CreatedBefore)
+	}
+	if q.DueAfter != nil {
+		query = query.Where("due_date >= ?", *q.DueAfter)
+	}
+	if q.DueBefore != nil {
+		query = query.Where("due_date < ?", *q.DueBefore)
+	}
+
+	direction, op := "ASC", ">"
+	if q.Desc {
+		direction, op = "DESC", "<"
+	}
+	if q.Sort == "smart" {
+		return applySmartOrder(query, q, direction, op)
+	}
+	expr, ok := sortExpressions[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported sort %q", ErrInvalidQuery, q.Sort)
+	}
+
+	if q.After != nil {
+		value, err := parseCursorValue(q.Sort, q.After.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad cursor value", ErrInvalidQuery)
+		}
+		// The id tiebreaker keeps the order total, so no row is skipped or repeated
+		query = query.Where(fmt.Sprintf("(%[1]s %[2]s ?) OR (%[1]s = ? AND id %[2]s ?)", expr, op), value, value, q.After.ID)
+	}
+
+	return query.
+		Order(fmt.Sprintf("%s %s, id %s", expr, direction, direction)).
+		Limit(q.Limit + 1), nil
+}
+
+// applySmartOrder orders todos overdue at q.Now first, then by priority, due
+// date and rank, the fields smartValue joins for the cursor
+func applySmartOrder(query *gorm.DB, q ListQuery, direction, op string) (*gorm.DB, error) {
+	closed := strings.TrimSuffix(strings.Repeat("?, ", len(models.ClosedStatuses)), ", ")
+	overdue := "CASE WHEN due_date < ? AND status NOT IN (" + closed + ") THEN 0 ELSE 1 END"
+	args := []interface{}{q.Now}
+	for _, status := range models.ClosedStatuses {
+		args = append(args, status)
+	}
+	columns := []string{overdue, "priority", sortExpressions["due_date"], "rank", "id"}
+
+	if q.After != nil {
+		key, err := parseSmartValue(q.After.Value)
+		if err != nil {
+			return nil, err
+		}
+		// Row comparison works because every column is ordered the same way
+		query = query.Where(fmt.Sprintf("(%s) %s (?, ?, ?, ?, ?)", strings.Join(columns, ", "), op),
+			append(args, key.overdue, key.priority, key.due, key.rank, q.After.ID)...)
+	}
+
+	return query.
+		Order(gorm.Expr(strings.Join(columns, " "+direction+", ")+" "+direction, args...)).
+		Limit(q.Limit + 1), nil
+}
+
+type gormGroups struct {
+	db     *gorm.DB
+	topics events.Topics
+}
+
+func (r *gormGroups) List(ctx context.Context, userID int, q ListQuery) ([]models.Group, error) {
+	query, err := applyListQuery(r.db.Where("id IN ("+accessibleGroupIDs+")", userID, userID), q, "name")
+	if err != nil {
+		return nil, err
+	}
+	var groups []models.Group
+	err = query.Preload("ToDos", byRank).Preload("ToDos.Tags", byName).Preload("ToDos.Reminders", byOffset).Find(&groups).Error
+	return groups, err
+}
+
+func (r *gormGroups) Get(ctx context.Context, id uint, withToDos bool) (*models.Group, error) {
+	query := r.db
+	if withToDos {
+		query = query.Preload("ToDos", byRank).Preload("ToDos.Tags", byName).Preload("ToDos.Reminders", byOffset)
+	}
+	var group models.Group
+	if err := query.First(&group, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroups) FindByName(ctx context.Context, ownerID int, name string) (*models.Group, error) {
+	var group models.Group
+	if err := r.db.Where("owner_id = ? AND name = ?", ownerID, name).First(&group).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroups) Create(ctx context.Context, group *models.Group, actorID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+		return r.topics.RecordGroup(tx, events.GroupCreated, actorID, group)
+	})
+}
+
+func (r *gormGroups) Update(ctx context.Context, group *models.Group, changes models.ChangeSet, actorID int) error {
+	columns := map[string]interface{}{}
+	if changes.Has("name") {
+		columns["name"] = group.Name
+	}
+	if changes.Has("workflow") {
+		columns["workflow"] = group.Workflow
+	}
+	columns["version"] = group.Version + 1
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(group).Where("version = ?", group.Version).Updates(columns)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+		return r.topics.RecordGroupUpdate(tx, actorID, group, changes)
+	})
+}
+
+func (r *gormGroups) Delete(ctx context.Context, group *models.Group, actorID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockGroupToDos(tx, group.ID); err != nil {
+			return err
+		}
+		if err := lockVersion(tx, "groups", group.ID, group.Version); err != nil {
+			return err
+		}
+
+		// The todos go to the trash at the same time as the group, which tells
+		// them from those deleted before
+		now := trashTime()
+		var todos []models.ToDo
+		if err := tx.Where("group_id = ?", group.ID).Preload("Tags", byName).Preload("Reminders", byOffset).Find(&todos).Error; err != nil {
+			return err
+		}
+		trashed := map[string]interface{}{"deleted_at": now, "version": gorm.Expr("version + 1")}
+		if err := tx.Model(&models.ToDo{}).Where("group_id = ?", group.ID).UpdateColumns(trashed).Error; err != nil {
+			return err
+		}
+		for i := range todos {
+			todos[i].DeletedAt = &now
+			todos[i].Version++
+			if err := r.topics.RecordToDo(tx, events.ToDoDeleted, actorID, &todos[i]); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(group).UpdateColumns(map[string]interface{}{"deleted_at": now, "version": group.Version + 1}).Error; err != nil {
+			return err
+		}
+		group.DeletedAt = &now
+		group.ToDos = todos
+		return r.topics.RecordGroup(tx, events.GroupDeleted, actorID, group)
+	})
+}
+
+func (r *gormGroups) Trashed(ctx context.Context, ownerID int) ([]models.Group, error) {
+	var groups []models.Group
+	err := r.db.Unscoped().Where("owner_id = ? AND deleted_at IS NOT NULL", ownerID).Order("deleted_at DESC, id DESC").Find(&groups).Error
+	return groups, err
+}
+
+func (r *gormGroups) GetTrashed(ctx context.Context, id uint) (*models.Group, error) {
+	var group models.Group
+	if err := r.db.Unscoped().Where("deleted_at IS NOT NULL").First(&group, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroups) Restore(ctx context.Context, group *models.Group, actorID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockGroupToDos(tx.Unscoped().Where("deleted_at = ?", group.DeletedAt), group.ID); err != nil {
+			return err
+		}
+		if err := lockVersion(tx, "groups", group.ID, group.Version); err != nil {
+			return err
+		}
+		var todos []models.ToDo
+		err := tx.Unscoped().Where("group_id = ? AND deleted_at = ?", group.ID, group.DeletedAt).
+			Preload("Tags", byName).Order("rank, id").Find(&todos).Error
+		if err != nil {
+			return err
+		}
+		ids := make([]uint, len(todos))
+		for i, todo := range todos {
+			ids[i] = todo.ID
+		}
+		restored := map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")}
+		if err := tx.Unscoped().Model(&models.ToDo{}).Where("id IN (?)", ids).UpdateColumns(restored).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(group).UpdateColumns(map[string]interface{}{"deleted_at": nil, "version": group.Version + 1}).Error; err != nil {
+			return err
+		}
+		group.DeletedAt = nil
+
+		for i := range todos {
+			todos[i].DeletedAt = nil
+			todos[i].Version++
+			if err := saveReminders(tx, &todos[i], false, true); err != nil {
+				return err
+			}
+			if err := r.topics.RecordToDo(tx, events.ToDoRestored, actorID, &todos[i]); err != nil {
+				return err
+			}
+		}
+		group.ToDos = todos
+		return r.topics.RecordGroup(tx, events.GroupRestored, actorID, group)
+	})
+}
+
+func (r *gormGroups) Role(ctx context.Context, group *models.Group, userID int) (string, error) {
+	if group.OwnerID == userID {
+		return models.RoleOwner, nil
+	}
+	member, err := r.GetMember(ctx, group.ID, userID)
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+func (r *gormGroups) Members(ctx context.Context, groupID uint) ([]models.GroupMember, error) {
+	var members []models.GroupMember
+	err := r.db.Where("group_id = ?", groupID).Order("created_at").Find(&members).Error
+	return members, err
+}
+
+func (r *gormGroups) GetMember(ctx context.Context, groupID uint, userID int) (*models.GroupMember, error) {
+	var member models.GroupMember
+	if err := r.db.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &member, nil
+}
+
+func (r *gormGroups) AddMember(ctx context.Context, member *models.GroupMember) error {
+	return r.db.Create(member).Error
+}
+
+func (r *gormGroups) UpdateMemberRole(ctx context.Context, member *models.GroupMember, role string) error {
+	return r.db.Model(member).Update("role", role).Error
+}
+
+func (r *gormGroups) RemoveMember(ctx context.Context, member *models.GroupMember) error {
+	return r.db.Delete(member).Error
+}
+
+type gormTodos struct {
+	db     *gorm.DB
+	topics events.Topics
+}
+
+func (r *gormTodos) accessible(userID int) *gorm.DB {
+	return r.db.Where("group_id IN ("+accessibleGroupIDs+")", userID, userID)
+}
+
+func (r *gormTodos) List(ctx context.Context, userID int, q ListQuery) ([]models.ToDo, error) {
+	query, err := applyListQuery(r.accessible(userID), q, "title")
+	if err != nil {
+		return nil, err
+	}
+	if len(q.Tags) > 0 {
+		query = query.Where("id IN ?", taggedToDoIDs(r.db, userID, q))
+	}
+	var todos []models.ToDo
+	err = query.Preload("Tags", byName).Preload("Reminders", byOffset).Find(&todos).Error
+	return todos, err
+}
+
+func (r *gormTodos) ListDue(ctx context.Context, userID int, due DueRange) ([]models.ToDo, error) {
+	query := r.accessible(userID).Where("due_date IS NOT NULL")
+	if !due.From.IsZero() {
+		query = query.Where("due_date >= ?", due.From)
+	}
+	if !due.To.IsZero() {
+		query = query.Where("due_date < ?", due.To)
+	}
+	if due.OpenOnly {
+		query = query.Where("status NOT IN (?)", models.ClosedStatuses)
+	}
+
+	var todos []models.ToDo
+	err := query.Preload("Tags", byName).Preload("Reminders", byOffset).Order("due_date, id").Find(&todos).Error
+	return todos, err
+}
+
+func (r *gormTodos) Get(ctx context.Context, id uint) (*models.ToDo, error) {
+	var todo models.ToDo
+	if err := r.db.Preload("Tags", byName).Preload("Reminders", byOffset).First(&todo, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &todo, nil
+}
+
+func (r *gormTodos) Subtasks(ctx context.Context, parentID uint) ([]models.ToDo, error) {
+	var todos []models.ToDo
+	err := r.db.Where("parent_id = ?", parentID).Preload("Tags", byName).Preload("Reminders", byOffset).Order("rank, id").Find(&todos).Error
+	return todos, err
+}
+
+func (r *gormTodos) Create(ctx context.Context, todo *models.ToDo, actorID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if todo.ParentID != nil {
+			if err := lockParent(tx, *todo.ParentID); err != nil {
+				return err
+			}
+		}
+		if err := touchGroups(tx, todo.GroupID); err != nil {
+			return err
+		}
+		if err := rankLast(tx, todo); err != nil {
+			return err
+		}
+		if err := tx.Create(todo).Error; err != nil {
+			return err
+		}
+		if err := saveTags(tx, todo); err != nil {
+			return err
+		}
+		if err := saveReminders(tx, todo, true, true); err != nil {
+			return err
+		}
+		if err := recountSubtasks(tx, parentIDs(todo)...); err != nil {
+			return err
+		}
+		return r.topics.RecordToDo(tx, events.ToDoCreated, actorID, todo)
+	})
+}
+
+func (r *gormTodos) Update(ctx context.Context, todo *models.ToDo, changes models.ChangeSet, actorID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var stored models.ToDo
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("status, group_id, version, parent_id, due_date").First(&stored, todo.ID).Error; err != nil {
+			return translateError(err)
+		}
+		if stored.Version != todo.Version {
+			return ErrVersionConflict
+		}
+		transition := newTransition(todo, stored.Status, actorID)
+
+		// Only the changed columns are written, so concurrent edits of other fields survive
+		columns := map[string]interface{}{}
+		for _, field := range changes.Fields() {
+			if value, ok := toDoColumnValue(todo, field); ok {
+				columns[field] = value
+			}
+		}
+		if transition != nil {
+			columns["status"] = todo.Status
+			columns["status_changed_at"] = todo.StatusChangedAt
+			columns["status_changed_by"] = todo.StatusChangedBy
+		}
+		columns["version"] = todo.Version + 1
+		if err := tx.Model(todo).Updates(columns).Error; err != nil {
+			return err
+		}
+		if changes.Has("tag_ids") {
+			if err := tx.Where("todo_id = ?", todo.ID).Delete(&models.ToDoTag{}).Error; err != nil {
+				return err
+			}
+			if err := saveTags(tx, todo); err != nil {
+				return err
+			}
+		}
+		if reschedule := reschedulesReminders(&stored, todo); reschedule || changes.Has("reminder_offsets") {
+			if err := saveReminders(tx, todo, changes.Has("reminder_offsets"), reschedule); err != nil {
+				return err
+			}
+		}
+		if changes.Has("status") || changes.Has("parent_id") {
+			if err := recountSubtasks(tx, parentIDs(&stored, todo)...); err != nil {
+				return err
+			}
+		}
+		if err := touchGroups(tx, stored.GroupID, todo.GroupID); err != nil {
+			return err
+		}
+		if todo.GroupID != stored.GroupID {
+			if err := rankLast(tx, todo); err != nil {
+				return err
+			}
+			if err := tx.Model(todo).UpdateColumn("rank", todo.Rank).Error; err != nil {
+				return err
+			}
+		}
+		if err := r.topics.RecordToDoUpdate(tx, actorID, todo, changes); err != nil {
+			return err
+		}
+		if transition == nil {
+			return nil
+		}
+		if err := tx.Create(transition).Error; err != nil {
+			return err
+		}
+		return r.topics.RecordTransition(tx, actorID, transition)
+	})
+}
+
+func (r *gormTodos) Move(ctx context.Context, todo *models.ToDo, p Placement, actorID int) (models.ChangeSet, error) {
+	var changes models.ChangeSet
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockVersion(tx, "to_dos", todo.ID, todo.Version); err != nil {
+			return err
+		}
+		if err := touchGroups(tx, todo.GroupID, p.GroupID); err != nil {
+			return err
+		}
+		prev, next, err := placementBounds(tx, todo.ID, p)
+		if err != nil {
+			return err
+		}
+		ranked, err := rank.Between(prev, next)
+		if err != nil {
+			return ErrVersionConflict
+		}
+
+		changes = moveChanges(todo, p.GroupID, ranked)
+		columns := map[string]interface{}{"group_id": todo.GroupID, "rank": todo.Rank, "version": todo.Version + 1}
+		if err := tx.Model(todo).Updates(columns).Error; err != nil {
+			return err
+		}
+		return r.topics.RecordToDoUpdate(tx, actorID, todo, changes)
+	})
+	return changes, err
+}
+
+func (r *gormTodos) Delete(ctx context.Context, todo *models.ToDo, actorID int) ([]models.ToDo, error) {
+	var subtasks []models.ToDo
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockVersion(tx, "to_dos", todo.ID, todo.Version); err != nil {
+			return err
+		}
+		var err error
+		if subtasks, err = subtasksOf(tx, todo.ID); err != nil {
+			return err
+		}
+		ids := []uint{todo.ID}
+		for _, subtask := range subtasks {
+			ids = append(ids, subtask.ID)
+		}
+
+		// The subtasks go to the trash at the same time as the todo, so they
+		// are restored with it
+		now := trashTime()
+		trashed := map[string]interface{}{"deleted_at": now, "version": gorm.Expr("version + 1")}
+		if err := tx.Model(&models.ToDo{}).Where("id IN (?)", ids).UpdateColumns(trashed).Error; err != nil {
+			return err
+		}
+		todo.DeletedAt = &now
+		todo.Version++
+		for i := range subtasks {
+			subtasks[i].DeletedAt = &now
+			subtasks[i].Version++
+		}
+		if err := recountSubtasks(tx, parentIDs(todo)...); err != nil {
+			return err
+		}
+		if err := touchGroups(tx, todo.GroupID); err != nil {
+			return err
+		}
+		if err := r.topics.RecordToDo(tx, events.ToDoDeleted, actorID, todo); err != nil {
+			return err
+		}
+		for i := range subtasks {
+			if err := r.topics.RecordToDo(tx, events.ToDoDeleted, actorID, &subtasks[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return subtasks, err
+}
+
+func (r *gormTodos) Trashed(ctx context.Context, userID int) ([]models.ToDo, error) {
+	var todos []models.ToDo
+	err := r.db.Unscoped().Where("group_id IN ("+accessibleGroupIDs+")", userID, userID).
+		Where("deleted_at IS NOT NULL").
+		Where("NOT EXISTS (SELECT 1 FROM to_dos parents WHERE parents.id = to_dos.parent_id AND parents.deleted_at = to_dos.deleted_at)").
+		Preload("Tags", byName).Preload("Reminders", byOffset).
+		Order("deleted_at DESC, id DESC").Find(&todos).Error
+	return todos, err
+}
+
+func (r *gormTodos) GetTrashed(ctx context.Context, id uint) (*models.ToDo, error) {
+	var todo models.ToDo
+	if err := r.db.Unscoped().Where("deleted_at IS NOT NULL").Preload("Tags", byName).Preload("Reminders", byOffset).First(&todo, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &todo, nil
+}
+
+func (r *gormTodos) Restore(ctx context.Context, todo *models.ToDo, actorID int) ([]models.ToDo, error) {
+	var subtasks []models.ToDo
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockVersion(tx, "to_dos", todo.ID, todo.Version); err != nil {
+			return err
+		}
+		if todo.ParentID != nil {
+			if err := lockParent(tx, *todo.ParentID); err != nil {
+				return err
+			}
+		}
+		if err := touchGroups(tx, todo.GroupID); err != nil {
+			return err
+		}
+		var err error
+		if subtasks, err = trashedWith(tx, todo); err != nil {
+			return err
+		}
+		restored := []*models.ToDo{todo}
+		ids := []uint{todo.ID}
+		for i := range subtasks {
+			restored = append(restored, &subtasks[i])
+			ids = append(ids, subtasks[i].ID)
+		}
+		columns := map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")}
+		if err := tx.Unscoped().Model(&models.ToDo{}).Where("id IN (?)", ids).UpdateColumns(columns).Error; err != nil {
+			return err
+		}
+
+		// Others may have taken their ranks since, so they go last, in the
+		// order they were in
+		sort.SliceStable(restored, func(i, j int) bool { return restored[i].Rank < restored[j].Rank })
+		for _, t := range restored {
+			t.DeletedAt = nil
+			t.Version++
+			if err := rankLast(tx, t); err != nil {
+				return err
+			}
+			if err := tx.Model(t).UpdateColumn("rank", t.Rank).Error; err != nil {
+				return err
+			}
+			if err := saveReminders(tx, t, false, true); err != nil {
+				return err
+			}
+		}
+		if err := recountSubtasks(tx, parentIDs(todo)...); err != nil {
+			return err
+		}
+		if err := r.topics.RecordToDo(tx, events.ToDoRestored, actorID, todo); err != nil {
+			return err
+		}
+		for i := range subtasks {
+			if err := r.topics.RecordToDo(tx, events.ToDoRestored, actorID, &subtasks[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return subtasks, err
+}
+
+// trashedWith loads the subtasks of a todo in the trash that were deleted
+// with it
+func trashedWith(tx *gorm.DB, todo *models.ToDo) ([]models.ToDo, error) {
+	subtasks, err := subtasksOf(tx.Unscoped(), todo.ID)
+	if err != nil {
+		return nil, err
+	}
+	with := []models.ToDo{}
+	for _, subtask := range subtasks {
+		if subtask.DeletedAt != nil && subtask.DeletedAt.Equal(*todo.DeletedAt) {
+			with = append(with, subtask)
+		}
+	}
+	return with, nil
+}
+
+func (r *gormTodos) Transaction(ctx context.Context, fn func(todos TodoRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormTodos{db: tx, topics: r.topics})
+	})
+}
+
+func (r *gormTodos) Transitions(ctx context.Context, todoID uint) ([]models.ToDoTransition, error) {
+	var transitions []models.ToDoTransition
+	err := r.db.Where("todo_id = ?", todoID).Order("created_at, id").Find(&transitions).Error
+	return transitions, err
+}
+
+type gormReminders struct {
+	db     *gorm.DB
+	topics events.Topics
+}
+
+func (r *gormReminders) FireDue(ctx context.Context, now time.Time, limit int) (int, error) {
+	fired := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var due []models.Reminder
+		err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+			Where("remind_at <= ? AND sent_at IS NULL", now).
+			Where("todo_id IN (SELECT id FROM to_dos WHERE deleted_at IS NULL)").
+			Order("remind_at, id").Limit(limit).
+			Find(&due).Error
+		if err != nil {
+			return err
+		}
+		for i := range due {
+			if err := tx.Model(&due[i]).Update("sent_at", now).Error; err != nil {
+				return err
+			}
+			var todo models.ToDo
+			if err := tx.Preload("Tags", byName).Preload("Reminders", byOffset).First(&todo, due[i].ToDoID).Error; err != nil {
+				return err
+			}
+			if err := r.topics.RecordReminder(tx, &todo, &due[i]); err != nil {
+				return err
+			}
+		}
+		fired = len(due)
+		return nil
+	})
+	return fired, err
+}
+
+type gormTrash struct {
+	db *gorm.DB
+}
+
+func (r *gormTrash) Purge(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	purged := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var groups []models.Group
+		err := tx.Unscoped().Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+			Where("deleted_at < ?", cutoff).
+			Order("deleted_at, id").Limit(limit).
+			Find(&groups).Error
+		if err != nil {
+			return err
+		}
+		for i := range groups {
+			var ids []uint
+			if err := tx.Unscoped().Model(&models.ToDo{}).Where("group_id = ?", groups[i].ID).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if err := purgeToDos(tx, ids); err != nil {
+				return err
+			}
+			if err := tx.Where("group_id = ?", groups[i].ID).Delete(&models.GroupMember{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(&groups[i]).Error; err != nil {
+				return err
+			}
+		}
+		purged = len(groups)
+		if purged == limit {
+			return nil
+		}
+
+		// Todos deleted with their group or parent go with them
+		var todos []models.ToDo
+		err = tx.Unscoped().Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+			Where("deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM groups WHERE groups.id = to_dos.group_id AND groups.deleted_at = to_dos.deleted_at)").
+			Where("NOT EXISTS (SELECT 1 FROM to_dos parents WHERE parents.id = to_dos.parent_id AND parents.deleted_at = to_dos.deleted_at)").
+			Order("deleted_at, id").Limit(limit - purged).
+			Find(&todos).Error
+		if err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			subtasks, err := subtasksOf(tx.Unscoped(), todo.ID)
+			if err != nil {
+				return err
+			}
+			ids := []uint{todo.ID}
+			for _, subtask := range subtasks {
+				ids = append(ids, subtask.ID)
+			}
+			if err := purgeToDos(tx, ids); err != nil {
+				return err
+			}
+		}
+		purged += len(todos)
+		return nil
+	})
+	return purged, err
+}
+
+// purgeToDos deletes todos for good, with their history, tags and reminders
+func purgeToDos(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("todo_id IN (?)", ids).Delete(&models.ToDoTransition{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("todo_id IN (?)", ids).Delete(&models.ToDoTag{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("todo_id IN (?)", ids).Delete(&models.Reminder{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN (?)", ids).Delete(&models.ToDo{}).Error
+}
+
+// toDoColumnValue is the value of the column behind a change set field; the
+// JSON names of the writable fields match their columns.
+func toDoColumnValue(todo *models.ToDo, field string) (interface{}, bool) {
+	switch field {
+	case "title":
+		return todo.Title, true
+	case "status":
+		return todo.Status, true
+	case "group_id":
+		return todo.GroupID, true
+	case "due_date":
+		return todo.DueDate, true
+	case "parent_id":
+		return todo.ParentID, true
+	case "priority":
+		return todo.Priority, true
+	case "estimate_minutes":
+		return todo.EstimateMinutes, true
+	case "recurrence":
+		return todo.Recurrence, true
+	case "timezone":
+		return todo.Timezone, true
+	case "recurrence_start":
+		return todo.RecurrenceStart, true
+	case "series_id":
+		return todo.SeriesID, true
+	default:
+		return nil, false
+	}
+}
+
+type gormTags struct {
+	db *gorm.DB
+}
+
+func (r *gormTags) List(ctx context.Context, ownerID int) ([]models.Tag, error) {
+	var tags []models.Tag
+	err := r.db.Where("owner_id = ?", ownerID).Order("name, id").Find(&tags).Error
+	return tags, err
+}
+
+func (r *gormTags) Get(ctx context.Context, id uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := r.db.First(&tag, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &tag, nil
+}
+
+func (r *gormTags) GetMany(ctx context.Context, ids []uint) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	err := r.db.Where("id IN (?)", ids).Order("name, id").Find(&tags).Error
+	return tags, err
+}
+
+func (r *gormTags) FindByName(ctx context.Context, ownerID int, name string) (*models.Tag, error) {
+	var tag models.Tag
+	if err := r.db.Where("owner_id = ? AND name = ?", ownerID, name).First(&tag).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &tag, nil
+}
+
+func (r *gormTags) Create(ctx context.Context, tag *models.Tag) error {
+	return r.db.Create(tag).Error
+}
+
+func (r *gormTags) Update(ctx context.Context, tag *models.Tag) ([]models.ToDo, error) {
+	var todos []models.ToDo
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if todos, err = touchTagged(tx, tag.ID); err != nil {
+			return err
+		}
+		return tx.Model(tag).Updates(map[string]interface{}{"name": tag.Name, "color": tag.Color}).Error
+	})
+	return todos, err
+}
+
+func (r *gormTags) Delete(ctx context.Context, tag *models.Tag) ([]models.ToDo, error) {
+	var todos []models.ToDo
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if todos, err = touchTagged(tx, tag.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.ToDoTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(tag).Error
+	})
+	return todos, err
+}
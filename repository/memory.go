@@ -0,0 +1,1316 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmas98/go-todo-service/events"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/rank"
+)
+
+type memberKey struct {
+	groupID uint
+	userID  int
+}
+
+// Memory keeps groups and todos in process memory with the same visibility,
+// ordering and event rules as Gorm. It exists so handlers can be tested
+// without Postgres.
+type Memory struct {
+	mu sync.Mutex
+	memoryState
+}
+
+// memoryState is everything Memory stores, split out so transactions can
+// snapshot it
+type memoryState struct {
+	groups  map[uint]models.Group
+	todos   map[uint]models.ToDo
+	members map[memberKey]models.GroupMember
+	// transitions holds the status history of each todo, oldest first
+	transitions map[uint][]models.ToDoTransition
+	events      []models.OutboxEvent
+	// tags are also copied into the todos they are on
+	tags map[uint]models.Tag
+	// The trash keeps deleted groups and todos out of the way of the live ones
+	trashedGroups map[uint]models.Group
+	trashedToDos  map[uint]models.ToDo
+
+	lastGroupID      uint
+	lastToDoID       uint
+	lastMemberID     uint
+	lastTransitionID uint
+	lastEventID      uint
+	lastTagID        uint
+}
+
+func NewMemory() *Memory {
+	return &Memory{memoryState: memoryState{
+		groups:      make(map[uint]models.Group),
+		todos:       make(map[uint]models.ToDo),
+		members:     make(map[memberKey]models.GroupMember),
+		transitions: make(map[uint][]models.ToDoTransition),
+		tags:        make(map[uint]models.Tag),
+
+		trashedGroups: make(map[uint]models.Group),
+		trashedToDos:  make(map[uint]models.ToDo),
+	}}
+}
+
+// clone copies the state deeply enough that changing one copy leaves the other alone
+func (s *memoryState) clone() memoryState {
+	c := *s
+	c.groups = make(map[uint]models.Group, len(s.groups))
+	for id, group := range s.groups {
+		c.groups[id] = group
+	}
+	c.todos = make(map[uint]models.ToDo, len(s.todos))
+	for id, todo := range s.todos {
+		c.todos[id] = todo
+	}
+	c.members = make(map[memberKey]models.GroupMember, len(s.members))
+	for key, member := range s.members {
+		c.members[key] = member
+	}
+	c.transitions = make(map[uint][]models.ToDoTransition, len(s.transitions))
+	for id, transitions := range s.transitions {
+		c.transitions[id] = append([]models.ToDoTransition(nil), transitions...)
+	}
+	c.events = append([]models.OutboxEvent(nil), s.events...)
+	c.tags = make(map[uint]models.Tag, len(s.tags))
+	for id, tag := range s.tags {
+		c.tags[id] = tag
+	}
+	c.trashedGroups = make(map[uint]models.Group, len(s.trashedGroups))
+	for id, group := range s.trashedGroups {
+		c.trashedGroups[id] = group
+	}
+	c.trashedToDos = make(map[uint]models.ToDo, len(s.trashedToDos))
+	for id, todo := range s.trashedToDos {
+		c.trashedToDos[id] = todo
+	}
+	return c
+}
+
+func (m *Memory) Groups() GroupRepository {
+	return &memoryGroups{m}
+}
+
+func (m *Memory) Todos() TodoRepository {
+	return &memoryTodos{m}
+}
+
+func (m *Memory) Tags() TagRepository {
+	return &memoryTags{m}
+}
+
+func (m *Memory) Reminders() ReminderRepository {
+	return &memoryReminders{m}
+}
+
+func (m *Memory) Trash() TrashRepository {
+	return &memoryTrash{m}
+}
+
+// Events returns the outbox rows recorded so far, oldest first
+func (m *Memory) Events() []models.OutboxEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.OutboxEvent(nil), m.events...)
+}
+
+func (m *Memory) record(event *models.OutboxEvent, err error) error {
+	if err != nil {
+		return err
+	}
+	m.lastEventID++
+	event.ID = m.lastEventID
+	event.CreatedAt = time.Now()
+	m.events = append(m.events, *event)
+	return nil
+}
+
+// canSee reports whether the group is owned by or shared with the user
+func (m *Memory) canSee(groupID uint, userID int) bool {
+	group, ok := m.groups[groupID]
+	if !ok {
+		return false
+	}
+	if group.OwnerID == userID {
+		return true
+	}
+	_, ok = m.members[memberKey{groupID, userID}]
+	return ok
+}
+
+// checkVersion fails with ErrVersionConflict unless stored is at version
+func checkVersion(stored, version int) error {
+	if stored != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// touchGroups moves the version of groups on after a change to their todos
+func (m *Memory) touchGroups(ids ...uint) {
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		if group, ok := m.groups[id]; ok {
+			group.Version++
+			m.groups[id] = group
+		}
+	}
+}
+
+// recountSubtasks updates the subtask counts of parents after a change to
+// their subtasks, moving their versions on
+func (m *Memory) recountSubtasks(ids ...uint) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		parent, ok := m.todos[id]
+		if !ok || i > 0 && ids[i-1] == id {
+			continue
+		}
+		parent.SubtasksTotal, parent.SubtasksClosed = 0, 0
+		for _, todo := range m.todos {
+			if todo.ParentID != nil && *todo.ParentID == id {
+				parent.SubtasksTotal++
+				if models.IsClosed(todo.Status) {
+					parent.SubtasksClosed++
+				}
+			}
+		}
+		parent.Version++
+		m.todos[id] = parent
+	}
+}
+
+// subtasksOf returns the subtasks of a todo at every level, in ID order
+func (m *Memory) subtasksOf(id uint) []models.ToDo {
+	var subtasks []models.ToDo
+	for _, todo := range m.todos {
+		for parent := todo.ParentID; parent != nil; parent = m.todos[*parent].ParentID {
+			if *parent == id {
+				subtasks = append(subtasks, todo)
+				break
+			}
+		}
+	}
+	sort.Slice(subtasks, func(i, j int) bool { return subtasks[i].ID < subtasks[j].ID })
+	return subtasks
+}
+
+// trash moves a todo to the trash
+func (m *Memory) trash(todo models.ToDo) {
+	delete(m.todos, todo.ID)
+	m.trashedToDos[todo.ID] = todo
+}
+
+// restore takes a todo out of the trash, scheduling its reminders again
+func (m *Memory) restore(todo *models.ToDo) {
+	todo.DeletedAt = nil
+	todo.Version++
+	todo.Reminders = planReminders(todo, todo.Reminders, true, time.Now())
+	delete(m.trashedToDos, todo.ID)
+	m.todos[todo.ID] = *todo
+}
+
+// retag replaces tag in the todos it is on, or takes it off them if deleted,
+// moving their versions and those of their groups on. It returns the todos as
+// they were.
+func (m *Memory) retag(tag models.Tag, deleted bool) []models.ToDo {
+	var tagged []models.ToDo
+	var groupIDs []uint
+	for _, todo := range m.todos {
+		i := indexOfTag(todo.Tags, tag.ID)
+		if i < 0 {
+			continue
+		}
+		tagged = append(tagged, todo)
+		groupIDs = append(groupIDs, todo.GroupID)
+
+		tags := append([]models.Tag(nil), todo.Tags[:i]...)
+		if !deleted {
+			tags = append(tags, tag)
+		}
+		todo.Tags = append(tags, todo.Tags[i+1:]...)
+		sortTags(todo.Tags)
+		todo.Version++
+		m.todos[todo.ID] = todo
+	}
+	// Todos in the trash keep their tags without caching anything
+	for _, todo := range m.trashedToDos {
+		if i := indexOfTag(todo.Tags, tag.ID); i >= 0 {
+			tags := append([]models.Tag(nil), todo.Tags[:i]...)
+			if !deleted {
+				tags = append(tags, tag)
+			}
+			todo.Tags = append(tags, todo.Tags[i+1:]...)
+			sortTags(todo.Tags)
+			m.trashedToDos[todo.ID] = todo
+		}
+	}
+	sort.Slice(tagged, func(i, j int) bool { return tagged[i].ID < tagged[j].ID })
+	sort.Slice(groupIDs, func(i, j int) bool { return groupIDs[i] < groupIDs[j] })
+	m.touchGroups(groupIDs...)
+	return tagged
+}
+
+func indexOfTag(tags []models.Tag, id uint) int {
+	for i, tag := range tags {
+		if tag.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortTags orders tags by name like Gorm preloads them
+func sortTags(tags []models.Tag) {
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Name != tags[j].Name {
+			return tags[i].Name < tags[j].Name
+		}
+		return tags[i].ID < tags[j].ID
+	})
+}
+
+// hasTags reports whether todo has the user's tags named in q
+func hasTags(todo *models.ToDo, userID int, q ListQuery) bool {
+	if len(q.Tags) == 0 {
+		return true
+	}
+	matched := 0
+	for _, tag := range todo.Tags {
+		if tag.OwnerID == userID && containsString(q.Tags, tag.Name) {
+			matched++
+		}
+	}
+	if q.TagMode == TagsAll {
+		return matched == len(q.Tags)
+	}
+	return matched > 0
+}
+
+// groupToDos returns the todos of a group in rank order
+func (m *Memory) groupToDos(groupID uint) []models.ToDo {
+	todos := []models.ToDo{}
+	for _, todo := range m.todos {
+		if todo.GroupID == groupID {
+			todos = append(todos, todo)
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		if todos[i].Rank != todos[j].Rank {
+			return todos[i].Rank < todos[j].Rank
+		}
+		return todos[i].ID < todos[j].ID
+	})
+	return todos
+}
+
+// placementBounds returns the ranks a todo placed at p goes between, leaving
+// the todo itself out
+func (m *Memory) placementBounds(todoID uint, p Placement) (prev, next string, err error) {
+	var ranks []string
+	for _, todo := range m.todos {
+		if todo.GroupID == p.GroupID && todo.ID != todoID {
+			ranks = append(ranks, todo.Rank)
+		}
+	}
+	sort.Strings(ranks)
+
+	neighbour := func(id uint) (string, error) {
+		todo, ok := m.todos[id]
+		if !ok || todo.GroupID != p.GroupID || id == todoID {
+			return "", ErrVersionConflict
+		}
+		return todo.Rank, nil
+	}
+	if p.After != 0 {
+		if prev, err = neighbour(p.After); err != nil {
+			return "", "", err
+		}
+	}
+	if p.Before != 0 {
+		if next, err = neighbour(p.Before); err != nil {
+			return "", "", err
+		}
+	}
+	switch {
+	case p.After != 0 && p.Before == 0:
+		if i := sort.Search(len(ranks), func(i int) bool { return ranks[i] > prev }); i < len(ranks) {
+			next = ranks[i]
+		}
+	case p.After == 0 && p.Before != 0:
+		if i := sort.SearchStrings(ranks, next); i > 0 {
+			prev = ranks[i-1]
+		}
+	case p.After == 0 && p.Before == 0 && len(ranks) > 0:
+		prev = ranks[len(ranks)-1]
+	}
+	return prev, next, nil
+}
+
+// rankLast ranks todo after the other todos of its group
+func (m *Memory) rankLast(todo *models.ToDo) error {
+	last, _, err := m.placementBounds(todo.ID, Placement{GroupID: todo.GroupID})
+	if err != nil {
+		return err
+	}
+	todo.Rank, err = rank.After(last)
+	return err
+}
+
+type memoryGroups struct {
+	*Memory
+}
+
+func (r *memoryGroups) List(ctx context.Context, userID int, q ListQuery) ([]models.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var candidates []models.Group
+	for _, group := range r.groups {
+		if !r.canSee(group.ID, userID) || !matchesCreated(group.CreatedAt, q) {
+			continue
+		}
+		if q.Search != "" && !containsFold(group.Name, q.Search) {
+			continue
+		}
+		candidates = append(candidates, group)
+	}
+
+	order, err := pageOrder(len(candidates), GroupSortFields, q,
+		func(i int) string { return GroupSortValue(&candidates[i], q.Sort) },
+		func(i int) uint { return candidates[i].ID })
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]models.Group, 0, len(order))
+	for _, i := range order {
+		group := candidates[i]
+		group.ToDos = r.groupToDos(group.ID)
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func (r *memoryGroups) Get(ctx context.Context, id uint, withToDos bool) (*models.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.groups[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if withToDos {
+		group.ToDos = r.groupToDos(id)
+	}
+	return &group, nil
+}
+
+func (r *memoryGroups) FindByName(ctx context.Context, ownerID int, name string) (*models.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, group := range r.groups {
+		if group.OwnerID == ownerID && group.Name == name {
+			return &group, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryGroups) Create(ctx context.Context, group *models.Group, actorID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastGroupID++
+	group.ID = r.lastGroupID
+	group.CreatedAt = time.Now()
+	group.Version = 1
+
+	stored := *group
+	stored.ToDos = nil
+	r.groups[group.ID] = stored
+	return r.record(events.DefaultTopics.NewGroupEvent(events.GroupCreated, actorID, group))
+}
+
+func (r *memoryGroups) Update(ctx context.Context, group *models.Group, changes models.ChangeSet, actorID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.groups[group.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkVersion(stored.Version, group.Version); err != nil {
+		return err
+	}
+	group.Version++
+	stored.Name = group.Name
+	stored.Workflow = group.Workflow
+	stored.Version = group.Version
+	r.groups[group.ID] = stored
+	return r.record(events.DefaultTopics.NewGroupUpdateEvent(actorID, group, changes))
+}
+
+func (r *memoryGroups) Delete(ctx context.Context, group *models.Group, actorID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.groups[group.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkVersion(stored.Version, group.Version); err != nil {
+		return err
+	}
+
+	now := trashTime()
+	todos := r.groupToDos(group.ID)
+	for i := range todos {
+		todos[i].DeletedAt = &now
+		todos[i].Version++
+		r.trash(todos[i])
+		if err := r.record(events.DefaultTopics.NewToDoEvent(events.ToDoDeleted, actorID, &todos[i])); err != nil {
+			return err
+		}
+	}
+	group.DeletedAt = &now
+	group.Version++
+	stored.DeletedAt, stored.Version = group.DeletedAt, group.Version
+	delete(r.groups, group.ID)
+	r.trashedGroups[group.ID] = stored
+
+	group.ToDos = todos
+	return r.record(events.DefaultTopics.NewGroupEvent(events.GroupDeleted, actorID, group))
+}
+
+func (r *memoryGroups) Trashed(ctx context.Context, ownerID int) ([]models.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	groups := []models.Group{}
+	for _, group := range r.trashedGroups {
+		if group.OwnerID == ownerID {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].DeletedAt.Equal(*groups[j].DeletedAt) {
+			return groups[i].DeletedAt.After(*groups[j].DeletedAt)
+		}
+		return groups[i].ID > groups[j].ID
+	})
+	return groups, nil
+}
+
+func (r *memoryGroups) GetTrashed(ctx context.Context, id uint) (*models.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.trashedGroups[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &group, nil
+}
+
+func (r *memoryGroups) Restore(ctx context.Context, group *models.Group, actorID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.trashedGroups[group.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkVersion(stored.Version, group.Version); err != nil {
+		return err
+	}
+	deletedAt := *stored.DeletedAt
+	group.DeletedAt = nil
+	group.Version++
+	stored.DeletedAt, stored.Version = nil, group.Version
+	delete(r.trashedGroups, group.ID)
+	r.groups[group.ID] = stored
+
+	todos := []models.ToDo{}
+	for _, todo := range r.trashedToDos {
+		if todo.GroupID == group.ID && todo.DeletedAt.Equal(deletedAt) {
+			todos = append(todos, todo)
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		if todos[i].Rank != todos[j].Rank {
+			return todos[i].Rank < todos[j].Rank
+		}
+		return todos[i].ID < todos[j].ID
+	})
+	for i := range todos {
+		r.restore(&todos[i])
+		if err := r.record(events.DefaultTopics.NewToDoEvent(events.ToDoRestored, actorID, &todos[i])); err != nil {
+			return err
+		}
+	}
+	group.ToDos = todos
+	return r.record(events.DefaultTopics.NewGroupEvent(events.GroupRestored, actorID, group))
+}
+
+func (r *memoryGroups) Role(ctx context.Context, group *models.Group, userID int) (string, error) {
+	if group.OwnerID == userID {
+		return models.RoleOwner, nil
+	}
+	member, err := r.GetMember(ctx, group.ID, userID)
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+func (r *memoryGroups) Members(ctx context.Context, groupID uint) ([]models.GroupMember, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members := []models.GroupMember{}
+	for key, member := range r.members {
+		if key.groupID == groupID {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members, nil
+}
+
+func (r *memoryGroups) GetMember(ctx context.Context, groupID uint, userID int) (*models.GroupMember, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	member, ok := r.members[memberKey{groupID, userID}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &member, nil
+}
+
+func (r *memoryGroups) AddMember(ctx context.Context, member *models.GroupMember) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := memberKey{member.GroupID, member.UserID}
+	if _, exists := r.members[key]; exists {
+		return fmt.Errorf("user %d is already a member of group %d", member.UserID, member.GroupID)
+	}
+	r.lastMemberID++
+	member.ID = r.lastMemberID
+	member.CreatedAt = time.Now()
+	r.members[key] = *member
+	return nil
+}
+
+func (r *memoryGroups) UpdateMemberRole(ctx context.Context, member *models.GroupMember, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := memberKey{member.GroupID, member.UserID}
+	stored, ok := r.members[key]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Role = role
+	r.members[key] = stored
+	member.Role = role
+	return nil
+}
+
+func (r *memoryGroups) RemoveMember(ctx context.Context, member *models.GroupMember) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.members, memberKey{member.GroupID, member.UserID})
+	return nil
+}
+
+type memoryTodos struct {
+	*Memory
+}
+
+func (r *memoryTodos) List(ctx context.Context, userID int, q ListQuery) ([]models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var candidates []models.ToDo
+	for _, todo := range r.todos {
+		if r.canSee(todo.GroupID, userID) && matchesToDo(&todo, q) && hasTags(&todo, userID, q) {
+			candidates = append(candidates, todo)
+		}
+	}
+
+	order, err := pageOrder(len(candidates), ToDoSortFields, q,
+		func(i int) string { return ToDoSortValue(&candidates[i], q) },
+		func(i int) uint { return candidates[i].ID })
+	if err != nil {
+		return nil, err
+	}
+
+	todos := make([]models.ToDo, 0, len(order))
+	for _, i := range order {
+		todos = append(todos, candidates[i])
+	}
+	return todos, nil
+}
+
+func (r *memoryTodos) ListDue(ctx context.Context, userID int, due DueRange) ([]models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todos := []models.ToDo{}
+	for _, todo := range r.todos {
+		if todo.DueDate == nil || !r.canSee(todo.GroupID, userID) {
+			continue
+		}
+		if !due.From.IsZero() && todo.DueDate.Before(due.From) {
+			continue
+		}
+		if !due.To.IsZero() && !todo.DueDate.Before(due.To) {
+			continue
+		}
+		if due.OpenOnly && models.IsClosed(todo.Status) {
+			continue
+		}
+		todos = append(todos, todo)
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		if !todos[i].DueDate.Equal(*todos[j].DueDate) {
+			return todos[i].DueDate.Before(*todos[j].DueDate)
+		}
+		return todos[i].ID < todos[j].ID
+	})
+	return todos, nil
+}
+
+func (r *memoryTodos) Get(ctx context.Context, id uint) (*models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, ok := r.todos[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &todo, nil
+}
+
+func (r *memoryTodos) Subtasks(ctx context.Context, parentID uint) ([]models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subtasks := []models.ToDo{}
+	for _, todo := range r.todos {
+		if todo.ParentID != nil && *todo.ParentID == parentID {
+			subtasks = append(subtasks, todo)
+		}
+	}
+	sort.Slice(subtasks, func(i, j int) bool {
+		if subtasks[i].Rank != subtasks[j].Rank {
+			return subtasks[i].Rank < subtasks[j].Rank
+		}
+		return subtasks[i].ID < subtasks[j].ID
+	})
+	return subtasks, nil
+}
+
+func (r *memoryTodos) Create(ctx context.Context, todo *models.ToDo, actorID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if todo.ParentID != nil {
+		if _, ok := r.todos[*todo.ParentID]; !ok {
+			return ErrVersionConflict
+		}
+	}
+
+	if err := r.rankLast(todo); err != nil {
+		return err
+	}
+	r.lastToDoID++
+	todo.ID = r.lastToDoID
+	todo.CreatedAt = time.Now()
+	todo.Version = 1
+	todo.Reminders = planReminders(todo, nil, true, todo.CreatedAt)
+	r.todos[todo.ID] = *todo
+	r.recountSubtasks(parentIDs(todo)...)
+	r.touchGroups(todo.GroupID)
+	return r.record(events.DefaultTopics.NewToDoEvent(events.ToDoCreated, actorID, todo))
+}
+
+func (r *memoryTodos) Update(ctx context.Context, todo *models.ToDo, changes models.ChangeSet, actorID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.todos[todo.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkVersion(stored.Version, todo.Version); err != nil {
+		return err
+	}
+	transition := newTransition(todo, stored.Status, actorID)
+	if todo.GroupID != stored.GroupID {
+		if err := r.rankLast(todo); err != nil {
+			return err
+		}
+	}
+	if !changes.Has("reminder_offsets") {
+		todo.Reminders = stored.Reminders
+	}
+	if reschedule := reschedulesReminders(&stored, todo); reschedule || changes.Has("reminder_offsets") {
+		todo.Reminders = planReminders(todo, stored.Reminders, reschedule, time.Now())
+	}
+	todo.Version++
+	r.todos[todo.ID] = *todo
+	if changes.Has("status") || changes.Has("parent_id") {
+		r.recountSubtasks(parentIDs(&stored, todo)...)
+	}
+	r.touchGroups(stored.GroupID, todo.GroupID)
+	if err := r.record(events.DefaultTopics.NewToDoUpdateEvent(actorID, todo, changes)); err != nil {
+		return err
+	}
+	if transition == nil {
+		return nil
+	}
+	r.lastTransitionID++
+	transition.ID = r.lastTransitionID
+	r.transitions[todo.ID] = append(r.transitions[todo.ID], *transition)
+	return r.record(events.DefaultTopics.NewTransitionEvent(actorID, transition))
+}
+
+func (r *memoryTodos) Move(ctx context.Context, todo *models.ToDo, p Placement, actorID int) (models.ChangeSet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.todos[todo.ID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if err := checkVersion(stored.Version, todo.Version); err != nil {
+		return nil, err
+	}
+	prev, next, err := r.placementBounds(todo.ID, p)
+	if err != nil {
+		return nil, err
+	}
+	ranked, err := rank.Between(prev, next)
+	if err != nil {
+		return nil, ErrVersionConflict
+	}
+
+	changes := moveChanges(todo, p.GroupID, ranked)
+	todo.Version++
+	r.todos[todo.ID] = *todo
+	r.touchGroups(stored.GroupID, todo.GroupID)
+	return changes, r.record(events.DefaultTopics.NewToDoUpdateEvent(actorID, todo, changes))
+}
+
+func (r *memoryTodos) Delete(ctx context.Context, todo *models.ToDo, actorID int) ([]models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.todos[todo.ID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if err := checkVersion(stored.Version, todo.Version); err != nil {
+		return nil, err
+	}
+	now := trashTime()
+	subtasks := r.subtasksOf(todo.ID)
+	todo.DeletedAt = &now
+	todo.Version++
+	stored.DeletedAt, stored.Version = todo.DeletedAt, todo.Version
+	r.trash(stored)
+	for i := range subtasks {
+		subtasks[i].DeletedAt = &now
+		subtasks[i].Version++
+		r.trash(subtasks[i])
+	}
+	r.recountSubtasks(parentIDs(todo)...)
+	r.touchGroups(todo.GroupID)
+	if err := r.record(events.DefaultTopics.NewToDoEvent(events.ToDoDeleted, actorID, todo)); err != nil {
+		return nil, err
+	}
+	for i := range subtasks {
+		if err := r.record(events.DefaultTopics.NewToDoEvent(events.ToDoDeleted, actorID, &subtasks[i])); err != nil {
+			return nil, err
+		}
+	}
+	return subtasks, nil
+}
+
+func (r *memoryTodos) Trashed(ctx context.Context, userID int) ([]models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todos := []models.ToDo{}
+	for _, todo := range r.trashedToDos {
+		if !r.canSee(todo.GroupID, userID) {
+			continue
+		}
+		if todo.ParentID != nil {
+			if parent, ok := r.trashedToDos[*todo.ParentID]; ok && parent.DeletedAt.Equal(*todo.DeletedAt) {
+				continue
+			}
+		}
+		todos = append(todos, todo)
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		if !todos[i].DeletedAt.Equal(*todos[j].DeletedAt) {
+			return todos[i].DeletedAt.After(*todos[j].DeletedAt)
+		}
+		return todos[i].ID > todos[j].ID
+	})
+	return todos, nil
+}
+
+func (r *memoryTodos) GetTrashed(ctx context.Context, id uint) (*models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, ok := r.trashedToDos[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &todo, nil
+}
+
+func (r *memoryTodos) Restore(ctx context.Context, todo *models.ToDo, actorID int) ([]models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.trashedToDos[todo.ID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if err := checkVersion(stored.Version, todo.Version); err != nil {
+		return nil, err
+	}
+	if todo.ParentID != nil {
+		if _, ok := r.todos[*todo.ParentID]; !ok {
+			return nil, ErrVersionConflict
+		}
+	}
+
+	// The subtasks deleted with the todo are those in the trash since then
+	// that it is an ancestor of
+	subtasks := []models.ToDo{}
+	for _, subtask := range r.trashedToDos {
+		if !subtask.DeletedAt.Equal(*stored.DeletedAt) {
+			continue
+		}
+		for parent := subtask.ParentID; parent != nil; parent = r.trashedToDos[*parent].ParentID {
+			if *parent == todo.ID {
+				subtasks = append(subtasks, subtask)
+				break
+			}
+		}
+	}
+	sort.Slice(subtasks, func(i, j int) bool { return subtasks[i].ID < subtasks[j].ID })
+
+	restored := []*models.ToDo{todo}
+	for i := range subtasks {
+		restored = append(restored, &subtasks[i])
+	}
+	sort.SliceStable(restored, func(i, j int) bool { return restored[i].Rank < restored[j].Rank })
+	for _, t := range restored {
+		r.restore(t)
+		if err := r.rankLast(t); err != nil {
+			return nil, err
+		}
+		r.todos[t.ID] = *t
+	}
+	r.recountSubtasks(parentIDs(todo)...)
+	r.touchGroups(todo.GroupID)
+	if err := r.record(events.DefaultTopics.NewToDoEvent(events.ToDoRestored, actorID, todo)); err != nil {
+		return nil, err
+	}
+	for i := range subtasks {
+		if err := r.record(events.DefaultTopics.NewToDoEvent(events.ToDoRestored, actorID, &subtasks[i])); err != nil {
+			return nil, err
+		}
+	}
+	return subtasks, nil
+}
+
+// Transaction undoes fn's changes by restoring a snapshot. Unlike a database
+// transaction it doesn't isolate fn from concurrent changes, and undoes those too.
+func (r *memoryTodos) Transaction(ctx context.Context, fn func(todos TodoRepository) error) error {
+	r.mu.Lock()
+	snapshot := r.clone()
+	r.mu.Unlock()
+
+	if err := fn(r); err != nil {
+		r.mu.Lock()
+		r.memoryState = snapshot
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (r *memoryTodos) Transitions(ctx context.Context, todoID uint) ([]models.ToDoTransition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]models.ToDoTransition{}, r.transitions[todoID]...), nil
+}
+
+type memoryReminders struct {
+	*Memory
+}
+
+func (r *memoryReminders) FireDue(ctx context.Context, now time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type dueReminder struct {
+		todoID uint
+		offset int
+		at     time.Time
+	}
+	var due []dueReminder
+	for _, todo := range r.todos {
+		for _, reminder := range todo.Reminders {
+			if reminder.RemindAt != nil && !reminder.RemindAt.After(now) && reminder.SentAt == nil {
+				due = append(due, dueReminder{todo.ID, reminder.OffsetMinutes, *reminder.RemindAt})
+			}
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].at.Equal(due[j].at) {
+			return due[i].at.Before(due[j].at)
+		}
+		return due[i].todoID < due[j].todoID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for _, d := range due {
+		todo := r.todos[d.todoID]
+		todo.Reminders = append([]models.Reminder(nil), todo.Reminders...)
+		var sent *models.Reminder
+		for i := range todo.Reminders {
+			if todo.Reminders[i].OffsetMinutes == d.offset {
+				sent = &todo.Reminders[i]
+			}
+		}
+		sentAt := now
+		sent.SentAt = &sentAt
+		r.todos[todo.ID] = todo
+		if err := r.record(events.DefaultTopics.NewReminderEvent(&todo, sent)); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+type memoryTrash struct {
+	*Memory
+}
+
+func (r *memoryTrash) Purge(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var groups []models.Group
+	for _, group := range r.trashedGroups {
+		if group.DeletedAt.Before(cutoff) {
+			groups = append(groups, group)
+		}
+	}
+	// Todos deleted with their group or parent go with them
+	var todos []models.ToDo
+	for _, todo := range r.trashedToDos {
+		if !todo.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if group, ok := r.trashedGroups[todo.GroupID]; ok && group.DeletedAt.Equal(*todo.DeletedAt) {
+			continue
+		}
+		if todo.ParentID != nil {
+			if parent, ok := r.trashedToDos[*todo.ParentID]; ok && parent.DeletedAt.Equal(*todo.DeletedAt) {
+				continue
+			}
+		}
+		todos = append(todos, todo)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	sort.Slice(todos, func(i, j int) bool { return todos[i].ID < todos[j].ID })
+
+	purged := 0
+	for _, group := range groups {
+		if purged == limit {
+			return purged, nil
+		}
+		for id, todo := range r.trashedToDos {
+			if todo.GroupID == group.ID {
+				r.purgeToDo(id)
+			}
+		}
+		for key := range r.members {
+			if key.groupID == group.ID {
+				delete(r.members, key)
+			}
+		}
+		delete(r.trashedGroups, group.ID)
+		purged++
+	}
+	for _, todo := range todos {
+		if purged == limit {
+			break
+		}
+		if _, ok := r.trashedToDos[todo.ID]; !ok {
+			// Went with its group
+			continue
+		}
+		// Subtasks are in the trash whenever their parent is
+		for id, subtask := range r.trashedToDos {
+			for parent := subtask.ParentID; parent != nil; parent = r.trashedToDos[*parent].ParentID {
+				if *parent == todo.ID {
+					r.purgeToDo(id)
+					break
+				}
+			}
+		}
+		r.purgeToDo(todo.ID)
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeToDo deletes a todo in the trash for good, with its history
+func (m *Memory) purgeToDo(id uint) {
+	delete(m.trashedToDos, id)
+	delete(m.transitions, id)
+}
+
+type memoryTags struct {
+	*Memory
+}
+
+func (r *memoryTags) List(ctx context.Context, ownerID int) ([]models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tags := []models.Tag{}
+	for _, tag := range r.tags {
+		if tag.OwnerID == ownerID {
+			tags = append(tags, tag)
+		}
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+func (r *memoryTags) Get(ctx context.Context, id uint) (*models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tag, ok := r.tags[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &tag, nil
+}
+
+func (r *memoryTags) GetMany(ctx context.Context, ids []uint) ([]models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tags := []models.Tag{}
+	for _, id := range ids {
+		if tag, ok := r.tags[id]; ok && indexOfTag(tags, id) < 0 {
+			tags = append(tags, tag)
+		}
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+func (r *memoryTags) FindByName(ctx context.Context, ownerID int, name string) (*models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, tag := range r.tags {
+		if tag.OwnerID == ownerID && tag.Name == name {
+			return &tag, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryTags) Create(ctx context.Context, tag *models.Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.tags {
+		if other.OwnerID == tag.OwnerID && other.Name == tag.Name {
+			return fmt.Errorf("user %d already has a tag named %q", tag.OwnerID, tag.Name)
+		}
+	}
+	r.lastTagID++
+	tag.ID = r.lastTagID
+	tag.CreatedAt = time.Now()
+	r.tags[tag.ID] = *tag
+	return nil
+}
+
+func (r *memoryTags) Update(ctx context.Context, tag *models.Tag) ([]models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tags[tag.ID]; !ok {
+		return nil, ErrNotFound
+	}
+	r.tags[tag.ID] = *tag
+	return r.retag(*tag, false), nil
+}
+
+func (r *memoryTags) Delete(ctx context.Context, tag *models.Tag) ([]models.ToDo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.tags, tag.ID)
+	return r.retag(*tag, true), nil
+}
+
+func matchesToDo(todo *models.ToDo, q ListQuery) bool {
+	if len(q.Status) > 0 && !containsString(q.Status, todo.Status) {
+		return false
+	}
+	if q.GroupID != 0 && todo.GroupID != q.GroupID {
+		return false
+	}
+	if q.Search != "" && !containsFold(todo.Title, q.Search) {
+		return false
+	}
+	if !matchesCreated(todo.CreatedAt, q) {
+		return false
+	}
+	if q.DueAfter != nil && (todo.DueDate == nil || todo.DueDate.Before(*q.DueAfter)) {
+		return false
+	}
+	if q.DueBefore != nil && (todo.DueDate == nil || !todo.DueDate.Before(*q.DueBefore)) {
+		return false
+	}
+	return true
+}
+
+func matchesCreated(createdAt time.Time, q ListQuery) bool {
+	if q.CreatedAfter != nil && createdAt.Before(*q.CreatedAfter) {
+		return false
+	}
+	if q.CreatedBefore != nil && !createdAt.Before(*q.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// pageOrder sorts n candidates by (sort value, id), skips everything up to the
+// cursor and keeps q.Limit+1 of them, returning their indexes.
+func pageOrder(n int, fields []string, q ListQuery, value func(i int) string, id func(i int) uint) ([]int, error) {
+	if !containsString(fields, q.Sort) {
+		return nil, fmt.Errorf("%w: unsupported sort %q", ErrInvalidQuery, q.Sort)
+	}
+
+	keys := make([]interface{}, n)
+	for i := range keys {
+		key, err := parseCursorValue(q.Sort, value(i))
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+
+	// compare orders a key/id pair against another in the requested direction
+	compare := func(keyA interface{}, idA uint, keyB interface{}, idB uint) int {
+		c := compareKeys(keyA, keyB)
+		if c == 0 {
+			c = compareKeys(uint64(idA), uint64(idB))
+		}
+		if q.Desc {
+			c = -c
+		}
+		return c
+	}
+
+	order := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		order = append(order, i)
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return compare(keys[order[a]], id(order[a]), keys[order[b]], id(order[b])) < 0
+	})
+
+	if q.After != nil {
+		afterKey, err := parseCursorValue(q.Sort, q.After.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad cursor value", ErrInvalidQuery)
+		}
+		start := sort.Search(len(order), func(i int) bool {
+			return compare(keys[order[i]], id(order[i]), afterKey, q.After.ID) > 0
+		})
+		order = order[start:]
+	}
+
+	if len(order) > q.Limit+1 {
+		order = order[:q.Limit+1]
+	}
+	return order, nil
+}
+
+func compareKeys(a, b interface{}) int {
+	switch a := a.(type) {
+	case time.Time:
+		b := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	case uint64:
+		b := b.(uint64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	default:
+		return strings.Compare(a.(string), b.(string))
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,396 @@
+// Package repository is the storage layer behind the handlers, with a GORM
+// implementation for Postgres and an in-memory one for tests.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmas98/go-todo-service/models"
+)
+
+// ErrNotFound is returned when a record doesn't exist or isn't visible to the caller
+var ErrNotFound = errors.New("record not found")
+
+// ErrVersionConflict is returned when a record changed since the version the
+// caller loaded, so saving its copy would overwrite someone else's change
+var ErrVersionConflict = errors.New("record changed since it was loaded")
+
+// ErrInvalidQuery is returned when a list query names an unknown sort or carries a corrupt cursor
+var ErrInvalidQuery = errors.New("invalid list query")
+
+// GroupRepository stores groups and who they are shared with. Mutations record
+// their domain events in the same transaction. Update, Delete and Restore only
+// go ahead if the stored group is still at group.Version, failing with
+// ErrVersionConflict otherwise; a successful change moves group.Version on.
+// Deleted groups go to the trash, where only the trash methods find them.
+type GroupRepository interface {
+	// List returns the groups the user owns or is a member of, with their todos.
+	// It returns up to q.Limit+1 groups so callers can tell if there are more.
+	List(ctx context.Context, userID int, q ListQuery) ([]models.Group, error)
+	Get(ctx context.Context, id uint, withToDos bool) (*models.Group, error)
+	FindByName(ctx context.Context, ownerID int, name string) (*models.Group, error)
+	Create(ctx context.Context, group *models.Group, actorID int) error
+	// Update saves the fields of the group named in changes
+	Update(ctx context.Context, group *models.Group, changes models.ChangeSet, actorID int) error
+	// Delete moves the group to the trash together with its todos, setting
+	// them as group.ToDos. Its memberships stay for when it is restored.
+	Delete(ctx context.Context, group *models.Group, actorID int) error
+	// Trashed returns the user's groups in the trash, last deleted first
+	Trashed(ctx context.Context, ownerID int) ([]models.Group, error)
+	// GetTrashed returns a group in the trash
+	GetTrashed(ctx context.Context, id uint) (*models.Group, error)
+	// Restore takes the group out of the trash together with the todos
+	// deleted with it, setting them as group.ToDos
+	Restore(ctx context.Context, group *models.Group, actorID int) error
+
+	// Role returns the user's role in the group, or ErrNotFound if it isn't shared with them
+	Role(ctx context.Context, group *models.Group, userID int) (string, error)
+	Members(ctx context.Context, groupID uint) ([]models.GroupMember, error)
+	GetMember(ctx context.Context, groupID uint, userID int) (*models.GroupMember, error)
+	AddMember(ctx context.Context, member *models.GroupMember) error
+	UpdateMemberRole(ctx context.Context, member *models.GroupMember, role string) error
+	RemoveMember(ctx context.Context, member *models.GroupMember) error
+}
+
+// TodoRepository stores todos. Visibility follows the todo's group, and
+// mutations record their domain events in the same transaction. Update, Move,
+// Delete and Restore check todo.Version like the group ones do. Deleted todos
+// go to the trash like groups. Every change to a todo
+// also moves the version of its group, old and new. New todos, and todos
+// whose group changes without a Move, are ranked last in their group. Changes
+// to subtasks recount the subtasks of their parents, which moves the parents'
+// versions too.
+type TodoRepository interface {
+	// List returns the todos in groups shared with the user, up to q.Limit+1
+	List(ctx context.Context, userID int, q ListQuery) ([]models.ToDo, error)
+	// ListDue returns the user's todos due within r, soonest first
+	ListDue(ctx context.Context, userID int, r DueRange) ([]models.ToDo, error)
+	Get(ctx context.Context, id uint) (*models.ToDo, error)
+	// Subtasks returns the todos whose parent is parentID, in rank order
+	Subtasks(ctx context.Context, parentID uint) ([]models.ToDo, error)
+	// Create saves the todo along with its tags and schedules its reminders
+	Create(ctx context.Context, todo *models.ToDo, actorID int) error
+	// Update saves the fields of the todo named in changes, tag_ids standing
+	// for its tags and reminder_offsets for its reminders. A changed status is
+	// recorded as a transition by actorID, and todo's StatusChangedAt and
+	// StatusChangedBy are set. Reminders are scheduled again, unsent, when the
+	// due date changes or the todo is closed or reopened.
+	Update(ctx context.Context, todo *models.ToDo, changes models.ChangeSet, actorID int) error
+	// Move puts the todo at p, ranking it between its new neighbours, and
+	// returns what changed. The neighbours must still be in the group and in
+	// order, or it fails with ErrVersionConflict.
+	Move(ctx context.Context, todo *models.ToDo, p Placement, actorID int) (models.ChangeSet, error)
+	// Delete moves the todo to the trash together with its subtasks at every
+	// level, which it returns
+	Delete(ctx context.Context, todo *models.ToDo, actorID int) ([]models.ToDo, error)
+	// Trashed returns the todos in the trash of the groups shared with the
+	// user, last deleted first. Subtasks deleted with their parent are left
+	// out, since they can only be restored with it.
+	Trashed(ctx context.Context, userID int) ([]models.ToDo, error)
+	// GetTrashed returns a todo in the trash
+	GetTrashed(ctx context.Context, id uint) (*models.ToDo, error)
+	// Restore takes the todo out of the trash together with the subtasks
+	// deleted with it, which it returns, ranking them last in their group and
+	// scheduling their reminders again. It fails with ErrVersionConflict if
+	// the todo's parent is in the trash.
+	Restore(ctx context.Context, todo *models.ToDo, actorID int) ([]models.ToDo, error)
+	// Transitions returns the status history of a todo, oldest first
+	Transitions(ctx context.Context, todoID uint) ([]models.ToDoTransition, error)
+
+	// Transaction runs fn with a repository whose changes are all kept if fn
+	// returns nil and all undone otherwise
+	Transaction(ctx context.Context, fn func(todos TodoRepository) error) error
+}
+
+// TagRepository stores the tags users label todos with. A tag is part of how
+// the todos it is on are shown, so Update and Delete move the versions of
+// those todos and of their groups on, and return the todos.
+type TagRepository interface {
+	// List returns the user's tags by name
+	List(ctx context.Context, ownerID int) ([]models.Tag, error)
+	Get(ctx context.Context, id uint) (*models.Tag, error)
+	// GetMany returns the tags with the given IDs that exist, by name
+	GetMany(ctx context.Context, ids []uint) ([]models.Tag, error)
+	FindByName(ctx context.Context, ownerID int, name string) (*models.Tag, error)
+	Create(ctx context.Context, tag *models.Tag) error
+	// Update saves the name and color of the tag
+	Update(ctx context.Context, tag *models.Tag) ([]models.ToDo, error)
+	// Delete removes the tag, taking it off every todo it is on
+	Delete(ctx context.Context, tag *models.Tag) ([]models.ToDo, error)
+}
+
+// ReminderRepository fires the reminders of todos as they come due
+type ReminderRepository interface {
+	// FireDue records the todo.reminder event of up to limit unsent reminders
+	// due by now and marks them sent in the same transaction, returning how
+	// many fired. Reminders claimed by a concurrent call are skipped, so each
+	// fires once however many schedulers run.
+	FireDue(ctx context.Context, now time.Time, limit int) (int, error)
+}
+
+// TrashRepository empties the trash
+type TrashRepository interface {
+	// Purge deletes up to limit groups and todos that went to the trash
+	// before cutoff for good, together with everything that belongs to them,
+	// and returns how many it deleted
+	Purge(ctx context.Context, cutoff time.Time, limit int) (int, error)
+}
+
+// ListQuery filters, orders and pages a list. Sort is one of the fields in
+// ToDoSortFields or GroupSortFields; ToDo-only filters are ignored for groups.
+type ListQuery struct {
+	Limit         int
+	Sort          string
+	Desc          bool
+	After         *Cursor
+	Status        []string
+	GroupID       uint
+	Search        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	DueAfter      *time.Time
+	DueBefore     *time.Time
+	// Tags keeps the todos with the listing user's tags of these names, all
+	// of them or any of them as TagMode says
+	Tags    []string
+	TagMode string
+	// Now is when the smart sort tells which todos are overdue
+	Now time.Time
+}
+
+// Ways of matching ListQuery.Tags
+const (
+	TagsAll = "all"
+	TagsAny = "any"
+)
+
+// Placement is where a todo goes: into GroupID, right after the todo After
+// and right before the todo Before. Without neighbours it goes last.
+type Placement struct {
+	GroupID uint
+	After   uint
+	Before  uint
+}
+
+// Cursor is the position just past the last item of a page: the value of the
+// sort field and the ID that breaks ties.
+type Cursor struct {
+	Value string
+	ID    uint
+}
+
+// DueRange selects todos by due date. Zero bounds are open; From is inclusive
+// and To exclusive. OpenOnly leaves out todos that are already done.
+type DueRange struct {
+	From     time.Time
+	To       time.Time
+	OpenOnly bool
+}
+
+// Sort fields lists can be ordered by
+var (
+	ToDoSortFields  = []string{"id", "created_at", "due_date", "title", "rank", "smart"}
+	GroupSortFields = []string{"id", "created_at", "name"}
+)
+
+// noDueDate stands in for a missing due date so undated todos sort last
+var noDueDate = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// smartTimeLayout writes due dates at a fixed width, so smart sort values
+// compare like the fields they are made of
+const smartTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// ToDoSortValue is the cursor value of a todo for the sort of q
+func ToDoSortValue(todo *models.ToDo, q ListQuery) string {
+	switch q.Sort {
+	case "smart":
+		return smartValue(todo, q.Now)
+	case "created_at":
+		return formatCursorTime(todo.CreatedAt)
+	case "due_date":
+		return formatCursorTime(dueOrLast(todo))
+	case "title":
+		return todo.Title
+	case "rank":
+		return todo.Rank
+	default:
+		return strconv.FormatUint(uint64(todo.ID), 10)
+	}
+}
+
+// GroupSortValue is the cursor value of a group for the given sort field
+func GroupSortValue(group *models.Group, field string) string {
+	switch field {
+	case "created_at":
+		return formatCursorTime(group.CreatedAt)
+	case "name":
+		return group.Name
+	default:
+		return strconv.FormatUint(uint64(group.ID), 10)
+	}
+}
+
+// smartValue joins what the smart sort orders by: whether the todo is overdue
+// at now, which comes first, its priority, its due date and its rank. Only the
+// rank varies in width, so the values compare like the fields in order.
+func smartValue(todo *models.ToDo, now time.Time) string {
+	overdue := "1"
+	if todo.DueDate != nil && todo.DueDate.Before(now) && !models.IsClosed(todo.Status) {
+		overdue = "0"
+	}
+	return strings.Join([]string{overdue, todo.Priority, dueOrLast(todo).UTC().Format(smartTimeLayout), todo.Rank}, "|")
+}
+
+// smartKey is a smart sort value split back into its fields
+type smartKey struct {
+	overdue  int
+	priority string
+	due      time.Time
+	rank     string
+}
+
+func parseSmartValue(value string) (smartKey, error) {
+	var key smartKey
+	fields := strings.SplitN(value, "|", 4)
+	if len(fields) != 4 || fields[0] != "0" && fields[0] != "1" {
+		return key, fmt.Errorf("%w: bad cursor value", ErrInvalidQuery)
+	}
+	due, err := time.Parse(smartTimeLayout, fields[2])
+	if err != nil {
+		return key, fmt.Errorf("%w: bad cursor value", ErrInvalidQuery)
+	}
+	key.overdue, _ = strconv.Atoi(fields[0])
+	key.priority, key.due, key.rank = fields[1], due, fields[3]
+	return key, nil
+}
+
+func dueOrLast(todo *models.ToDo) time.Time {
+	if todo.DueDate == nil {
+		return noDueDate
+	}
+	return *todo.DueDate
+}
+
+// escapeLike makes user input match literally inside a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func formatCursorTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseCursorValue turns a cursor value back into the type of its sort field
+func parseCursorValue(field, value string) (interface{}, error) {
+	switch field {
+	case "created_at", "due_date":
+		return time.Parse(time.RFC3339Nano, value)
+	case "id":
+		return strconv.ParseUint(value, 10, 64)
+	case "smart":
+		// Smart values compare as strings, but must still parse
+		_, err := parseSmartValue(value)
+		return value, err
+	default:
+		return value, nil
+	}
+}
+
+// parentIDs lists the parents of todos, leaving out todos without one
+func parentIDs(todos ...*models.ToDo) []uint {
+	var ids []uint
+	for _, todo := range todos {
+		if todo.ParentID != nil {
+			ids = append(ids, *todo.ParentID)
+		}
+	}
+	return ids
+}
+
+// moveChanges puts todo in groupID at rank and returns the changes
+func moveChanges(todo *models.ToDo, groupID uint, rank string) models.ChangeSet {
+	changes := models.ChangeSet{"rank": {From: todo.Rank, To: rank}}
+	if todo.GroupID != groupID {
+		changes["group_id"] = models.FieldChange{From: todo.GroupID, To: groupID}
+	}
+	todo.GroupID, todo.Rank = groupID, rank
+	return changes
+}
+
+// newTransition stamps todo with a status change from previous by actorID and
+// returns the transition to record, or nil if the status didn't change.
+func newTransition(todo *models.ToDo, previous string, actorID int) *models.ToDoTransition {
+	if todo.Status == previous {
+		return nil
+	}
+	now := time.Now()
+	todo.StatusChangedAt = &now
+	todo.StatusChangedBy = actorID
+	return &models.ToDoTransition{
+		ToDoID:     todo.ID,
+		FromStatus: previous,
+		ToStatus:   todo.Status,
+		ActorID:    actorID,
+		CreatedAt:  now,
+	}
+}
+
+// planReminders schedules the reminders of todo, one per offset it asks for,
+// against the stored ones. A stored reminder keeps its schedule, and whether
+// it was sent, unless reschedule is set; new ones, and every one when it is,
+// fire offset minutes before the due date, if the todo is open and that is
+// still to come. Reminders are returned in the order they fire.
+func planReminders(todo *models.ToDo, stored []models.Reminder, reschedule bool, now time.Time) []models.Reminder {
+	byOffset := map[int]models.Reminder{}
+	for _, reminder := range stored {
+		byOffset[reminder.OffsetMinutes] = reminder
+	}
+	planned := make([]models.Reminder, 0, len(todo.Reminders))
+	for _, wanted := range todo.Reminders {
+		reminder, ok := byOffset[wanted.OffsetMinutes]
+		if !ok || reschedule {
+			reminder.ToDoID, reminder.OffsetMinutes = todo.ID, wanted.OffsetMinutes
+			reminder.RemindAt, reminder.SentAt = remindAt(todo, wanted.OffsetMinutes, now), nil
+		}
+		planned = append(planned, reminder)
+	}
+	sort.Slice(planned, func(i, j int) bool { return planned[i].OffsetMinutes > planned[j].OffsetMinutes })
+	return planned
+}
+
+// remindAt is when the reminder offset minutes before todo is due fires, or
+// nil if it won't
+func remindAt(todo *models.ToDo, offset int, now time.Time) *time.Time {
+	if todo.DueDate == nil || models.IsClosed(todo.Status) {
+		return nil
+	}
+	at := todo.DueDate.Add(-time.Duration(offset) * time.Minute).UTC()
+	if !at.After(now) {
+		return nil
+	}
+	return &at
+}
+
+// trashTime is when the rows deleted now go to the trash, at the precision
+// Postgres keeps, so the rows deleted together can be told by it
+func trashTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// reschedulesReminders reports whether a change from stored to todo puts its
+// reminders on a new schedule: a new due date, or closing or reopening it
+func reschedulesReminders(stored, todo *models.ToDo) bool {
+	if models.IsClosed(stored.Status) != models.IsClosed(todo.Status) {
+		return true
+	}
+	if stored.DueDate == nil || todo.DueDate == nil {
+		return stored.DueDate != todo.DueDate
+	}
+	return !stored.DueDate.Equal(*todo.DueDate)
+}
@@ -0,0 +1,492 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pmas98/go-todo-service/config"
+	"github.com/pmas98/go-todo-service/events"
+	"github.com/pmas98/go-todo-service/models"
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+const (
+	alice = 1
+	bob   = 2
+)
+
+// store is what both backends offer
+type store interface {
+	Groups() repository.GroupRepository
+	Todos() repository.TodoRepository
+	Tags() repository.TagRepository
+	Reminders() repository.ReminderRepository
+	Trash() repository.TrashRepository
+}
+
+// backend is a store under test and the events it recorded, oldest first
+type backend struct {
+	store
+	t      *testing.T
+	events func() []models.OutboxEvent
+}
+
+// forEachBackend runs test against the in-memory store and, when
+// TEST_DATABASE_URL names a Postgres database, against GORM. The database is
+// wiped before every test.
+func forEachBackend(t *testing.T, test func(b *backend)) {
+	t.Run("memory", func(t *testing.T) {
+		m := repository.NewMemory()
+		test(&backend{store: m, t: t, events: m.Events})
+	})
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("TEST_DATABASE_URL")
+		if url == "" {
+			t.Skip("TEST_DATABASE_URL is not set")
+		}
+		db := openTestDatabase(t, url)
+		test(&backend{store: repository.NewGorm(db, events.DefaultTopics), t: t, events: func() []models.OutboxEvent {
+			var recorded []models.OutboxEvent
+			if err := db.Order("id").Find(&recorded).Error; err != nil {
+				t.Fatal(err)
+			}
+			return recorded
+		}})
+	})
+}
+
+func openTestDatabase(t *testing.T, url string) *gorm.DB {
+	t.Helper()
+	db, err := config.OpenDatabase(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, statement := range []string{"DROP SCHEMA public CASCADE", "CREATE SCHEMA public"} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func (b *backend) createGroup(ownerID int, name string) *models.Group {
+	b.t.Helper()
+	group := &models.Group{Name: name, OwnerID: ownerID, Workflow: "basic"}
+	if err := b.Groups().Create(context.Background(), group, ownerID); err != nil {
+		b.t.Fatal(err)
+	}
+	return group
+}
+
+// createToDo saves todo in group with the defaults the handlers give it
+func (b *backend) createToDo(group *models.Group, todo models.ToDo) *models.ToDo {
+	b.t.Helper()
+	todo.GroupID, todo.OwnerID = group.ID, group.OwnerID
+	if todo.Status == "" {
+		todo.Status = models.StatusPending
+	}
+	if todo.Priority == "" {
+		todo.Priority = models.DefaultPriority
+	}
+	if err := b.Todos().Create(context.Background(), &todo, group.OwnerID); err != nil {
+		b.t.Fatal(err)
+	}
+	return &todo
+}
+
+func (b *backend) get(id uint) *models.ToDo {
+	b.t.Helper()
+	todo, err := b.Todos().Get(context.Background(), id)
+	if err != nil {
+		b.t.Fatalf("todo %d: %v", id, err)
+	}
+	return todo
+}
+
+// count counts the recorded events of a type
+func (b *backend) count(eventType string) int {
+	n := 0
+	for _, event := range b.events() {
+		if event.EventType == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+// trashed loads a todo from the trash, as the restore handler does
+func (b *backend) trashed(id uint) *models.ToDo {
+	b.t.Helper()
+	todo, err := b.Todos().GetTrashed(context.Background(), id)
+	if err != nil {
+		b.t.Fatalf("todo %d in the trash: %v", id, err)
+	}
+	return todo
+}
+
+func ids(todos []models.ToDo) []uint {
+	ids := make([]uint, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+	return ids
+}
+
+func sameIDs(got []uint, want ...uint) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSmartSort(t *testing.T) {
+	forEachBackend(t, func(b *backend) {
+		group := b.createGroup(alice, "Home")
+		now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		at := func(d time.Duration) *time.Time { due := now.Add(d); return &due }
+
+		overdue := b.createToDo(group, models.ToDo{Title: "overdue", Priority: "P2", DueDate: at(-time.Hour)})
+		soon := b.createToDo(group, models.ToDo{Title: "soon", Priority: "P0", DueDate: at(time.Hour)})
+		later := b.createToDo(group, models.ToDo{Title: "later", Priority: "P0", DueDate: at(2 * time.Hour)})
+		undated := b.createToDo(group, models.ToDo{Title: "undated", Priority: "P1"})
+		done := b.createToDo(group, models.ToDo{Title: "done", Priority: "P3", Status: models.StatusDone, DueDate: at(-2 * time.Hour)})
+		urgent := b.createToDo(group, models.ToDo{Title: "urgent", Priority: "P0", DueDate: at(-3 * time.Hour)})
+		// Same key as later but ranked after it
+		tie := b.createToDo(group, models.ToDo{Title: "tie", Priority: "P0", DueDate: at(2 * time.Hour)})
+
+		// Pages of two, carried on by cursors, come out in one order
+		var got []uint
+		q := repository.ListQuery{Limit: 2, Sort: "smart", Now: now}
+		for pages := 0; pages < 10; pages++ {
+			page, err := b.Todos().List(context.Background(), alice, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) <= q.Limit {
+				got = append(got, ids(page)...)
+				break
+			}
+			got = append(got, ids(page[:q.Limit])...)
+			last := page[q.Limit-1]
+			q.After = &repository.Cursor{Value: repository.ToDoSortValue(&last, q), ID: last.ID}
+		}
+		want := []uint{urgent.ID, overdue.ID, soon.ID, later.ID, tie.ID, undated.ID, done.ID}
+		if !sameIDs(got, want...) {
+			t.Errorf("smart order %v, want %v", got, want)
+		}
+
+		if _, err := b.Todos().List(context.Background(), alice, repository.ListQuery{Limit: 2, Sort: "smart", Now: now, After: &repository.Cursor{Value: "bogus", ID: 1}}); !errors.Is(err, repository.ErrInvalidQuery) {
+			t.Errorf("corrupt cursor: %v, want ErrInvalidQuery", err)
+		}
+	})
+}
+
+func TestTagFilters(t *testing.T) {
+	forEachBackend(t, func(b *backend) {
+		ctx := context.Background()
+		group := b.createGroup(alice, "Home")
+		if err := b.Groups().AddMember(ctx, &models.GroupMember{GroupID: group.ID, UserID: bob, Role: models.RoleEditor}); err != nil {
+			t.Fatal(err)
+		}
+		tag := func(ownerID int, name string) models.Tag {
+			tag := models.Tag{OwnerID: ownerID, Name: name, Color: models.DefaultTagColor}
+			if err := b.Tags().Create(ctx, &tag); err != nil {
+				t.Fatal(err)
+			}
+			return tag
+		}
+		home, urgent, bobsHome := tag(alice, "home"), tag(alice, "urgent"), tag(bob, "home")
+
+		both := b.createToDo(group, models.ToDo{Title: "both", Tags: []models.Tag{home, urgent}})
+		onlyHome := b.createToDo(group, models.ToDo{Title: "home", Tags: []models.Tag{home}})
+		b.createToDo(group, models.ToDo{Title: "untagged"})
+		b.createToDo(group, models.ToDo{Title: "bob's", Tags: []models.Tag{bobsHome}})
+
+		tests := []struct {
+			mode string
+			want []uint
+		}{
+			{repository.TagsAll, []uint{both.ID}},
+			{repository.TagsAny, []uint{both.ID, onlyHome.ID}},
+		}
+		for _, tt := range tests {
+			todos, err := b.Todos().List(ctx, alice, repository.ListQuery{Limit: 10, Sort: "id", Tags: []string{"home", "urgent"}, TagMode: tt.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameIDs(ids(todos), tt.want...) {
+				t.Errorf("tags %s: %v, want %v", tt.mode, ids(todos), tt.want)
+			}
+		}
+
+		// Renaming a tag shows on the todos, which move to a new version
+		urgent.Name = "asap"
+		touched, err := b.Tags().Update(ctx, &urgent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameIDs(ids(touched), both.ID) {
+			t.Errorf("rename touched %v, want %d", ids(touched), both.ID)
+		}
+		if got := b.get(both.ID); got.Version != both.Version+1 || len(got.Tags) != 2 || got.Tags[0].Name != "asap" {
+			t.Errorf("renamed tag on %+v", got)
+		}
+	})
+}
+
+func TestVersionConflicts(t *testing.T) {
+	forEachBackend(t, func(b *backend) {
+		ctx := context.Background()
+		group := b.createGroup(alice, "Home")
+		todo := b.createToDo(group, models.ToDo{Title: "Paint"})
+
+		stale := *todo
+		todo.Title = "Paint the fence"
+		if err := b.Todos().Update(ctx, todo, models.ChangeSet{"title": {From: "Paint", To: todo.Title}}, alice); err != nil {
+			t.Fatal(err)
+		}
+		stale.Title = "Paint the shed"
+		if err := b.Todos().Update(ctx, &stale, models.ChangeSet{"title": {From: "Paint", To: stale.Title}}, alice); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Errorf("stale todo update: %v, want ErrVersionConflict", err)
+		}
+		if _, err := b.Todos().Delete(ctx, &stale, alice); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Errorf("stale todo delete: %v, want ErrVersionConflict", err)
+		}
+
+		// The todo moved the group's version on
+		staleGroup := *group
+		if err := b.Groups().Delete(ctx, &staleGroup, alice); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Errorf("stale group delete: %v, want ErrVersionConflict", err)
+		}
+		if got := b.get(todo.ID); got.Title != "Paint the fence" || got.Version != 2 {
+			t.Errorf("todo after the conflicts %+v", got)
+		}
+	})
+}
+
+// TestGroupDeleteRace deletes groups while their todos are being updated.
+// Whichever goes first, the other fails cleanly rather than deadlocking.
+func TestGroupDeleteRace(t *testing.T) {
+	forEachBackend(t, func(b *backend) {
+		ctx := context.Background()
+		for i := 0; i < 20; i++ {
+			group := b.createGroup(alice, fmt.Sprintf("Home %d", i))
+			first := b.createToDo(group, models.ToDo{Title: "Paint"})
+			b.createToDo(group, models.ToDo{Title: "Sweep"})
+			group, err := b.Groups().Get(ctx, group.ID, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			errs := make([]error, 2)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				errs[0] = b.Groups().Delete(ctx, group, alice)
+			}()
+			go func() {
+				defer wg.Done()
+				first.Title = "Paint the fence"
+				errs[1] = b.Todos().Update(ctx, first, models.ChangeSet{"title": {From: "Paint", To: first.Title}}, alice)
+			}()
+			wg.Wait()
+
+			for _, err := range errs {
+				if err != nil && !errors.Is(err, repository.ErrVersionConflict) && !errors.Is(err, repository.ErrNotFound) {
+					t.Fatalf("round %d: %v", i, err)
+				}
+			}
+			if (errs[0] == nil) == (errs[1] == nil) {
+				t.Errorf("round %d: group delete %v, todo update %v, want exactly one to succeed", i, errs[0], errs[1])
+			}
+		}
+	})
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	forEachBackend(t, func(b *backend) {
+		ctx := context.Background()
+		group := b.createGroup(alice, "Home")
+		parent := b.createToDo(group, models.ToDo{Title: "Move house"})
+		sub := b.createToDo(group, models.ToDo{Title: "Pack boxes", ParentID: &parent.ID})
+		other := b.createToDo(group, models.ToDo{Title: "Water the plants"})
+		parent = b.get(parent.ID)
+
+		subtasks, err := b.Todos().Delete(ctx, parent, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameIDs(ids(subtasks), sub.ID) || parent.DeletedAt == nil {
+			t.Fatalf("deleted %+v with subtasks %v", parent, ids(subtasks))
+		}
+		for _, id := range []uint{parent.ID, sub.ID} {
+			if _, err := b.Todos().Get(ctx, id); err != repository.ErrNotFound {
+				t.Errorf("todo %d in the trash: %v, want ErrNotFound", id, err)
+			}
+		}
+		listed, err := b.Todos().List(ctx, alice, repository.ListQuery{Limit: 10, Sort: "id"})
+		if err != nil || !sameIDs(ids(listed), other.ID) {
+			t.Errorf("listed %v, %v, want only %d", ids(listed), err, other.ID)
+		}
+		trashed, err := b.Todos().Trashed(ctx, alice)
+		if err != nil || !sameIDs(ids(trashed), parent.ID) {
+			t.Errorf("trash %v, %v, want only the parent %d", ids(trashed), err, parent.ID)
+		}
+
+		// A subtask comes back with its parent, not before
+		if _, err := b.Todos().Restore(ctx, b.trashed(sub.ID), alice); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Errorf("restoring a subtask of a deleted todo: %v, want ErrVersionConflict", err)
+		}
+		parent = b.trashed(parent.ID)
+		stale := *parent
+		stale.Version--
+		if _, err := b.Todos().Restore(ctx, &stale, alice); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Errorf("stale restore: %v, want ErrVersionConflict", err)
+		}
+		restored, err := b.Todos().Restore(ctx, parent, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameIDs(ids(restored), sub.ID) || parent.DeletedAt != nil {
+			t.Errorf("restored %+v with subtasks %v", parent, ids(restored))
+		}
+		if got := b.get(parent.ID); got.Rank <= other.Rank || got.SubtasksTotal != 1 || got.DeletedAt != nil {
+			t.Errorf("restored todo %+v, want it ranked after %q with its subtask", got, other.Rank)
+		}
+		b.get(sub.ID)
+		if trashed, err := b.Todos().Trashed(ctx, alice); err != nil || len(trashed) != 0 {
+			t.Errorf("trash after restoring %v, %v", ids(trashed), err)
+		}
+
+		// A group comes back with the todos deleted with it only
+		other = b.get(other.ID)
+		if _, err := b.Todos().Delete(ctx, other, alice); err != nil {
+			t.Fatal(err)
+		}
+		group, err = b.Groups().Get(ctx, group.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Groups().Delete(ctx, group, alice); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.Groups().Get(ctx, group.ID, false); err != repository.ErrNotFound {
+			t.Errorf("group in the trash: %v, want ErrNotFound", err)
+		}
+		if groups, err := b.Groups().Trashed(ctx, alice); err != nil || len(groups) != 1 || groups[0].ID != group.ID {
+			t.Errorf("group trash %+v, %v", groups, err)
+		}
+		if trashed, err := b.Todos().Trashed(ctx, alice); err != nil || len(trashed) != 0 {
+			t.Errorf("todos of a deleted group in the trash: %v, %v", ids(trashed), err)
+		}
+		if group, err = b.Groups().GetTrashed(ctx, group.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Groups().Restore(ctx, group, alice); err != nil {
+			t.Fatal(err)
+		}
+		if len(group.ToDos) != 2 || group.DeletedAt != nil {
+			t.Errorf("restored group %+v, want it with the parent and its subtask", group)
+		}
+		b.get(parent.ID)
+		if trashed, err := b.Todos().Trashed(ctx, alice); err != nil || !sameIDs(ids(trashed), other.ID) {
+			t.Errorf("trash after restoring the group %v, %v, want %d", ids(trashed), err, other.ID)
+		}
+
+		if n := b.count(events.ToDoRestored); n != 4 {
+			t.Errorf("%d todo.restored events, want 4", n)
+		}
+		if n := b.count(events.GroupRestored); n != 1 {
+			t.Errorf("%d group.restored events, want 1", n)
+		}
+	})
+}
+
+func TestRemindersAndPurge(t *testing.T) {
+	forEachBackend(t, func(b *backend) {
+		ctx := context.Background()
+		group := b.createGroup(alice, "Home")
+		now := time.Now().UTC().Truncate(time.Second)
+		due := now.Add(2 * time.Hour)
+		reminded := b.createToDo(group, models.ToDo{Title: "Post the parcel", DueDate: &due, Reminders: []models.Reminder{{OffsetMinutes: 60}}})
+		trashed := b.createToDo(group, models.ToDo{Title: "Call the bank", DueDate: &due, Reminders: []models.Reminder{{OffsetMinutes: 60}}})
+		if _, err := b.Todos().Delete(ctx, trashed, alice); err != nil {
+			t.Fatal(err)
+		}
+
+		// Reminders of todos in the trash don't fire, and none fires twice
+		fire := func() int {
+			t.Helper()
+			fired, err := b.Reminders().FireDue(ctx, now.Add(90*time.Minute), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fired
+		}
+		if fired := fire(); fired != 1 {
+			t.Errorf("fired %d reminders, want the one of %d", fired, reminded.ID)
+		}
+		if fired := fire(); fired != 0 {
+			t.Errorf("fired %d reminders again", fired)
+		}
+		if _, err := b.Todos().Restore(ctx, b.trashed(trashed.ID), alice); err != nil {
+			t.Fatal(err)
+		}
+		if fired := fire(); fired != 1 {
+			t.Errorf("fired %d reminders after restoring, want 1", fired)
+		}
+
+		// Purging only takes what is past the cutoff
+		if _, err := b.Todos().Delete(ctx, b.get(trashed.ID), alice); err != nil {
+			t.Fatal(err)
+		}
+		if purged, err := b.Trash().Purge(ctx, now.Add(-time.Hour), 10); err != nil || purged != 0 {
+			t.Errorf("purged %d, %v before the cutoff", purged, err)
+		}
+		if purged, err := b.Trash().Purge(ctx, time.Now().Add(time.Minute), 10); err != nil || purged != 1 {
+			t.Errorf("purged %d, %v, want the todo", purged, err)
+		}
+		if _, err := b.Todos().GetTrashed(ctx, trashed.ID); err != repository.ErrNotFound {
+			t.Errorf("purged todo: %v, want ErrNotFound", err)
+		}
+
+		if err := b.Groups().AddMember(ctx, &models.GroupMember{GroupID: group.ID, UserID: bob, Role: models.RoleViewer}); err != nil {
+			t.Fatal(err)
+		}
+		group, err := b.Groups().Get(ctx, group.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Groups().Delete(ctx, group, alice); err != nil {
+			t.Fatal(err)
+		}
+		if purged, err := b.Trash().Purge(ctx, time.Now().Add(time.Minute), 10); err != nil || purged != 1 {
+			t.Errorf("purged %d, %v, want the group", purged, err)
+		}
+		if _, err := b.Groups().GetTrashed(ctx, group.ID); err != repository.ErrNotFound {
+			t.Errorf("purged group: %v, want ErrNotFound", err)
+		}
+		if _, err := b.Todos().GetTrashed(ctx, reminded.ID); err != repository.ErrNotFound {
+			t.Errorf("todo of a purged group: %v, want ErrNotFound", err)
+		}
+		if members, err := b.Groups().Members(ctx, group.ID); err != nil || len(members) != 0 {
+			t.Errorf("members of a purged group %+v, %v", members, err)
+		}
+	})
+}
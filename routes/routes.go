@@ -1,31 +1,94 @@
 package routes
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/pmas98/go-todo-service/apierror"
 	"github.com/pmas98/go-todo-service/controllers"
 	"github.com/pmas98/go-todo-service/middleware"
 )
 
-func SetupRouter() *gin.Engine {
+func SetupRouter(verifier middleware.TokenVerifier, deps controllers.Dependencies, checks map[string]controllers.DependencyCheck) *gin.Engine {
+	health := controllers.NewHealthHandler(checks)
+	todos := controllers.NewToDoHandler(deps)
+	groups := controllers.NewGroupHandler(deps)
+	members := controllers.NewMemberHandler(deps)
+	workflows := controllers.NewWorkflowHandler(deps)
+	tags := controllers.NewTagHandler(deps)
+	trash := controllers.NewTrashHandler(deps)
+
 	r := gin.Default()
-	r.Use(middleware.VerifyTokenAndInteractWithKafka)
+	r.Use(middleware.RequestID(), middleware.Authenticate(verifier), middleware.Idempotency(deps.Cache, deps.IdempotencyTTL))
+	r.NoRoute(routeNotFound)
 	api := r.Group("/api/v1")
 	{
-		api.GET("/health", controllers.HealthCheck)
+		api.GET("/health", health.HealthCheck)
 		api.POST("/createTopic", controllers.CreateTopic)
 
-		api.GET("/todos/:id", controllers.GetToDosById)
-		api.GET("/todos/date/:date", controllers.GetToDosByDate)
-		api.GET("/todos", controllers.GetToDos)
-		api.POST("/todos", controllers.CreateToDo)
-		api.PUT("/todos/:id", controllers.UpdateToDo)
-		api.DELETE("/todos/:id", controllers.DeleteToDo)
-
-		api.POST("/groups", controllers.CreateGroup)
-		api.GET("/groups", controllers.GetGroups)
-		api.GET("/groups/:id", controllers.GetGroup)
-		api.DELETE("/groups/:id", controllers.DeleteGroup)
+		api.GET("/todos/:id", todos.GetToDosById)
+		api.GET("/todos/date/:date", todos.GetToDosByDate)
+		api.GET("/todos/overdue", todos.GetOverdueToDos)
+		api.GET("/todos/upcoming", todos.GetUpcomingToDos)
+		api.GET("/todos", todos.GetToDos)
+		api.POST("/todos", todos.CreateToDo)
+		api.POST("/todos:method", customMethods(map[string]gin.HandlerFunc{
+			"batch": todos.BatchToDos,
+		}))
+		api.PUT("/todos/:id", todos.UpdateToDo)
+		api.PATCH("/todos/:id", todos.PatchToDo)
+		api.DELETE("/todos/:id", todos.DeleteToDo)
+		api.GET("/todos/:id/transitions", todos.GetToDoTransitions)
+		api.POST("/todos/:id/transitions", todos.TransitionToDo)
+		api.POST("/todos/:id/move", todos.MoveToDo)
+		api.GET("/todos/:id/subtasks", todos.GetSubtasks)
+		api.POST("/todos/:id/subtasks", todos.CreateSubtask)
+		api.POST("/todos/:id/skip", todos.SkipOccurrence)
+		api.DELETE("/todos/:id/recurrence", todos.StopRecurring)
+		api.POST("/todos/:id/restore", todos.RestoreToDo)
+
+		api.GET("/workflows", workflows.GetWorkflows)
+
+		api.GET("/tags", tags.GetTags)
+		api.POST("/tags", tags.CreateTag)
+		api.GET("/tags/:id", tags.GetTag)
+		api.PUT("/tags/:id", tags.UpdateTag)
+		api.DELETE("/tags/:id", tags.DeleteTag)
+
+		api.GET("/trash", trash.GetTrash)
+
+		api.POST("/groups", groups.CreateGroup)
+		api.GET("/groups", groups.GetGroups)
+		api.GET("/groups/:id", groups.GetGroup)
+		api.PUT("/groups/:id", groups.UpdateGroup)
+		api.PATCH("/groups/:id", groups.PatchGroup)
+		api.DELETE("/groups/:id", groups.DeleteGroup)
+		api.POST("/groups/:id/restore", groups.RestoreGroup)
+
+		api.GET("/groups/:id/members", members.GetGroupMembers)
+		api.POST("/groups/:id/members", members.AddGroupMember)
+		api.PUT("/groups/:id/members/:userId", members.UpdateGroupMember)
+		api.DELETE("/groups/:id/members/:userId", members.RemoveGroupMember)
 	}
 
 	return r
 }
+
+func routeNotFound(c *gin.Context) {
+	apierror.Abort(c, apierror.NotFound("route_not_found", "No endpoint matches "+c.Request.Method+" "+c.Request.URL.Path))
+}
+
+// customMethods serves custom methods on a collection, like POST /todos:batch.
+// The router can't match a literal after a colon, so they share one route
+// whose parameter is the method name, colon included.
+func customMethods(methods map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The route also matches paths like /todosfoo, which aren't methods
+		name, isMethod := strings.CutPrefix(c.Param("method"), ":")
+		if handler, ok := methods[name]; ok && isMethod {
+			handler(c)
+			return
+		}
+		routeNotFound(c)
+	}
+}
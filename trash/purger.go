@@ -0,0 +1,60 @@
+// Package trash empties the trash of groups and todos once they can no longer
+// be restored.
+//
+// Deleting a group or a todo only moves it to the trash, where it stays for
+// the retention period. The purger then deletes it for good with everything
+// that belongs to it. Every replica runs a purger; expired rows are claimed
+// with FOR UPDATE SKIP LOCKED, so the purgers don't wait on each other.
+package trash
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pmas98/go-todo-service/repository"
+)
+
+// Purger periodically deletes what has been in the trash for longer than the
+// retention period
+type Purger struct {
+	trash     repository.TrashRepository
+	retention time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+func NewPurger(trash repository.TrashRepository, retention, interval time.Duration, batchSize int) *Purger {
+	return &Purger{trash: trash, retention: retention, interval: interval, batchSize: batchSize}
+}
+
+// Run purges the trash until ctx is cancelled
+func (p *Purger) Run(ctx context.Context) {
+	log.Println("Trash purger started")
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Trash purger stopped")
+			return
+		case <-ticker.C:
+			if err := p.purge(ctx); err != nil {
+				log.Printf("Trash purger: %v", err)
+			}
+		}
+	}
+}
+
+// purge deletes everything past the retention period, a batch per transaction
+func (p *Purger) purge(ctx context.Context) error {
+	cutoff := time.Now().Add(-p.retention)
+	for ctx.Err() == nil {
+		purged, err := p.trash.Purge(ctx, cutoff, p.batchSize)
+		if err != nil || purged < p.batchSize {
+			return err
+		}
+	}
+	return nil
+}
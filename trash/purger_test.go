@@ -0,0 +1,117 @@
+package trash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// result is what a call to Purge returns
+type result struct {
+	purged int
+	err    error
+}
+
+// fakeTrash answers Purge with results in turn, then with nothing to purge.
+// The cutoff of every call is reported on calls.
+type fakeTrash struct {
+	mu      sync.Mutex
+	results []result
+	limits  []int
+	calls   chan time.Time
+}
+
+func (f *fakeTrash) Purge(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	f.mu.Lock()
+	f.limits = append(f.limits, limit)
+	r := result{}
+	if len(f.results) > 0 {
+		r, f.results = f.results[0], f.results[1:]
+	}
+	f.mu.Unlock()
+	f.calls <- cutoff
+	return r.purged, r.err
+}
+
+// start runs a purger over f until the returned function cancels it. That
+// fails the test unless the purger returns soon after, and otherwise gives
+// what it logged.
+func start(t *testing.T, f *fakeTrash, retention time.Duration, batchSize int) func() string {
+	t.Helper()
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewPurger(f, retention, time.Millisecond, batchSize).Run(ctx)
+		close(done)
+	}()
+	return func() string {
+		cancel()
+		for {
+			select {
+			case <-done:
+				return logs.String()
+			case <-f.calls:
+			case <-time.After(time.Second):
+				t.Fatal("purger still running after its context was cancelled")
+			}
+		}
+	}
+}
+
+func TestPurgerEmptiesEveryBatch(t *testing.T) {
+	f := &fakeTrash{results: []result{{purged: 3}, {purged: 3}, {purged: 0}}, calls: make(chan time.Time)}
+	retention := 24 * time.Hour
+	stop := start(t, f, retention, 3)
+
+	// Full batches are followed by another one in the same tick, with the
+	// cutoff the retention period before the tick started
+	first := <-f.calls
+	if age := time.Since(first); age < retention || age > retention+time.Minute {
+		t.Errorf("purged what was trashed %s ago, want %s", age, retention)
+	}
+	for i := 0; i < 2; i++ {
+		if cutoff := <-f.calls; !cutoff.Equal(first) {
+			t.Errorf("batch %d cut off at %v, want %v", i+2, cutoff, first)
+		}
+	}
+	if cutoff := <-f.calls; !cutoff.After(first) {
+		t.Errorf("next tick cut off at %v, want after %v", cutoff, first)
+	}
+	logs := stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, limit := range f.limits {
+		if limit != 3 {
+			t.Errorf("purged up to %d rows, want the batch size", limit)
+		}
+	}
+	if !strings.Contains(logs, "Trash purger stopped") {
+		t.Errorf("logged %q", logs)
+	}
+}
+
+func TestPurgerKeepsGoingAfterErrors(t *testing.T) {
+	f := &fakeTrash{results: []result{{err: errors.New("deadlock detected")}, {purged: 1}}, calls: make(chan time.Time)}
+	stop := start(t, f, time.Hour, 3)
+
+	// The error ends the tick, and the next one tries again
+	first := <-f.calls
+	if cutoff := <-f.calls; !cutoff.After(first) {
+		t.Errorf("retried in the same tick")
+	}
+	<-f.calls
+	if logs := stop(); !strings.Contains(logs, "Trash purger: deadlock detected") {
+		t.Errorf("error not logged: %q", logs)
+	}
+}
@@ -2,16 +2,24 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/IBM/sarama"
 )
 
 func InitKafkaConsumerGroup(groupID string) (sarama.ConsumerGroup, error) {
+	return newConsumerGroup(groupID, sarama.OffsetOldest)
+}
+
+// newConsumerGroup joins groupID, starting at initial where the group has no
+// committed offset yet
+func newConsumerGroup(groupID string, initial int64) (sarama.ConsumerGroup, error) {
 	config := sarama.NewConfig()
 	config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
-	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.Offsets.Initial = initial
 
 	consumerGroup, err := sarama.NewConsumerGroup(kafkaBrokers, groupID, config)
 	if err != nil {
@@ -38,6 +46,24 @@ func ConsumeMessagesFromKafka(topic string, groupID string) error {
 	}
 }
 
+// consumeUntilClosed consumes topics in the background until ctx is cancelled
+// or the consumer group is closed, rejoining after every rebalance.
+func consumeUntilClosed(ctx context.Context, consumerGroup sarama.ConsumerGroup, topics []string, handler sarama.ConsumerGroupHandler, name string) {
+	go func() {
+		log.Printf("%s consumer started", name)
+		for {
+			err := consumerGroup.Consume(ctx, topics, handler)
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) || ctx.Err() != nil {
+				log.Printf("%s consumer stopped", name)
+				return
+			}
+			if err != nil {
+				log.Printf("Error from %s consumer: %v", strings.ToLower(name), err)
+			}
+		}
+	}()
+}
+
 // ConsumerGroupHandler represents a Sarama consumer group consumer
 type ConsumerGroupHandler struct{}
 
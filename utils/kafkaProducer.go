@@ -2,18 +2,21 @@ package utils
 
 import (
 	"log"
-	"os"
 
 	"github.com/IBM/sarama"
 )
 
 var (
-	kafkaBrokers = []string{os.Getenv("Kafka_URL")} // Replace with your Kafka broker(s) address
+	kafkaBrokers []string
 	producer     sarama.SyncProducer
 	adminClient  sarama.ClusterAdmin
 )
 
-func InitKafkaProducer() error {
+// InitKafkaProducer connects the producer to the given brokers. The admin
+// client and the consumers started afterwards use the same brokers.
+func InitKafkaProducer(brokers []string) error {
+	kafkaBrokers = brokers
+
 	// Configure the Kafka producer
 	config := sarama.NewConfig()
 	config.Producer.Return.Successes = true
@@ -27,6 +30,14 @@ func InitKafkaProducer() error {
 	return nil
 }
 
+// CloseKafkaProducer waits for in-flight messages and closes the producer
+func CloseKafkaProducer() error {
+	if producer == nil {
+		return nil
+	}
+	return producer.Close()
+}
+
 func SendMessageToKafka(topic string, message string, key string) error {
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
@@ -58,3 +69,23 @@ func SendMessageJSONToKafka(topic string, message []byte, key string) error {
 	}
 	return nil
 }
+
+// SendMessageJSONToKafkaWithHeaders sends a JSON message with the given Kafka headers attached
+func SendMessageJSONToKafkaWithHeaders(topic string, message []byte, key string, headers map[string]string) error {
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(message),
+		Key:   sarama.StringEncoder(key),
+	}
+	for name, value := range headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(name), Value: []byte(value)})
+	}
+
+	// Send message to Kafka
+	_, _, err := producer.SendMessage(msg)
+	if err != nil {
+		log.Printf("Failed to send message to Kafka: %v", err)
+		return err
+	}
+	return nil
+}
@@ -5,46 +5,91 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/IBM/sarama"
+	uuid "github.com/hashicorp/go-uuid"
 	"github.com/pmas98/go-todo-service/models"
 )
 
+// CorrelationIDHeader is the Kafka header carrying the ID that ties a token
+// verification response back to the request that asked for it.
+const CorrelationIDHeader = "correlation_id"
+
+// correlationIDSeparator ends the instance ID every correlation ID starts with
+const correlationIDSeparator = "/"
+
 var (
-	// Channel to pass the token verification response back to the caller
-	tokenVerificationResultCh chan *models.TokenVerificationResponse
+	// Waiters for in-flight token verification requests, keyed by correlation ID
+	pendingVerifications   = make(map[string]chan *models.TokenVerificationResponse)
+	pendingVerificationsMu sync.Mutex
+
+	// Number of responses to this instance that arrived with no matching
+	// waiter (late, duplicated or orphaned)
+	droppedVerificationResponses uint64
 )
 
-// Initialize Kafka consumer for token verification responses
-func InitTokenVerificationConsumer(groupID string) error {
-	config := sarama.NewConfig()
-	config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
-	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+// InstanceID names this process among the replicas of the service. A
+// configured ID is used as is and must be unique; otherwise it is the host
+// name with a random suffix, so processes sharing a host don't collide.
+func InstanceID(configured string) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "todo-service"
+	}
+	suffix, err := uuid.GenerateRandomBytes(4)
+	if err != nil {
+		return "", fmt.Errorf("generating instance ID: %w", err)
+	}
+	return fmt.Sprintf("%s-%x", host, suffix), nil
+}
 
-	consumerGroup, err := sarama.NewConsumerGroup(kafkaBrokers, groupID, config)
+// NewCorrelationID returns a fresh correlation ID for a verification request
+// of the given instance. The consumer of that instance recognizes the reply
+// by its prefix.
+func NewCorrelationID(instanceID string) (string, error) {
+	id, err := uuid.GenerateUUID()
 	if err != nil {
-		return err
+		return "", err
+	}
+	return instanceID + correlationIDSeparator + id, nil
+}
+
+// InitTokenVerificationConsumer starts consuming token verification responses
+// from topic until ctx is cancelled. The caller closes the returned consumer
+// group.
+//
+// Every instance must see every reply, since only the one that sent a request
+// is waiting for its reply, so each consumes in a group of its own, named by
+// groupPrefix and instanceID. Such a group starts at the newest offset: the
+// replies from before it started were meant for nobody.
+func InitTokenVerificationConsumer(ctx context.Context, groupPrefix, instanceID, topic string) (sarama.ConsumerGroup, error) {
+	consumerGroup, err := newConsumerGroup(groupPrefix+"-"+instanceID, sarama.OffsetNewest)
+	if err != nil {
+		return nil, err
 	}
 
 	// Start consuming messages from the topic
-	go func() {
-		log.Println("Token verification consumer started")
-		ctx := context.Background()
-		handler := &TokenVerificationResponseHandler{}
-
-		for {
-			err := consumerGroup.Consume(ctx, []string{"token_verification_responses"}, handler)
-			if err != nil {
-				log.Printf("Error from token verification consumer: %v", err)
-			}
-		}
-	}()
+	consumeUntilClosed(ctx, consumerGroup, []string{topic}, NewTokenVerificationResponseHandler(instanceID), "Token verification")
+	return consumerGroup, nil
+}
 
-	return nil
+// TokenVerificationResponseHandler hands token verification responses to the
+// requests of its instance waiting for them. Replies to other instances are
+// skipped.
+type TokenVerificationResponseHandler struct {
+	prefix string
 }
 
-// TokenVerificationResponseHandler handles token verification response messages
-type TokenVerificationResponseHandler struct{}
+func NewTokenVerificationResponseHandler(instanceID string) *TokenVerificationResponseHandler {
+	return &TokenVerificationResponseHandler{prefix: instanceID + correlationIDSeparator}
+}
 
 // Setup is run at the beginning of a new session, before ConsumeClaim
 func (h *TokenVerificationResponseHandler) Setup(sarama.ConsumerGroupSession) error {
@@ -59,18 +104,27 @@ func (h *TokenVerificationResponseHandler) Cleanup(sarama.ConsumerGroupSession)
 // ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
 func (h *TokenVerificationResponseHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for msg := range claim.Messages() {
-		fmt.Printf("Token verification response received: value = %s, timestamp = %v, topic = %s\n", string(msg.Value), msg.Timestamp, msg.Topic)
-
 		var response models.TokenVerificationResponse
-		err := json.Unmarshal(msg.Value, &response)
-		if err != nil {
+		if err := json.Unmarshal(msg.Value, &response); err != nil {
 			log.Printf("Error unmarshaling token verification response: %v", err)
+			session.MarkMessage(msg, "")
 			continue
 		}
 
-		// Send the response to the result channel
-		if tokenVerificationResultCh != nil {
-			tokenVerificationResultCh <- &response
+		// The header wins over the payload so the auth service can echo it without touching the body
+		correlationID := headerValue(msg, CorrelationIDHeader)
+		if correlationID == "" {
+			correlationID = response.RequestID
+		}
+
+		if correlationID != "" && !strings.HasPrefix(correlationID, h.prefix) {
+			// A reply to another instance
+			session.MarkMessage(msg, "")
+			continue
+		}
+		if !deliverTokenVerificationResponse(correlationID, &response) {
+			dropped := atomic.AddUint64(&droppedVerificationResponses, 1)
+			log.Printf("Dropped token verification response with correlation ID %q (no waiter, %d dropped so far)", correlationID, dropped)
 		}
 
 		session.MarkMessage(msg, "") // Mark message as processed
@@ -78,8 +132,61 @@ func (h *TokenVerificationResponseHandler) ConsumeClaim(session sarama.ConsumerG
 	return nil
 }
 
-// SetTokenVerificationResultChannel sets the channel to receive token verification responses
-func SetTokenVerificationResultChannel(ch chan *models.TokenVerificationResponse) {
-	log.Println("Token verification result channel set")
-	tokenVerificationResultCh = ch
+// RegisterTokenVerification creates the waiter for a verification request. It
+// must be called before the request is published so a fast reply is not lost.
+func RegisterTokenVerification(correlationID string) (<-chan *models.TokenVerificationResponse, error) {
+	pendingVerificationsMu.Lock()
+	defer pendingVerificationsMu.Unlock()
+
+	if _, exists := pendingVerifications[correlationID]; exists {
+		return nil, fmt.Errorf("token verification %q is already pending", correlationID)
+	}
+	ch := make(chan *models.TokenVerificationResponse, 1)
+	pendingVerifications[correlationID] = ch
+	return ch, nil
+}
+
+// UnregisterTokenVerification removes the waiter for a verification request.
+// Replies arriving afterwards are dropped and counted.
+func UnregisterTokenVerification(correlationID string) {
+	pendingVerificationsMu.Lock()
+	delete(pendingVerifications, correlationID)
+	pendingVerificationsMu.Unlock()
+}
+
+// DroppedTokenVerificationResponses returns how many responses could not be
+// matched to a waiting request since startup.
+func DroppedTokenVerificationResponses() uint64 {
+	return atomic.LoadUint64(&droppedVerificationResponses)
+}
+
+// deliverTokenVerificationResponse hands the response to its waiter, reporting
+// false when there is nobody to hand it to.
+func deliverTokenVerificationResponse(correlationID string, response *models.TokenVerificationResponse) bool {
+	if correlationID == "" {
+		return false
+	}
+
+	pendingVerificationsMu.Lock()
+	ch, ok := pendingVerifications[correlationID]
+	if ok {
+		// Only the first reply is wanted, so the waiter goes away once it is served
+		delete(pendingVerifications, correlationID)
+	}
+	pendingVerificationsMu.Unlock()
+
+	if !ok {
+		return false
+	}
+	ch <- response
+	return true
+}
+
+func headerValue(msg *sarama.ConsumerMessage, key string) string {
+	for _, header := range msg.Headers {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
 }
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/pmas98/go-todo-service/models"
+)
+
+// fakeSession records the messages marked as processed
+type fakeSession struct {
+	mu     sync.Mutex
+	marked int
+}
+
+func (s *fakeSession) Claims() map[string][]int32                                               { return nil }
+func (s *fakeSession) MemberID() string                                                         { return "member" }
+func (s *fakeSession) GenerationID() int32                                                      { return 1 }
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, metadata string)  {}
+func (s *fakeSession) Commit()                                                                  {}
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {}
+func (s *fakeSession) Context() context.Context                                                 { return context.Background() }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	s.marked++
+	s.mu.Unlock()
+}
+
+// fakeClaim serves a fixed list of messages
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func newFakeClaim(messages ...*sarama.ConsumerMessage) *fakeClaim {
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(messages))}
+	for _, msg := range messages {
+		claim.messages <- msg
+	}
+	close(claim.messages)
+	return claim
+}
+
+func (c *fakeClaim) Topic() string                            { return "token_verification_responses" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// reply is a response for userID, its correlation ID in the header or, if
+// inBody is set, only in the payload
+func reply(t *testing.T, correlationID string, userID int, inBody bool) *sarama.ConsumerMessage {
+	t.Helper()
+	response := models.TokenVerificationResponse{Valid: true, UserID: userID}
+	msg := &sarama.ConsumerMessage{}
+	if inBody {
+		response.RequestID = correlationID
+	} else {
+		msg.Headers = []*sarama.RecordHeader{{Key: []byte(CorrelationIDHeader), Value: []byte(correlationID)}}
+	}
+	value, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Value = value
+	return msg
+}
+
+// consume runs the handler of instance over the messages
+func consume(t *testing.T, instance string, messages ...*sarama.ConsumerMessage) *fakeSession {
+	t.Helper()
+	session := &fakeSession{}
+	if err := NewTokenVerificationResponseHandler(instance).ConsumeClaim(session, newFakeClaim(messages...)); err != nil {
+		t.Fatal(err)
+	}
+	if session.marked != len(messages) {
+		t.Errorf("%d of %d messages marked", session.marked, len(messages))
+	}
+	return session
+}
+
+func TestConcurrentWaiters(t *testing.T) {
+	const waiters = 50
+	ids := make([]string, waiters)
+	channels := make([]<-chan *models.TokenVerificationResponse, waiters)
+	for i := range ids {
+		var err error
+		if ids[i], err = NewCorrelationID("a"); err != nil {
+			t.Fatal(err)
+		}
+		if channels[i], err = RegisterTokenVerification(ids[i]); err != nil {
+			t.Fatal(err)
+		}
+		defer UnregisterTokenVerification(ids[i])
+	}
+	dropped := DroppedTokenVerificationResponses()
+
+	// Replies come back in reverse, some with the ID in the payload only
+	var wg sync.WaitGroup
+	got := make([]int, waiters)
+	for i := range channels {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case response := <-channels[i]:
+				got[i] = response.UserID
+			case <-time.After(5 * time.Second):
+			}
+		}(i)
+	}
+	var messages []*sarama.ConsumerMessage
+	for i := waiters - 1; i >= 0; i-- {
+		messages = append(messages, reply(t, ids[i], i+1, i%3 == 0))
+	}
+	consume(t, "a", messages...)
+	wg.Wait()
+
+	for i, userID := range got {
+		if userID != i+1 {
+			t.Errorf("waiter %d got user %d, want %d", i, userID, i+1)
+		}
+	}
+	if n := DroppedTokenVerificationResponses() - dropped; n != 0 {
+		t.Errorf("%d replies dropped, want none", n)
+	}
+}
+
+func TestUndeliverableReplies(t *testing.T) {
+	late, err := NewCorrelationID("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RegisterTokenVerification(late); err != nil {
+		t.Fatal(err)
+	}
+	// The request timed out before its reply came
+	UnregisterTokenVerification(late)
+
+	served, err := NewCorrelationID("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := RegisterTokenVerification(served)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterTokenVerification(served)
+	if _, err := RegisterTokenVerification(served); err == nil {
+		t.Error("registering a pending correlation ID twice succeeded")
+	}
+
+	tests := []struct {
+		name     string
+		messages []*sarama.ConsumerMessage
+		dropped  uint64
+	}{
+		{"unknown correlation ID", []*sarama.ConsumerMessage{reply(t, "a/unknown", 1, false)}, 1},
+		{"late reply", []*sarama.ConsumerMessage{reply(t, late, 1, false)}, 1},
+		{"no correlation ID", []*sarama.ConsumerMessage{reply(t, "", 1, false)}, 1},
+		{"duplicate reply", []*sarama.ConsumerMessage{reply(t, served, 2, false), reply(t, served, 3, false)}, 1},
+		{"malformed reply", []*sarama.ConsumerMessage{{Value: []byte("{")}}, 0},
+		{"reply to another instance", []*sarama.ConsumerMessage{reply(t, "b/"+late, 1, false), reply(t, "ab/x", 1, false)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dropped := DroppedTokenVerificationResponses()
+			consume(t, "a", tt.messages...)
+			if n := DroppedTokenVerificationResponses() - dropped; n != tt.dropped {
+				t.Errorf("%d replies dropped, want %d", n, tt.dropped)
+			}
+		})
+	}
+	// Only the first of the duplicates was delivered
+	select {
+	case response := <-ch:
+		if response.UserID != 2 {
+			t.Errorf("waiter got user %d, want the first reply's 2", response.UserID)
+		}
+	default:
+		t.Fatal("waiter got no reply")
+	}
+	select {
+	case response := <-ch:
+		t.Errorf("waiter got a second reply %+v", response)
+	default:
+	}
+}
+
+func TestInstanceID(t *testing.T) {
+	if id, err := InstanceID("replica-1"); err != nil || id != "replica-1" {
+		t.Errorf("configured instance ID gave %q, %v", id, err)
+	}
+	first, err := InstanceID("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := InstanceID("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || first == "" {
+		t.Errorf("generated instance IDs %q and %q, want two different ones", first, second)
+	}
+	id, err := NewCorrelationID(first)
+	if err != nil || !strings.HasPrefix(id, first+"/") || id == first+"/" {
+		t.Errorf("correlation ID %q, %v doesn't start with the instance ID %q", id, err, first)
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/IBM/sarama"
+	"github.com/pmas98/go-todo-service/models"
+)
+
+// InitTokenRevocationConsumer starts passing the models.TokenRevokedEvent
+// messages the auth service publishes to topic to onRevoked until ctx is
+// cancelled. The caller closes the returned consumer group.
+func InitTokenRevocationConsumer(ctx context.Context, groupID, topic string, onRevoked func(models.TokenRevokedEvent)) (sarama.ConsumerGroup, error) {
+	consumerGroup, err := InitKafkaConsumerGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start consuming messages from the topic
+	consumeUntilClosed(ctx, consumerGroup, []string{topic}, &TokenRevocationHandler{onRevoked: onRevoked}, "Token revocation")
+	return consumerGroup, nil
+}
+
+// TokenRevocationHandler passes token revocation events to a callback
+type TokenRevocationHandler struct {
+	onRevoked func(models.TokenRevokedEvent)
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (h *TokenRevocationHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
+func (h *TokenRevocationHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
+func (h *TokenRevocationHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		var event models.TokenRevokedEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			log.Printf("Error unmarshaling token revocation event: %v", err)
+		} else {
+			h.onRevoked(event)
+		}
+		session.MarkMessage(msg, "") // Mark message as processed
+	}
+	return nil
+}
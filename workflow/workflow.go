@@ -0,0 +1,207 @@
+// Package workflow defines the statuses a todo can be in and the transitions
+// allowed between them. Each group follows one workflow.
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pmas98/go-todo-service/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the built-in workflows
+const (
+	Basic  = "basic"
+	Kanban = "kanban"
+)
+
+// Workflow is a state machine over todo statuses. Every status is a key of
+// Transitions, listing the statuses it may move to; terminal statuses map to
+// an empty list. Complete lists the statuses that finish an occurrence of a
+// recurring todo, done if the workflow has it and none are given. They must
+// be among models.ClosedStatuses, which keep finished todos out of the due
+// lists and count them as closed subtasks.
+type Workflow struct {
+	Name        string              `yaml:"name" json:"name"`
+	Initial     string              `yaml:"initial" json:"initial"`
+	Transitions map[string][]string `yaml:"transitions" json:"transitions"`
+	Complete    []string            `yaml:"complete" json:"complete"`
+}
+
+// Has reports whether status belongs to the workflow
+func (w *Workflow) Has(status string) bool {
+	_, ok := w.Transitions[status]
+	return ok
+}
+
+// Next lists the statuses a todo in status may move to
+func (w *Workflow) Next(status string) []string {
+	return append([]string{}, w.Transitions[status]...)
+}
+
+// Allows reports whether a todo may move from one status to another
+func (w *Workflow) Allows(from, to string) bool {
+	for _, next := range w.Transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Completes reports whether a todo moving into status finishes its occurrence
+func (w *Workflow) Completes(status string) bool {
+	for _, complete := range w.Complete {
+		if complete == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Statuses lists the workflow's statuses in alphabetical order
+func (w *Workflow) Statuses() []string {
+	statuses := make([]string, 0, len(w.Transitions))
+	for status := range w.Transitions {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	return statuses
+}
+
+func (w *Workflow) validate() error {
+	if w.Name == "" {
+		return errors.New("workflow without a name")
+	}
+	if !w.Has(w.Initial) {
+		return fmt.Errorf("workflow %s: initial status %q isn't one of its statuses", w.Name, w.Initial)
+	}
+	for from, targets := range w.Transitions {
+		for _, to := range targets {
+			if !w.Has(to) {
+				return fmt.Errorf("workflow %s: %s moves to unknown status %q", w.Name, from, to)
+			}
+		}
+	}
+	for _, status := range w.Complete {
+		if !w.Has(status) {
+			return fmt.Errorf("workflow %s: complete status %q isn't one of its statuses", w.Name, status)
+		}
+		if !models.IsClosed(status) {
+			return fmt.Errorf("workflow %s: complete status %q isn't closed, one of %s", w.Name, status, strings.Join(models.ClosedStatuses, ", "))
+		}
+	}
+	return nil
+}
+
+// Builtin returns the workflows that are always available. Basic keeps the
+// statuses the service started with; Kanban adds blocked and cancelled, which
+// finishes an occurrence like done does.
+func Builtin() []Workflow {
+	return []Workflow{
+		{
+			Name:    Basic,
+			Initial: "pending",
+			Transitions: map[string][]string{
+				"pending":     {"in_progress", "done"},
+				"in_progress": {"pending", "done"},
+				"done":        {"pending"},
+			},
+			Complete: []string{"done"},
+		},
+		{
+			Name:    Kanban,
+			Initial: "todo",
+			Transitions: map[string][]string{
+				"todo":        {"in_progress", "cancelled"},
+				"in_progress": {"todo", "blocked", "done", "cancelled"},
+				"blocked":     {"in_progress", "done", "cancelled"},
+				"done":        {"in_progress"},
+				"cancelled":   {"todo"},
+			},
+			Complete: []string{"done", "cancelled"},
+		},
+	}
+}
+
+// Registry holds the workflows groups can pick from
+type Registry struct {
+	workflows map[string]*Workflow
+	def       string
+}
+
+// NewRegistry checks the workflows and indexes them by name. Later workflows
+// replace earlier ones with the same name. def must be one of them.
+func NewRegistry(def string, workflows ...Workflow) (*Registry, error) {
+	r := &Registry{workflows: make(map[string]*Workflow, len(workflows)), def: def}
+	for i := range workflows {
+		w := workflows[i]
+		if len(w.Complete) == 0 && w.Has("done") {
+			w.Complete = []string{"done"}
+		}
+		if err := w.validate(); err != nil {
+			return nil, err
+		}
+		r.workflows[w.Name] = &w
+	}
+	if _, ok := r.workflows[def]; !ok {
+		return nil, fmt.Errorf("default workflow %q isn't defined", def)
+	}
+	return r, nil
+}
+
+// Load builds a registry of the built-in workflows plus those in the YAML
+// file at path, if path isn't empty. The file holds a list of workflows.
+func Load(path, def string) (*Registry, error) {
+	workflows := Builtin()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading workflows: %w", err)
+		}
+		var custom []Workflow
+		if err := yaml.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("parsing workflows %s: %w", path, err)
+		}
+		workflows = append(workflows, custom...)
+	}
+	return NewRegistry(def, workflows...)
+}
+
+// Default is the registry of the built-in workflows with Basic as default
+func Default() *Registry {
+	r, err := NewRegistry(Basic, Builtin()...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Get returns the named workflow; an empty name means the default workflow,
+// which groups created before workflows existed follow.
+func (r *Registry) Get(name string) (*Workflow, bool) {
+	if name == "" {
+		name = r.def
+	}
+	w, ok := r.workflows[name]
+	return w, ok
+}
+
+// DefaultName is the name of the workflow new groups get unless they pick one
+func (r *Registry) DefaultName() string {
+	return r.def
+}
+
+// Names lists the available workflows in alphabetical order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.workflows))
+	for name := range r.workflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
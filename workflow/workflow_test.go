@@ -0,0 +1,192 @@
+package workflow
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// todoList is a small valid workflow the tests break in different ways
+func todoList() Workflow {
+	return Workflow{
+		Name:    "list",
+		Initial: "open",
+		Transitions: map[string][]string{
+			"open":      {"done", "cancelled"},
+			"done":      {"open"},
+			"cancelled": {},
+		},
+		Complete: []string{"done"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(w *Workflow)
+		want   string
+	}{
+		{"valid", func(w *Workflow) {}, ""},
+		{"no name", func(w *Workflow) { w.Name = "" }, "workflow without a name"},
+		{"unknown initial", func(w *Workflow) { w.Initial = "new" }, `initial status "new" isn't one of its statuses`},
+		{"unknown transition target", func(w *Workflow) { w.Transitions["open"] = []string{"done", "archived"} }, `open moves to unknown status "archived"`},
+		{"unknown complete status", func(w *Workflow) { w.Complete = []string{"finished"} }, `complete status "finished" isn't one of its statuses`},
+		{"complete status that isn't closed", func(w *Workflow) { w.Complete = []string{"open"} }, `complete status "open" isn't closed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := todoList()
+			tt.change(&w)
+			err := w.validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error about %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	withoutComplete := todoList()
+	withoutComplete.Complete = nil
+	withoutDone := Workflow{Name: "flow", Initial: "a", Transitions: map[string][]string{"a": {"b"}, "b": {}}}
+	later := todoList()
+	later.Initial = "done"
+
+	tests := []struct {
+		name      string
+		def       string
+		workflows []Workflow
+		want      string
+		// check inspects the registry when it is built
+		check func(r *Registry) bool
+	}{
+		{"builtin", Basic, Builtin(), "", func(r *Registry) bool {
+			return reflect.DeepEqual(r.Names(), []string{Basic, Kanban}) && r.DefaultName() == Basic
+		}},
+		{"unknown default", "scrum", Builtin(), `default workflow "scrum" isn't defined`, nil},
+		{"invalid workflow", Basic, append(Builtin(), Workflow{Name: "broken"}), "workflow broken", nil},
+		{"complete defaults to done", "list", []Workflow{withoutComplete}, "", func(r *Registry) bool {
+			w, _ := r.Get("list")
+			return reflect.DeepEqual(w.Complete, []string{"done"})
+		}},
+		{"nothing completes without done", "flow", []Workflow{withoutDone}, "", func(r *Registry) bool {
+			w, _ := r.Get("flow")
+			return len(w.Complete) == 0
+		}},
+		{"later duplicates replace earlier ones", "list", []Workflow{todoList(), later}, "", func(r *Registry) bool {
+			w, _ := r.Get("list")
+			return len(r.Names()) == 1 && w.Initial == "done"
+		}},
+		{"empty name is the default", Kanban, Builtin(), "", func(r *Registry) bool {
+			w, ok := r.Get("")
+			return ok && w.Name == Kanban
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRegistry(tt.def, tt.workflows...)
+			if tt.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("got %v, want an error about %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(r) {
+				t.Errorf("got %+v", r.workflows)
+			}
+		})
+	}
+
+	// The registry keeps its own copy of each workflow
+	workflows := []Workflow{withoutComplete}
+	if _, err := NewRegistry("list", workflows...); err != nil {
+		t.Fatal(err)
+	}
+	if workflows[0].Complete != nil {
+		t.Errorf("caller's workflow changed to %+v", workflows[0])
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	const replacement = "kanban.yaml"
+	example, err := filepath.Abs("../workflows.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, path, def, want string
+		// names are the workflows loaded when there is no error
+		names []string
+	}{
+		{"builtin only", "", Basic, "", []string{Basic, Kanban}},
+		{"example file", example, "review", "", []string{Basic, Kanban, "review"}},
+		{"file replacing a builtin", write(replacement, `
+- name: kanban
+  initial: backlog
+  transitions:
+    backlog: [done]
+    done: []
+`), Kanban, "", []string{Basic, Kanban}},
+		{"missing file", filepath.Join(dir, "missing.yaml"), Basic, "reading workflows", nil},
+		{"malformed YAML", write("malformed.yaml", "- name: [review"), Basic, "parsing workflows", nil},
+		{"not a list", write("map.yaml", "name: review\n"), Basic, "parsing workflows", nil},
+		{"invalid workflow", write("invalid.yaml", "- name: review\n  initial: draft\n"), Basic, `initial status "draft"`, nil},
+		{"default from nowhere", "", "review", `default workflow "review" isn't defined`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Load(tt.path, tt.def)
+			if tt.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("got %v, want an error about %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r.Names(), tt.names) {
+				t.Errorf("loaded %v, want %v", r.Names(), tt.names)
+			}
+		})
+	}
+
+	// The example's workflow reads as written
+	r, err := Load(example, Basic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, _ := r.Get("review")
+	if review.Initial != "draft" || !review.Allows("in_review", "approved") || !review.Completes("cancelled") || review.Completes("approved") {
+		t.Errorf("got %+v", review)
+	}
+
+	// Workflows in the file replace built-in ones with the same name
+	if r, err = Load(filepath.Join(dir, replacement), Basic); err != nil {
+		t.Fatal(err)
+	}
+	if kanban, _ := r.Get(Kanban); kanban.Initial != "backlog" || !reflect.DeepEqual(kanban.Complete, []string{"done"}) {
+		t.Errorf("got %+v", kanban)
+	}
+}